@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/TylerHorn/cyclestats/plugins/processors/cyclestats"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/common/shim"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+)
+
+// runBench runs the processor benchmarks over the metrics of a line protocol
+// file, or over generated cycles if no file is given, using the processor
+// configuration of the given config file.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	input := fs.String("input", "", "line protocol file with the metrics to benchmark with")
+	config := fs.String("config", "", "path to the config file for the processor")
+	devices := fs.Int("devices", 10, "number of devices to generate metrics for without -input")
+	cycles := fs.Int("cycles", 10, "number of cycles per device to generate without -input")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var metrics []telegraf.Metric
+	var err error
+	if *input != "" {
+		metrics, err = readMetrics(*input)
+		if err != nil {
+			return fmt.Errorf("reading %s failed: %w", *input, err)
+		}
+	} else {
+		metrics = generateMetrics(*devices, *cycles)
+	}
+	if len(metrics) == 0 {
+		return fmt.Errorf("no metrics to benchmark with")
+	}
+
+	newProcessor := func() (*cyclestats.CycleStats, error) {
+		p := cyclestats.New()
+		if *config != "" {
+			conf, err := shim.LoadConfig(config)
+			if err != nil {
+				return nil, err
+			}
+			unwrapped, ok := conf.Processor.(*cyclestats.CycleStats)
+			if !ok {
+				return nil, fmt.Errorf("%s does not configure the cyclestats processor", *config)
+			}
+			p = unwrapped
+		}
+		p.Log = models.NewLogger("processors", "cyclestats", "")
+		return p, p.Init()
+	}
+	// The processor logs on every Init and flush
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// copies returns fresh metrics for an operation, as processing consumes
+	// them
+	copies := func() []telegraf.Metric {
+		out := make([]telegraf.Metric, len(metrics))
+		for i, m := range metrics {
+			out[i] = m.Copy()
+		}
+		return out
+	}
+
+	// Code paths below the processor API are benchmarked by "go test -bench"
+	// in the processor package. A failing benchmark returns no result.
+	benchmarks := []struct {
+		name string
+		run  func(b *testing.B)
+	}{
+		{
+			name: "apply",
+			run: func(b *testing.B) {
+				p, err := newProcessor()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					in := copies()
+					b.StartTimer()
+					for _, m := range in {
+						p.Apply(m)
+					}
+				}
+			},
+		},
+		{
+			// add runs the processor as the agent does, through its shards if
+			// configured with any, until all metrics are flushed
+			name: "add",
+			run: func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					p, err := newProcessor()
+					if err != nil {
+						b.Fatal(err)
+					}
+					in := copies()
+					if err := p.Start(discard{}); err != nil {
+						b.Fatal(err)
+					}
+					b.StartTimer()
+					for _, m := range in {
+						if err := p.Add(m, discard{}); err != nil {
+							b.Fatal(err)
+						}
+					}
+					if err := p.Stop(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			},
+		},
+	}
+
+	fmt.Printf("benchmarking with %d metrics per operation\n", len(metrics))
+	for _, bench := range benchmarks {
+		result := testing.Benchmark(bench.run)
+		if result.N == 0 {
+			return fmt.Errorf("benchmark %s failed", bench.name)
+		}
+		rate := float64(result.N) * float64(len(metrics)) / result.T.Seconds()
+		fmt.Printf("%-12s %s %s %12.0f metrics/s\n", bench.name, result.String(), result.MemString(), rate)
+	}
+	return nil
+}
+
+func readMetrics(path string) ([]telegraf.Metric, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	metrics := make([]telegraf.Metric, 0)
+	parser := influx.NewStreamParser(f)
+	for {
+		m, err := parser.Next()
+		if err == influx.EOF {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+}
+
+// generateMetrics reports each default field as its own metric, once per
+// cycle and device, the way the gateway does.
+func generateMetrics(devices, cycles int) []telegraf.Metric {
+	fields := cyclestats.New().Fields
+	start := time.Unix(1600000000, 0)
+
+	metrics := make([]telegraf.Metric, 0)
+	for c := 0; c < cycles; c++ {
+		ts := start.Add(time.Duration(c) * time.Minute)
+		for d := 0; d < devices; d++ {
+			tags := map[string]string{"id": fmt.Sprint(d)}
+			for measurement, names := range fields {
+				for i, name := range names {
+					metrics = append(metrics, metric.New(measurement, tags, map[string]interface{}{name: int64(c + i)}, ts))
+				}
+			}
+		}
+	}
+	return metrics
+}
+
+// discard is an accumulator dropping everything added to it.
+type discard struct{}
+
+func (discard) AddFields(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddGauge(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddCounter(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddSummary(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddHistogram(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddMetric(m telegraf.Metric) {
+	m.Drop()
+}
+
+func (discard) SetPrecision(time.Duration) {}
+
+func (discard) AddError(error) {}
+
+func (discard) WithTracking(int) telegraf.TrackingAccumulator {
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/influxdata/telegraf/plugins/common/shim"
+)
+
+// summarizer is implemented by processors describing their effective
+// configuration.
+type summarizer interface {
+	Summary() string
+}
+
+// runCheck loads and validates a configuration without processing any
+// metrics and prints the effective configuration of the processor.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	config := fs.String("config", "", "path to the config file to check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	shimLayer := shim.New()
+	if err := shimLayer.LoadConfig(config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if shimLayer.Processor == nil {
+		return fmt.Errorf("configuration holds no processor")
+	}
+
+	if s, ok := shimLayer.Processor.(summarizer); ok {
+		fmt.Print(s.Summary())
+	}
+	fmt.Println("configuration ok")
+	return nil
+}
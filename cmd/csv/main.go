@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/TylerHorn/cyclestats/plugins/outputs/cyclestats_csv"
+
+	"github.com/influxdata/telegraf/plugins/common/shim"
+)
+
+var configFile = flag.String("config", "", "path to the config file for this plugin")
+
+// Writes the cycle aggregates of the processor to rotated CSV files, run by
+// outputs.execd with the aggregates in influx format, e.g.
+//
+//	[[outputs.execd]]
+//	  command = ["/usr/local/bin/cyclestats-csv", "-config", "/etc/telegraf/csv.conf"]
+//	  data_format = "influx"
+//
+// It is built separately from the processor as the shim only runs a single
+// plugin.
+func main() {
+	// parse command line options
+	flag.Parse()
+
+	shimLayer := shim.New()
+	if err := shimLayer.LoadConfig(configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Err loading output: %s\n", err)
+		os.Exit(1)
+	}
+
+	// run the output until stdin closes or we receive a termination signal
+	if err := shimLayer.Run(0); err != nil {
+		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
+		os.Exit(1)
+	}
+}
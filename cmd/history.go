@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TylerHorn/cyclestats/plugins/processors/cyclestats"
+
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// runHistory prints the last cycles recorded in a history database as line
+// protocol, latest first.
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	db := fs.String("db", "", "path to the history database, the processor's history_file")
+	device := fs.String("device", "", "only show the cycles of this device")
+	n := fs.Int("n", 10, "number of cycles to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *db == "" {
+		return fmt.Errorf("no history database given with -db")
+	}
+	if _, err := os.Stat(*db); err != nil {
+		return err
+	}
+
+	cycles, err := cyclestats.QueryHistory(*db, *device, *n)
+	if err != nil {
+		return fmt.Errorf("querying %s failed: %w", *db, err)
+	}
+
+	s := serializer.NewSerializer()
+	for _, m := range cycles {
+		line, err := s.Serialize(m)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(line)
+	}
+	return nil
+}
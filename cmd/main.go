@@ -4,11 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	_ "github.com/TylerHorn/cyclestats/plugins/processors/cyclestats"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent"
 	"github.com/influxdata/telegraf/plugins/common/shim"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
 )
 
 var pollInterval = flag.Duration("poll_interval", 1*time.Second, "how often to send metrics")
@@ -16,6 +21,14 @@ var pollIntervalDisabled = flag.Bool("poll_interval_disabled", false, "set to tr
 var configFile = flag.String("config", "", "path to the config file for this plugin")
 var err error
 
+// subcommands of the standalone binary, run with the remaining arguments
+var subcommands = map[string]func(args []string) error{
+	"bench":    runBench,
+	"check":    runCheck,
+	"history":  runHistory,
+	"selftest": runSelftest,
+}
+
 // This is designed to be simple; Just change the import above and you're good.
 //
 // However, if you want to do all your config in code, you can like so:
@@ -32,6 +45,17 @@ var err error
 // // now the shim.Run() call as below. Note the shim is only intended to run a single plugin.
 //
 func main() {
+	// subcommands of the standalone binary
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Err: %s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// parse command line options
 	flag.Parse()
 	if *pollIntervalDisabled {
@@ -51,9 +75,71 @@ func main() {
 		os.Exit(1)
 	}
 
-	// run a single plugin until stdin closes or we receive a termination signal
-	if err := shimLayer.Run(*pollInterval); err != nil {
+	// processors are run by runProcessor, which stops the processor before
+	// closing the output so metrics emitted on Stop are not lost
+	if shimLayer.Processor != nil {
+		err = runProcessor(shimLayer, shimLayer.Processor)
+	} else {
+		// run a single plugin until stdin closes or we receive a termination signal
+		err = shimLayer.Run(*pollInterval)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
 		os.Exit(1)
 	}
 }
+
+// runProcessor feeds metrics read from stdin to the processor and writes the
+// processed metrics to stdout until stdin closes. Unlike shim.RunProcessor it
+// waits for the processor to stop before closing the output, as processors
+// working in the background may still emit metrics while stopping.
+func runProcessor(shimLayer *shim.Shim, processor telegraf.StreamingProcessor) error {
+	metricCh := make(chan telegraf.Metric, 1)
+	acc := agent.NewAccumulator(shimLayer, metricCh)
+	acc.SetPrecision(time.Nanosecond)
+
+	if err := processor.Start(acc); err != nil {
+		return fmt.Errorf("failed to start processor: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := serializer.NewSerializer()
+		for m := range metricCh {
+			b, err := s.Serialize(m)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to serialize metric: %s\n", err)
+				m.Reject()
+				continue
+			}
+			if _, err := os.Stdout.Write(b); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write metric: %s\n", err)
+				m.Reject()
+				continue
+			}
+			m.Accept()
+		}
+	}()
+
+	parser := influx.NewStreamParser(os.Stdin)
+	for {
+		m, err := parser.Next()
+		if err != nil {
+			if err == influx.EOF {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "Failed to parse metric: %s\n", err)
+			continue
+		}
+		if err := processor.Add(m, acc); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to process metric: %s\n", err)
+		}
+	}
+
+	err := processor.Stop()
+	close(metricCh)
+	wg.Wait()
+	return err
+}
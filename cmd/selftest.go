@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TylerHorn/cyclestats/plugins/processors/cyclestats"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/common/shim"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// traces holds recorded cycle traces as <name>.lp, and the aggregates the
+// processor with its default configuration emits for them, sorted, as
+// <name>.out.
+//
+//go:embed selftest
+var traces embed.FS
+
+// runSelftest feeds every bundled trace through a fresh processor and
+// compares the emitted metrics with the expected ones.
+func runSelftest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := traces.ReadDir("selftest")
+	if err != nil {
+		return err
+	}
+
+	// The processor logs on every Init and flush
+	log.SetOutput(io.Discard)
+
+	failed := 0
+	for _, entry := range entries {
+		if path.Ext(entry.Name()) != ".lp" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".lp")
+
+		diff, err := runTrace(name)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL %s: %v\n", name, err)
+		case len(diff) > 0:
+			failed++
+			fmt.Printf("FAIL %s\n", name)
+			for _, line := range diff {
+				fmt.Printf("    %s\n", line)
+			}
+		default:
+			fmt.Printf("ok   %s\n", name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d traces failed", failed)
+	}
+	return nil
+}
+
+// runTrace processes a trace through Start, Add and Stop like the agent does
+// and returns the differences to the expected output.
+func runTrace(name string) ([]string, error) {
+	input, err := traces.ReadFile(path.Join("selftest", name+".lp"))
+	if err != nil {
+		return nil, err
+	}
+	expected, err := traces.ReadFile(path.Join("selftest", name+".out"))
+	if err != nil {
+		return nil, err
+	}
+
+	processor := cyclestats.New()
+	processor.Log = models.NewLogger("processors", "cyclestats", "")
+	if err := processor.Init(); err != nil {
+		return nil, err
+	}
+
+	metricCh := make(chan telegraf.Metric, 1)
+	acc := agent.NewAccumulator(shim.New(), metricCh)
+	acc.SetPrecision(time.Nanosecond)
+
+	var wg sync.WaitGroup
+	var lines []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := serializer.NewSerializer()
+		for m := range metricCh {
+			b, err := s.Serialize(m)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("unserializable metric %v: %v", m, err))
+				continue
+			}
+			lines = append(lines, strings.TrimSuffix(string(b), "\n"))
+			m.Accept()
+		}
+	}()
+
+	if err := processor.Start(acc); err != nil {
+		return nil, err
+	}
+	parser := influx.NewStreamParser(bytes.NewReader(input))
+	for {
+		m, err := parser.Next()
+		if err == influx.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := processor.Add(m, acc); err != nil {
+			return nil, err
+		}
+	}
+	err = processor.Stop()
+	close(metricCh)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// Groups are flushed in no particular order
+	sort.Strings(lines)
+	return diffLines(strings.Split(strings.TrimSpace(string(expected)), "\n"), lines), nil
+}
+
+// diffLines returns the lines missing from actual prefixed by "-" and the
+// unexpected lines prefixed by "+".
+func diffLines(expected, actual []string) []string {
+	counts := make(map[string]int)
+	for _, line := range expected {
+		counts[line]++
+	}
+	for _, line := range actual {
+		counts[line]--
+	}
+
+	diff := make([]string, 0)
+	for _, line := range expected {
+		if counts[line] > 0 {
+			diff = append(diff, "- "+line)
+			counts[line]--
+		}
+	}
+	for _, line := range actual {
+		if counts[line] < 0 {
+			diff = append(diff, "+ "+line)
+			counts[line]++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/common/shim"
+	"github.com/influxdata/telegraf/plugins/inputs/tail"
+	"github.com/influxdata/telegraf/plugins/parsers"
+
+	"github.com/TylerHorn/cyclestats/plugins/parsers/cyclestats"
+)
+
+var pollInterval = flag.Duration("poll_interval", 1*time.Second, "how often to send metrics")
+var pollIntervalDisabled = flag.Bool("poll_interval_disabled", false, "set to true to disable polling. You want to use this when you are sending metrics on your own schedule")
+var configFile = flag.String("config", "", "path to the config file for this plugin")
+var measurements = flag.String("measurements", "", "comma separated section=measurement renames of the cycle log sections")
+
+// Tails the native cycle logs of the controllers, parsing them into the
+// measurements the processor aggregates, e.g. with the config
+//
+//	[[inputs.tail]]
+//	  files = ["/var/log/controller/cycle.log"]
+//	  from_beginning = false
+//
+// It is built separately from the processor as the shim only runs a single
+// plugin, and the shim does not set up parsers, so the tail input always
+// parses with the cycle log parser.
+func main() {
+	// parse command line options
+	flag.Parse()
+	if *pollIntervalDisabled {
+		*pollInterval = shim.PollIntervalDisabled
+	}
+
+	renames, err := parseRenames(*measurements)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
+		os.Exit(1)
+	}
+
+	shimLayer := shim.New()
+	if err := shimLayer.LoadConfig(configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Err loading input: %s\n", err)
+		os.Exit(1)
+	}
+	input, ok := shimLayer.Input.(*tail.Tail)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Err: config must set up inputs.tail\n")
+		os.Exit(1)
+	}
+	// Every file gets its own parser, which keeps the section being read
+	input.SetParserFunc(func() (parsers.Parser, error) {
+		return cyclestats.NewParser(renames), nil
+	})
+
+	// run the input until stdin closes or we receive a termination signal
+	if err := shimLayer.Run(*pollInterval); err != nil {
+		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseRenames parses the section=measurement renames of the measurements
+// flag.
+func parseRenames(s string) (map[string]string, error) {
+	renames := make(map[string]string)
+	if s == "" {
+		return renames, nil
+	}
+	for _, rename := range strings.Split(s, ",") {
+		parts := strings.SplitN(rename, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid measurements rename %q, expected section=measurement", rename)
+		}
+		renames[parts[0]] = parts[1]
+	}
+	return renames, nil
+}
@@ -0,0 +1,253 @@
+package cyclestats
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/inputs"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Maximum number of registers and coils a single Modbus request may read
+const (
+	maxRegisters = 125
+	maxCoils     = 2000
+)
+
+type CycleStats struct {
+	Controller string          `toml:"controller"`
+	SlaveID    byte            `toml:"slave_id"`
+	Timeout    config.Duration `toml:"timeout"`
+	DeviceTag  string          `toml:"device_tag"`
+	DeviceID   string          `toml:"device_id"`
+	Registers  []*Register     `toml:"register"`
+	Log        telegraf.Logger `toml:"-"`
+
+	handler *modbus.TCPClientHandler
+	client  modbus.Client
+	// blocks are the registers grouped into as few requests as possible
+	blocks []*block
+}
+
+// Register maps a controller register to a field of a measurement.
+type Register struct {
+	Measurement  string  `toml:"measurement"`
+	Field        string  `toml:"field"`
+	Address      uint16  `toml:"address"`
+	RegisterType string  `toml:"register_type"`
+	Type         string  `toml:"type"`
+	Scale        float64 `toml:"scale"`
+}
+
+// block is a contiguous range of registers read with a single request.
+type block struct {
+	registerType string
+	address      uint16
+	quantity     uint16
+	registers    []*Register
+}
+
+func (c *CycleStats) Description() string {
+	return "Polls cycle stats directly from controllers over Modbus/TCP"
+}
+
+func (*CycleStats) SampleConfig() string {
+	return sampleConfig
+}
+
+func New() *CycleStats {
+	return &CycleStats{
+		SlaveID:   1,
+		Timeout:   config.Duration(5 * time.Second),
+		DeviceTag: "id",
+	}
+}
+
+func (c *CycleStats) Init() error {
+	u, err := url.Parse(c.Controller)
+	if err != nil {
+		return fmt.Errorf("invalid controller %q: %v", c.Controller, err)
+	}
+	if u.Scheme != "tcp" || u.Host == "" {
+		return fmt.Errorf("invalid controller %q, expected tcp://host:port", c.Controller)
+	}
+
+	if len(c.Registers) == 0 {
+		return fmt.Errorf("no registers configured")
+	}
+	for _, r := range c.Registers {
+		if r.Measurement == "" || r.Field == "" {
+			return fmt.Errorf("register %d requires a measurement and a field", r.Address)
+		}
+		switch r.RegisterType {
+		case "":
+			r.RegisterType = "holding"
+		case "holding", "input", "coil":
+		default:
+			return fmt.Errorf("invalid register_type %q for field %q", r.RegisterType, r.Field)
+		}
+		switch r.Type {
+		case "":
+			r.Type = "UINT16"
+		case "INT16", "UINT16", "INT32", "UINT32", "FLOAT32":
+		default:
+			return fmt.Errorf("invalid type %q for field %q", r.Type, r.Field)
+		}
+		if r.Scale == 0 {
+			r.Scale = 1
+		}
+	}
+	c.blocks = buildBlocks(c.Registers)
+
+	c.handler = modbus.NewTCPClientHandler(u.Host)
+	c.handler.Timeout = time.Duration(c.Timeout)
+	c.handler.SlaveID = c.SlaveID
+	c.client = modbus.NewClient(c.handler)
+
+	return nil
+}
+
+// buildBlocks merges registers of the same register type into blocks as
+// long as a block stays within the limits of a single request.
+func buildBlocks(registers []*Register) []*block {
+	blocks := make([]*block, 0)
+	for _, r := range registers {
+		limit := uint16(maxRegisters)
+		if r.RegisterType == "coil" {
+			limit = maxCoils
+		}
+
+		merged := false
+		for _, b := range blocks {
+			if b.registerType != r.RegisterType {
+				continue
+			}
+			start, end := b.address, b.address+b.quantity
+			if r.Address < start {
+				start = r.Address
+			}
+			if e := r.Address + r.words(); e > end {
+				end = e
+			}
+			if end-start <= limit {
+				b.address, b.quantity = start, end-start
+				b.registers = append(b.registers, r)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			blocks = append(blocks, &block{
+				registerType: r.RegisterType,
+				address:      r.Address,
+				quantity:     r.words(),
+				registers:    []*Register{r},
+			})
+		}
+	}
+	return blocks
+}
+
+// words returns the number of 16 bit registers holding the value.
+func (r *Register) words() uint16 {
+	switch r.Type {
+	case "INT32", "UINT32", "FLOAT32":
+		if r.RegisterType != "coil" {
+			return 2
+		}
+	}
+	return 1
+}
+
+// decode converts the raw registers of a block into the register's value.
+func (r *Register) decode(b *block, data []byte) (interface{}, error) {
+	offset := int(r.Address - b.address)
+	if r.RegisterType == "coil" {
+		if offset/8 >= len(data) {
+			return nil, fmt.Errorf("short response for field %q", r.Field)
+		}
+		return data[offset/8]&(1<<(offset%8)) != 0, nil
+	}
+
+	start, end := offset*2, (offset+int(r.words()))*2
+	if end > len(data) {
+		return nil, fmt.Errorf("short response for field %q", r.Field)
+	}
+	raw := data[start:end]
+
+	var value float64
+	switch r.Type {
+	case "INT16":
+		value = float64(int16(binary.BigEndian.Uint16(raw)))
+	case "UINT16":
+		value = float64(binary.BigEndian.Uint16(raw))
+	case "INT32":
+		value = float64(int32(binary.BigEndian.Uint32(raw)))
+	case "UINT32":
+		value = float64(binary.BigEndian.Uint32(raw))
+	case "FLOAT32":
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(raw)))
+	}
+
+	// Keep integer registers integer unless they are scaled
+	if r.Scale == 1 && r.Type != "FLOAT32" {
+		return int64(value), nil
+	}
+	return value * r.Scale, nil
+}
+
+func (c *CycleStats) read(b *block) ([]byte, error) {
+	switch b.registerType {
+	case "input":
+		return c.client.ReadInputRegisters(b.address, b.quantity)
+	case "coil":
+		return c.client.ReadCoils(b.address, b.quantity)
+	default:
+		return c.client.ReadHoldingRegisters(b.address, b.quantity)
+	}
+}
+
+// Gather emits one metric per register, the way the gateway reports them to
+// the cyclestats processor.
+func (c *CycleStats) Gather(acc telegraf.Accumulator) error {
+	tags := make(map[string]string)
+	if c.DeviceID != "" {
+		tags[c.DeviceTag] = c.DeviceID
+	}
+
+	now := time.Now()
+	for _, b := range c.blocks {
+		data, err := c.read(b)
+		if err != nil {
+			// Drop the connection so the next gather reconnects
+			c.handler.Close()
+			return fmt.Errorf("reading %s registers %d-%d failed: %v", b.registerType, b.address, b.address+b.quantity-1, err)
+		}
+
+		for _, r := range b.registers {
+			value, err := r.decode(b, data)
+			if err != nil {
+				acc.AddError(err)
+				continue
+			}
+			acc.AddFields(r.Measurement, map[string]interface{}{r.Field: value}, tags, now)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	inputs.Add("cyclestats", func() telegraf.Input {
+		return New()
+	})
+}
@@ -0,0 +1,255 @@
+package cyclestats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/influxdata/telegraf"
+)
+
+func TestInit(t *testing.T) {
+	register := func() []*Register {
+		return []*Register{{Measurement: "steam_params", Field: "cook_temp", Address: 100}}
+	}
+	tests := []struct {
+		name       string
+		controller string
+		registers  []*Register
+		ok         bool
+	}{
+		{name: "valid", controller: "tcp://192.168.1.10:502", registers: register(), ok: true},
+		{name: "no scheme", controller: "192.168.1.10:502", registers: register(), ok: false},
+		{name: "other scheme", controller: "udp://192.168.1.10:502", registers: register(), ok: false},
+		{name: "no registers", controller: "tcp://192.168.1.10:502", ok: false},
+		{name: "no field", controller: "tcp://192.168.1.10:502", registers: []*Register{{Measurement: "steam_params", Address: 100}}, ok: false},
+		{name: "invalid register type", controller: "tcp://192.168.1.10:502",
+			registers: []*Register{{Measurement: "steam_params", Field: "cook_temp", RegisterType: "discrete"}}, ok: false},
+		{name: "invalid type", controller: "tcp://192.168.1.10:502",
+			registers: []*Register{{Measurement: "steam_params", Field: "cook_temp", Type: "FLOAT64"}}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.Controller = tt.controller
+			c.Registers = tt.registers
+			err := c.Init()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			r := c.Registers[0]
+			if r.RegisterType != "holding" || r.Type != "UINT16" || r.Scale != 1 {
+				t.Errorf("register defaults %+v", r)
+			}
+		})
+	}
+}
+
+func TestBuildBlocks(t *testing.T) {
+	tests := []struct {
+		name      string
+		registers []*Register
+		want      string
+	}{
+		{
+			name: "contiguous",
+			registers: []*Register{
+				{Address: 100, RegisterType: "holding", Type: "UINT16"},
+				{Address: 101, RegisterType: "holding", Type: "FLOAT32"},
+			},
+			want: "[holding 100+3]",
+		},
+		{
+			name: "gap within the limit",
+			registers: []*Register{
+				{Address: 110, RegisterType: "holding", Type: "UINT16"},
+				{Address: 100, RegisterType: "holding", Type: "UINT16"},
+			},
+			want: "[holding 100+11]",
+		},
+		{
+			name: "beyond the limit",
+			registers: []*Register{
+				{Address: 0, RegisterType: "holding", Type: "UINT16"},
+				{Address: 200, RegisterType: "holding", Type: "UINT16"},
+			},
+			want: "[holding 0+1 holding 200+1]",
+		},
+		{
+			name: "register types apart",
+			registers: []*Register{
+				{Address: 100, RegisterType: "holding", Type: "UINT16"},
+				{Address: 101, RegisterType: "input", Type: "UINT16"},
+				{Address: 0, RegisterType: "coil", Type: "UINT16"},
+				{Address: 1500, RegisterType: "coil", Type: "UINT32"},
+			},
+			want: "[holding 100+1 input 101+1 coil 0+1501]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := buildBlocks(tt.registers)
+			got := make([]string, 0, len(blocks))
+			for _, b := range blocks {
+				got = append(got, fmt.Sprintf("%s %d+%d", b.registerType, b.address, b.quantity))
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("blocks %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	float32Bits := func(f float32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, math.Float32bits(f))
+		return b
+	}
+	tests := []struct {
+		name     string
+		register Register
+		block    uint16
+		data     []byte
+		want     interface{}
+	}{
+		{name: "uint16", register: Register{Type: "UINT16"}, data: []byte{0xff, 0xfe}, want: int64(65534)},
+		{name: "int16", register: Register{Type: "INT16"}, data: []byte{0xff, 0xfe}, want: int64(-2)},
+		{name: "uint32", register: Register{Type: "UINT32"}, data: []byte{0x00, 0x01, 0x00, 0x00}, want: int64(65536)},
+		{name: "int32", register: Register{Type: "INT32"}, data: []byte{0xff, 0xff, 0xff, 0xff}, want: int64(-1)},
+		{name: "float32", register: Register{Type: "FLOAT32"}, data: float32Bits(134.5), want: 134.5},
+		{name: "scaled", register: Register{Type: "UINT16", Scale: 0.1}, data: []byte{0x05, 0x3e}, want: 134.2},
+		{name: "offset", register: Register{Address: 101, Type: "UINT16"}, block: 100, data: []byte{0x00, 0x01, 0x00, 0x02}, want: int64(2)},
+		{name: "coil", register: Register{Address: 9, RegisterType: "coil"}, data: []byte{0x00, 0x02}, want: true},
+		{name: "coil off", register: Register{Address: 8, RegisterType: "coil"}, data: []byte{0x00, 0x02}, want: false},
+		{name: "short", register: Register{Type: "UINT32"}, data: []byte{0x00, 0x01}},
+		{name: "short coils", register: Register{Address: 16, RegisterType: "coil"}, data: []byte{0x00, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.register
+			if r.RegisterType == "" {
+				r.RegisterType = "holding"
+			}
+			if r.Scale == 0 {
+				r.Scale = 1
+			}
+			b := &block{registerType: r.RegisterType, address: tt.block}
+
+			got, err := r.decode(b, tt.data)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("decoded %v from a short response", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f, ok := tt.want.(float64); ok {
+				if g, ok := got.(float64); !ok || math.Abs(g-f) > 1e-9 {
+					t.Errorf("decoded %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("decoded %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+// fakeClient answers reads from fixed registers.
+type fakeClient struct {
+	modbus.Client
+	holding []byte
+	coils   []byte
+}
+
+func (f *fakeClient) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return f.holding[address*2 : (address+quantity)*2], nil
+}
+
+func (f *fakeClient) ReadInputRegisters(uint16, uint16) ([]byte, error) {
+	return nil, fmt.Errorf("illegal data address")
+}
+
+func (f *fakeClient) ReadCoils(uint16, uint16) ([]byte, error) {
+	return f.coils, nil
+}
+
+// collect is an accumulator keeping the fields and errors added to it.
+type collect struct {
+	fields map[string]interface{}
+	tags   []map[string]string
+	errors []error
+}
+
+func (c *collect) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, _ ...time.Time) {
+	for k, v := range fields {
+		c.fields[measurement+"."+k] = v
+	}
+	c.tags = append(c.tags, tags)
+}
+
+func (*collect) AddGauge(string, map[string]interface{}, map[string]string, ...time.Time)     {}
+func (*collect) AddCounter(string, map[string]interface{}, map[string]string, ...time.Time)   {}
+func (*collect) AddSummary(string, map[string]interface{}, map[string]string, ...time.Time)   {}
+func (*collect) AddHistogram(string, map[string]interface{}, map[string]string, ...time.Time) {}
+func (*collect) AddMetric(telegraf.Metric)                                                    {}
+func (*collect) SetPrecision(time.Duration)                                                   {}
+func (*collect) WithTracking(int) telegraf.TrackingAccumulator                                { return nil }
+
+func (c *collect) AddError(err error) {
+	c.errors = append(c.errors, err)
+}
+
+func TestGather(t *testing.T) {
+	c := New()
+	c.Controller = "tcp://192.168.1.10:502"
+	c.DeviceID = "vessel-1"
+	c.Registers = []*Register{
+		{Measurement: "steam_params", Field: "cook_temp", Address: 0, Scale: 0.1},
+		{Measurement: "steam_stats", Field: "flows", Address: 1},
+		{Measurement: "steam_params", Field: "pv_unsafe", Address: 3, RegisterType: "coil"},
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.client = &fakeClient{holding: []byte{0x05, 0x3e, 0x00, 0x03}, coils: []byte{0x01}}
+
+	acc := &collect{fields: make(map[string]interface{})}
+	if err := c.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	if len(acc.errors) != 0 {
+		t.Errorf("errors %v", acc.errors)
+	}
+	if v, ok := acc.fields["steam_params.cook_temp"].(float64); !ok || math.Abs(v-134.2) > 1e-9 {
+		t.Errorf("cook_temp %v, want 134.2", acc.fields["steam_params.cook_temp"])
+	}
+	if acc.fields["steam_stats.flows"] != int64(3) || acc.fields["steam_params.pv_unsafe"] != true {
+		t.Errorf("fields %v", acc.fields)
+	}
+	for _, tags := range acc.tags {
+		if tags["id"] != "vessel-1" {
+			t.Errorf("tags %v, want the device id", tags)
+		}
+	}
+
+	// A failed read fails the gather
+	c.Registers = append(c.Registers, &Register{Measurement: "steam_stats", Field: "error", Address: 7, RegisterType: "input"})
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	c.client = &fakeClient{holding: []byte{0x05, 0x3e, 0x00, 0x03}, coils: []byte{0x01}}
+	if err := c.Gather(acc); err == nil {
+		t.Errorf("gathered despite a failed read")
+	}
+}
@@ -0,0 +1,143 @@
+package cyclestats_sim
+
+import (
+	_ "embed"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/inputs"
+
+	"github.com/TylerHorn/cyclestats/plugins/processors/cyclestats/testutil"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// failureCodes are the error codes failure cycles report.
+var failureCodes = []int64{12, 17, 23, 31, 42}
+
+type Simulator struct {
+	Devices        int             `toml:"devices"`
+	DevicePrefix   string          `toml:"device_prefix"`
+	DeviceTag      string          `toml:"device_tag"`
+	CycleLength    config.Duration `toml:"cycle_length"`
+	MetricInterval config.Duration `toml:"metric_interval"`
+	Cycles         []string        `toml:"cycles"`
+	FailureRate    float64         `toml:"failure_rate"`
+	Noise          float64         `toml:"noise"`
+	Seed           int64           `toml:"seed"`
+	Log            telegraf.Logger `toml:"-"`
+
+	generator *testutil.Generator
+	rand      *rand.Rand
+	// next holds the start of the next cycle per device
+	next map[string]time.Time
+	now  func() time.Time
+}
+
+func (s *Simulator) Description() string {
+	return "Generates fake but realistic cycle telemetry for load tests and dashboards"
+}
+
+func (*Simulator) SampleConfig() string {
+	return sampleConfig
+}
+
+func New() *Simulator {
+	return &Simulator{
+		Devices:        10,
+		DevicePrefix:   "vessel-",
+		DeviceTag:      "id",
+		CycleLength:    config.Duration(20 * time.Minute),
+		MetricInterval: config.Duration(50 * time.Millisecond),
+		Cycles:         []string{"steam", "grind"},
+		FailureRate:    0.05,
+		Noise:          0.01,
+		now:            time.Now,
+	}
+}
+
+func (s *Simulator) Init() error {
+	if s.Devices <= 0 {
+		return fmt.Errorf("devices must be positive")
+	}
+	if s.CycleLength <= 0 || s.MetricInterval <= 0 {
+		return fmt.Errorf("cycle_length and metric_interval must be positive")
+	}
+	if s.FailureRate < 0 || s.FailureRate > 1 {
+		return fmt.Errorf("failure_rate must be between 0 and 1")
+	}
+	for _, cycle := range s.Cycles {
+		if cycle != "steam" && cycle != "grind" {
+			return fmt.Errorf("invalid cycle %q", cycle)
+		}
+	}
+
+	seed := s.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.rand = rand.New(rand.NewSource(seed))
+	s.generator = testutil.NewGenerator(seed)
+	s.generator.DeviceTag = s.DeviceTag
+	s.generator.Interval = time.Duration(s.MetricInterval)
+	s.generator.Noise = s.Noise
+
+	// Spreading the first cycles avoids all devices reporting at once
+	start := s.now()
+	length := time.Duration(s.CycleLength)
+	s.next = make(map[string]time.Time, s.Devices)
+	for i := 0; i < s.Devices; i++ {
+		s.next[s.device(i)] = start.Add(length * time.Duration(i) / time.Duration(s.Devices))
+	}
+	return nil
+}
+
+func (s *Simulator) device(i int) string {
+	return fmt.Sprintf("%s%d", s.DevicePrefix, i+1)
+}
+
+// Gather emits the cycles of the devices due since the last gather.
+func (s *Simulator) Gather(acc telegraf.Accumulator) error {
+	now := s.now()
+	for i := 0; i < s.Devices; i++ {
+		device := s.device(i)
+		for !s.next[device].After(now) {
+			start := s.next[device]
+			for _, m := range s.cycle(device, start) {
+				acc.AddMetric(m)
+			}
+			s.next[device] = start.Add(time.Duration(s.CycleLength))
+		}
+	}
+	return nil
+}
+
+// cycle generates the configured cycles of a device one after another, the
+// steam cycle failing with failure_rate.
+func (s *Simulator) cycle(device string, start time.Time) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0)
+	for _, cycle := range s.Cycles {
+		at := start.Add(time.Duration(len(out)) * time.Duration(s.MetricInterval))
+		switch {
+		case cycle == "grind":
+			out = append(out, s.generator.GrindCycle(device, at)...)
+		case s.rand.Float64() < s.FailureRate:
+			failure := testutil.LidFailures[s.rand.Intn(len(testutil.LidFailures))]
+			code := failureCodes[s.rand.Intn(len(failureCodes))]
+			out = append(out, s.generator.FailureCycle(device, at, failure, code)...)
+		default:
+			out = append(out, s.generator.SteamCycle(device, at)...)
+		}
+	}
+	return out
+}
+
+func init() {
+	inputs.Add("cyclestats_sim", func() telegraf.Input {
+		return New()
+	})
+}
@@ -0,0 +1,162 @@
+package cyclestats_sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+)
+
+// collect is an accumulator keeping the metrics added to it.
+type collect struct {
+	metrics []telegraf.Metric
+}
+
+func (*collect) AddFields(string, map[string]interface{}, map[string]string, ...time.Time)    {}
+func (*collect) AddGauge(string, map[string]interface{}, map[string]string, ...time.Time)     {}
+func (*collect) AddCounter(string, map[string]interface{}, map[string]string, ...time.Time)   {}
+func (*collect) AddSummary(string, map[string]interface{}, map[string]string, ...time.Time)   {}
+func (*collect) AddHistogram(string, map[string]interface{}, map[string]string, ...time.Time) {}
+func (*collect) SetPrecision(time.Duration)                                                   {}
+func (*collect) AddError(error)                                                               {}
+func (*collect) WithTracking(int) telegraf.TrackingAccumulator                                { return nil }
+
+func (c *collect) AddMetric(m telegraf.Metric) {
+	c.metrics = append(c.metrics, m)
+}
+
+// take returns the metrics collected since the last call by measurement and
+// device.
+func (c *collect) take() map[string]int {
+	out := make(map[string]int)
+	for _, m := range c.metrics {
+		device, _ := m.GetTag("vessel")
+		out[m.Name()+" "+device]++
+	}
+	c.metrics = nil
+	return out
+}
+
+func newTestSimulator(t *testing.T, configure func(s *Simulator)) (*Simulator, *time.Time) {
+	t.Helper()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := New()
+	s.Devices = 2
+	s.DeviceTag = "vessel"
+	s.CycleLength = config.Duration(10 * time.Minute)
+	s.Seed = 1
+	s.now = func() time.Time { return now }
+	configure(s)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s, &now
+}
+
+func TestGather(t *testing.T) {
+	s, now := newTestSimulator(t, func(s *Simulator) {
+		s.Cycles = []string{"steam", "grind"}
+		s.FailureRate = 0
+	})
+
+	// A steam cycle has 10 steam_params and 5 steam_stats metrics, a grind
+	// cycle 5 grinder metrics
+	cycles := func(device string, n int) map[string]int {
+		return map[string]int{
+			"steam_params " + device: 10 * n,
+			"steam_stats " + device:  5 * n,
+			"grinder " + device:      5 * n,
+		}
+	}
+	both := cycles("vessel-1", 2)
+	for k, v := range cycles("vessel-2", 2) {
+		both[k] = v
+	}
+
+	tests := []struct {
+		advance time.Duration
+		want    map[string]int
+	}{
+		// The cycles of the devices are spread over the cycle length
+		{advance: 0, want: cycles("vessel-1", 1)},
+		{advance: time.Minute, want: map[string]int{}},
+		{advance: 4 * time.Minute, want: cycles("vessel-2", 1)},
+		// Cycles missed between gathers are caught up
+		{advance: 20 * time.Minute, want: both},
+	}
+	acc := &collect{}
+	for i, tt := range tests {
+		*now = now.Add(tt.advance)
+		if err := s.Gather(acc); err != nil {
+			t.Fatal(err)
+		}
+		got := acc.take()
+		if len(got) != len(tt.want) {
+			t.Errorf("gather %d: got %v, want %v", i, got, tt.want)
+			continue
+		}
+		for key, n := range tt.want {
+			if got[key] != n {
+				t.Errorf("gather %d: got %v, want %v", i, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestGatherFailures(t *testing.T) {
+	s, _ := newTestSimulator(t, func(s *Simulator) {
+		s.Devices = 1
+		s.Cycles = []string{"steam"}
+		s.FailureRate = 1
+	})
+
+	acc := &collect{}
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	var failed, code int
+	for _, m := range acc.metrics {
+		if m.Name() != "vessel_lid_failure" {
+			t.Fatalf("got %q metric of a failing steam cycle", m.Name())
+		}
+		if v, ok := m.GetField("error"); ok {
+			code++
+			if v.(int64) == 0 {
+				t.Errorf("failure cycle without error code")
+			}
+		}
+		for _, field := range m.FieldList() {
+			if v, ok := field.Value.(bool); ok && v {
+				failed++
+			}
+		}
+	}
+	if failed != 1 || code != 1 {
+		t.Errorf("got %d failures and %d error codes, want 1 of each: %v", failed, code, acc.metrics)
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(s *Simulator)
+	}{
+		{name: "no devices", configure: func(s *Simulator) { s.Devices = 0 }},
+		{name: "no cycle length", configure: func(s *Simulator) { s.CycleLength = 0 }},
+		{name: "negative metric interval", configure: func(s *Simulator) { s.MetricInterval = config.Duration(-time.Millisecond) }},
+		{name: "failure rate above 1", configure: func(s *Simulator) { s.FailureRate = 1.5 }},
+		{name: "unknown cycle", configure: func(s *Simulator) { s.Cycles = []string{"steam", "rinse"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			tt.configure(s)
+			if err := s.Init(); err == nil {
+				t.Errorf("invalid configuration accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package cyclestats_csv
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/plugins/outputs"
+
+	summary "github.com/TylerHorn/cyclestats/plugins/serializers/cyclestats"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// rotatedFormat is the time format of the names of rotated files.
+const rotatedFormat = "2006-01-02T15-04-05"
+
+type CSV struct {
+	File             string              `toml:"file"`
+	Fields           map[string][]string `toml:"fields"`
+	Tags             []string            `toml:"tags"`
+	Identity         []string            `toml:"identity"`
+	Header           bool                `toml:"header"`
+	TimestampUnits   config.Duration     `toml:"timestamp_units"`
+	RotationInterval config.Duration     `toml:"rotation_interval"`
+	RotationMaxSize  config.Size         `toml:"rotation_max_size"`
+	RotateCommand    []string            `toml:"rotate_command"`
+	Log              telegraf.Logger     `toml:"-"`
+
+	serializer *summary.CSVSerializer
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// commands tracks the running rotate_commands
+	commands sync.WaitGroup
+	now      func() time.Time
+}
+
+func (c *CSV) Description() string {
+	return "Writes a CSV row per cycle to a rotated file for spreadsheet and ERP imports"
+}
+
+func (*CSV) SampleConfig() string {
+	return sampleConfig
+}
+
+func New() *CSV {
+	return &CSV{
+		Tags:           []string{"id", "steam_cycle"},
+		Header:         true,
+		TimestampUnits: config.Duration(time.Second),
+		now:            time.Now,
+	}
+}
+
+func (c *CSV) Init() error {
+	if c.File == "" {
+		return fmt.Errorf("file is required")
+	}
+	if c.RotationInterval < 0 {
+		return fmt.Errorf("rotation_interval must not be negative")
+	}
+
+	var err error
+	c.serializer, err = summary.NewCSVSerializer(c.Fields, c.Tags, c.Identity, c.Header, time.Duration(c.TimestampUnits))
+	return err
+}
+
+// Connect opens the file, continuing a file left by a previous run.
+func (c *CSV) Connect() error {
+	return c.open()
+}
+
+func (c *CSV) open() error {
+	f, err := os.OpenFile(c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c.file = f
+	c.size = info.Size()
+	c.opened = c.now()
+	c.serializer.Rotate(c.size == 0)
+	return nil
+}
+
+func (c *CSV) Close() error {
+	var err error
+	if c.file != nil {
+		err = c.file.Close()
+		c.file = nil
+	}
+	c.commands.Wait()
+	return err
+}
+
+func (c *CSV) Write(metrics []telegraf.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	b, err := c.serializer.SerializeBatch(metrics)
+	if err != nil {
+		return err
+	}
+	if c.rotationDue(int64(len(b))) {
+		if err := c.rotate(); err != nil {
+			return fmt.Errorf("could not rotate %s: %v", c.File, err)
+		}
+		// The new file starts with the header row
+		if b, err = c.serializer.SerializeBatch(metrics); err != nil {
+			return err
+		}
+	}
+
+	n, err := c.file.Write(b)
+	c.size += int64(n)
+	return err
+}
+
+// rotationDue reports whether a file must be started before writing n more
+// bytes. Files are never left empty, even if n alone exceeds the size limit.
+func (c *CSV) rotationDue(n int64) bool {
+	if c.size == 0 {
+		return false
+	}
+	if c.RotationInterval > 0 && c.now().Sub(c.opened) >= time.Duration(c.RotationInterval) {
+		return true
+	}
+	return c.RotationMaxSize > 0 && c.size+n > int64(c.RotationMaxSize)
+}
+
+// rotate renames the file with the time of the rotation, runs the
+// rotate_command on it and starts a new file.
+func (c *CSV) rotate() error {
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	c.file = nil
+
+	rotated := c.rotatedName()
+	if err := os.Rename(c.File, rotated); err != nil {
+		return err
+	}
+	c.runRotateCommand(rotated)
+	return c.open()
+}
+
+// rotatedName returns the name of the file rotated now, numbered if files
+// were rotated within the same second.
+func (c *CSV) rotatedName() string {
+	ext := filepath.Ext(c.File)
+	base := strings.TrimSuffix(c.File, ext) + "." + c.now().UTC().Format(rotatedFormat)
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// runRotateCommand runs the rotate_command on a rotated file in the
+// background.
+func (c *CSV) runRotateCommand(rotated string) {
+	if len(c.RotateCommand) == 0 {
+		return
+	}
+
+	args := append(append([]string{}, c.RotateCommand[1:]...), rotated)
+	cmd := exec.Command(c.RotateCommand[0], args...)
+	c.commands.Add(1)
+	go func() {
+		defer c.commands.Done()
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			c.Log.Errorf("Rotate command failed on %s: %v: %s", rotated, err, out)
+			return
+		}
+		if len(out) > 0 {
+			c.Log.Infof("Rotate command on %s: %s", rotated, out)
+		}
+	}()
+}
+
+func init() {
+	outputs.Add("cyclestats_csv", func() telegraf.Output {
+		return New()
+	})
+}
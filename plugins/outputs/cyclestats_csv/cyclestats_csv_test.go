@@ -0,0 +1,187 @@
+package cyclestats_csv
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+)
+
+const header = "timestamp,id,steam_params_cook_temp\n"
+
+func newTestCSV(t *testing.T, configure func(c *CSV)) (*CSV, *time.Time) {
+	t.Helper()
+
+	now := time.Date(2022, 3, 1, 10, 15, 0, 0, time.UTC)
+	c := New()
+	c.Log = models.NewLogger("outputs", "cyclestats_csv", "")
+	c.File = filepath.Join(t.TempDir(), "cycles.csv")
+	c.Fields = map[string][]string{"steam_params": {"cook_temp"}}
+	c.Tags = []string{"id"}
+	c.now = func() time.Time { return now }
+	configure(c)
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return c, &now
+}
+
+func cycle(device string, temp float64) []telegraf.Metric {
+	return []telegraf.Metric{metric.New("steam_params", map[string]string{"id": device},
+		map[string]interface{}{"cook_temp": temp}, time.Unix(1646129700, 0))}
+}
+
+// files returns the contents of the files in dir by name.
+func files(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string, len(entries))
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[e.Name()] = string(b)
+	}
+	return out
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(c *CSV)
+		// advance is how far the clock moves after every write
+		advance time.Duration
+		want    map[string]string
+	}{
+		{
+			name:      "no rotation",
+			configure: func(*CSV) {},
+			advance:   time.Hour,
+			want: map[string]string{
+				"cycles.csv": header + "1646129700,1,120.5\n1646129700,2,121.5\n1646129700,3,122.5\n",
+			},
+		},
+		{
+			name:      "interval",
+			configure: func(c *CSV) { c.RotationInterval = config.Duration(time.Hour) },
+			advance:   40 * time.Minute,
+			want: map[string]string{
+				"cycles.2022-03-01T11-35-00.csv": header + "1646129700,1,120.5\n1646129700,2,121.5\n",
+				"cycles.csv":                     header + "1646129700,3,122.5\n",
+			},
+		},
+		{
+			name:      "size",
+			configure: func(c *CSV) { c.RotationMaxSize = config.Size(len(header) + 20) },
+			want: map[string]string{
+				"cycles.2022-03-01T10-15-00.csv":   header + "1646129700,1,120.5\n",
+				"cycles.2022-03-01T10-15-00-1.csv": header + "1646129700,2,121.5\n",
+				"cycles.csv":                       header + "1646129700,3,122.5\n",
+			},
+		},
+		{
+			name: "no header",
+			configure: func(c *CSV) {
+				c.Header = false
+				c.RotationMaxSize = config.Size(40)
+			},
+			want: map[string]string{
+				"cycles.2022-03-01T10-15-00.csv": "1646129700,1,120.5\n1646129700,2,121.5\n",
+				"cycles.csv":                     "1646129700,3,122.5\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, now := newTestCSV(t, tt.configure)
+			for i, temp := range []float64{120.5, 121.5, 122.5} {
+				if err := c.Write(cycle(string(rune('1'+i)), temp)); err != nil {
+					t.Fatal(err)
+				}
+				*now = now.Add(tt.advance)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := files(t, filepath.Dir(c.File))
+			if len(got) != len(tt.want) {
+				t.Errorf("got files %v, want %v", names(got), names(tt.want))
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s holds\n%s\nwant\n%s", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestContinueFile(t *testing.T) {
+	c, _ := newTestCSV(t, func(*CSV) {})
+	if err := c.Write(cycle("1", 120.5)); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// A restart appends to the file without another header row
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(cycle("2", 121.5)); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	b, err := os.ReadFile(c.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := header + "1646129700,1,120.5\n1646129700,2,121.5\n"; string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestRotateCommand(t *testing.T) {
+	c, _ := newTestCSV(t, func(c *CSV) {
+		c.RotationMaxSize = config.Size(1)
+		c.RotateCommand = []string{"sh", "-c", `cp "$0" "$0.imported"`}
+	})
+	for _, device := range []string{"1", "2"} {
+		if err := c.Write(cycle(device, 120.5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close waits for the commands
+	c.Close()
+
+	got := files(t, filepath.Dir(c.File))
+	rotated := "cycles.2022-03-01T10-15-00.csv"
+	if got[rotated+".imported"] != got[rotated] || got[rotated] == "" {
+		t.Errorf("rotate command not run on %s: %v", rotated, names(got))
+	}
+}
+
+func names(files map[string]string) string {
+	out := make([]string, 0, len(files))
+	for name := range files {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
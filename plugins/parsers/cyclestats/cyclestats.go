@@ -0,0 +1,209 @@
+// Package cyclestats parses the native ASCII cycle log of the controllers
+// into the measurements aggregated by the cyclestats processor.
+//
+// The log is made of sections, each started by a "[name]" line and holding
+// one "key=value" line per field:
+//
+//	[cycle]
+//	id=vessel-0042
+//	steam_cycle=1234
+//	time=2022-03-01T10:15:00Z
+//	[steam_params]
+//	cook_temp=121.3
+//	steam_type=2
+//	[vessel_status]
+//	door="closed"
+//
+// A "cycle" section starts a cycle: its keys are added as tags to the
+// metrics of all following sections, except "time", the timestamp of those
+// metrics as RFC3339 or Unix seconds. Every other section is a measurement
+// named after the section. Values are parsed as integers, floats and
+// booleans where possible and as strings otherwise; quoted values are
+// always strings. Blank lines and lines starting with "#" are ignored.
+//
+// The parser keeps the current cycle and section between calls, so the log
+// can be fed a line at a time, as the tail input does. The metric of a
+// section is returned once the next section starts, with all its fields
+// however many calls they were fed over.
+package cyclestats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/parsers"
+)
+
+// cycleSection is the section starting a cycle.
+const cycleSection = "cycle"
+
+// Parser decodes controller cycle logs into metrics.
+type Parser struct {
+	// Measurements renames sections to measurements, sections not listed
+	// keep their name
+	Measurements map[string]string `toml:"cyclestats_measurements"`
+	DefaultTags  map[string]string `toml:"-"`
+	Now          func() time.Time  `toml:"-"`
+
+	// The cycle and section being read and the metric of the section,
+	// shared between calls
+	section string
+	tags    map[string]string
+	time    time.Time
+	current telegraf.Metric
+	mu      sync.Mutex
+}
+
+func NewParser(measurements map[string]string) *Parser {
+	return &Parser{
+		Measurements: measurements,
+		Now:          time.Now,
+	}
+}
+
+// Parse returns a metric per section holding fields ended in buf.
+func (p *Parser) Parse(buf []byte) ([]telegraf.Metric, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	metrics := make([]telegraf.Metric, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if p.current != nil {
+				metrics = append(metrics, p.current)
+				p.current = nil
+			}
+			p.startSection(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+
+		key, value, err := splitLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		switch p.section {
+		case "":
+			return nil, fmt.Errorf("line %d: %q outside of a section", n, key)
+		case cycleSection:
+			if err := p.setCycle(key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		default:
+			if p.current == nil {
+				p.current = p.newMetric()
+			}
+			p.current.AddField(key, parseValue(value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// ParseLine parses a single line of the log. Only section headers ending a
+// section with fields return a metric.
+func (p *Parser) ParseLine(line string) (telegraf.Metric, error) {
+	metrics, err := p.Parse([]byte(line))
+	if err != nil || len(metrics) == 0 {
+		return nil, err
+	}
+	return metrics[0], nil
+}
+
+func (p *Parser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+func (p *Parser) startSection(name string) {
+	p.section = name
+	if name == cycleSection {
+		p.tags = make(map[string]string)
+		p.time = time.Time{}
+	}
+}
+
+// setCycle sets a tag or the timestamp of the current cycle.
+func (p *Parser) setCycle(key, value string) error {
+	if key != "time" {
+		p.tags[key] = strings.Trim(value, `"`)
+		return nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		p.time = time.Unix(seconds, 0)
+		return nil
+	}
+	ts, err := time.Parse(time.RFC3339, strings.Trim(value, `"`))
+	if err != nil {
+		return fmt.Errorf("invalid cycle time %q", value)
+	}
+	p.time = ts
+	return nil
+}
+
+// newMetric returns an empty metric of the current section with the tags
+// of the current cycle.
+func (p *Parser) newMetric() telegraf.Metric {
+	name, ok := p.Measurements[p.section]
+	if !ok {
+		name = p.section
+	}
+	ts := p.time
+	if ts.IsZero() {
+		ts = p.Now()
+	}
+
+	m := metric.New(name, nil, nil, ts)
+	for k, v := range p.DefaultTags {
+		m.AddTag(k, v)
+	}
+	for k, v := range p.tags {
+		m.AddTag(k, v)
+	}
+	return m
+}
+
+func splitLine(line string) (string, string, error) {
+	i := strings.Index(line, "=")
+	if i <= 0 {
+		return "", "", fmt.Errorf("expected key=value, got %q", line)
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), nil
+}
+
+func parseValue(value string) interface{} {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value[1 : len(value)-1]
+	}
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseBool(value); err == nil {
+		return v
+	}
+	return value
+}
+
+func init() {
+	parsers.Add("cyclestats",
+		func(defaultMetricName string) telegraf.Parser {
+			return NewParser(nil)
+		})
+}
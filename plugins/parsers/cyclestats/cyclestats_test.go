@@ -0,0 +1,128 @@
+package cyclestats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+const cycleLog = `[cycle]
+id=vessel-0042
+steam_cycle=1234
+time=2022-03-01T10:15:00Z
+[steam_params]
+cook_temp=121.3
+steam_type=2
+[vessel_status]
+door="closed"
+[cycle]
+id=vessel-0042
+steam_cycle=1235
+time=1646129760
+[steam_params]
+cook_temp=120.8
+`
+
+// parseLines feeds the log to a parser a line at a time, as the tail input
+// does.
+func parseLines(t *testing.T, p *Parser, log string) []telegraf.Metric {
+	t.Helper()
+
+	metrics := make([]telegraf.Metric, 0)
+	for _, line := range strings.Split(log, "\n") {
+		ms, err := p.Parse([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics = append(metrics, ms...)
+	}
+	return metrics
+}
+
+func TestParseSectionsAcrossCalls(t *testing.T) {
+	p := NewParser(map[string]string{"vessel_status": "vessel"})
+	metrics := parseLines(t, p, cycleLog)
+
+	// The last section is returned once the next one starts
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2: %v", len(metrics), metrics)
+	}
+
+	first := time.Date(2022, 3, 1, 10, 15, 0, 0, time.UTC)
+	want := []struct {
+		name   string
+		tags   map[string]string
+		fields map[string]interface{}
+		time   time.Time
+	}{
+		{
+			name:   "steam_params",
+			tags:   map[string]string{"id": "vessel-0042", "steam_cycle": "1234"},
+			fields: map[string]interface{}{"cook_temp": 121.3, "steam_type": int64(2)},
+			time:   first,
+		},
+		{
+			name:   "vessel",
+			tags:   map[string]string{"id": "vessel-0042", "steam_cycle": "1234"},
+			fields: map[string]interface{}{"door": "closed"},
+			time:   first,
+		},
+		{
+			name:   "steam_params",
+			tags:   map[string]string{"id": "vessel-0042", "steam_cycle": "1235"},
+			fields: map[string]interface{}{"cook_temp": 120.8},
+			time:   time.Unix(1646129760, 0),
+		},
+	}
+	ms := append(metrics, parseLines(t, p, "[cycle]")...)
+	if len(ms) != len(want) {
+		t.Fatalf("got %d metrics once the next cycle started, want %d: %v", len(ms), len(want), ms)
+	}
+	for i, w := range want {
+		m := ms[i]
+		if m.Name() != w.name {
+			t.Errorf("metric %d named %q, want %q", i, m.Name(), w.name)
+		}
+		if !reflect.DeepEqual(m.Tags(), w.tags) {
+			t.Errorf("metric %d tagged %v, want %v", i, m.Tags(), w.tags)
+		}
+		if !reflect.DeepEqual(m.Fields(), w.fields) {
+			t.Errorf("metric %d has fields %v, want %v", i, m.Fields(), w.fields)
+		}
+		if !m.Time().Equal(w.time) {
+			t.Errorf("metric %d at %v, want %v", i, m.Time(), w.time)
+		}
+	}
+}
+
+func TestParseBufferMatchesLines(t *testing.T) {
+	whole, err := NewParser(nil).Parse([]byte(cycleLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := parseLines(t, NewParser(nil), cycleLog)
+
+	if len(whole) != len(lines) {
+		t.Fatalf("got %d metrics from the buffer and %d from its lines", len(whole), len(lines))
+	}
+	for i := range whole {
+		if whole[i].Name() != lines[i].Name() || !reflect.DeepEqual(whole[i].Fields(), lines[i].Fields()) {
+			t.Errorf("metric %d is %v from the buffer and %v from its lines", i, whole[i], lines[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, log := range []string{
+		"cook_temp=121.3",
+		"[steam_params]\ncook_temp",
+		"[cycle]\ntime=yesterday",
+	} {
+		if _, err := NewParser(nil).Parse([]byte(log)); err == nil {
+			t.Errorf("no error parsing %q", log)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package cyclestats
+
+import (
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// ackTracker holds on to emitted aggregates until the outputs confirm their
+// delivery. Undelivered aggregates are either resent as they are, when they
+// are journaled, or their source metrics are handed back to be cached and
+// flushed again.
+type ackTracker struct {
+	journal *journal
+
+	mu      sync.Mutex
+	pending map[telegraf.TrackingID]*pendingAggregate
+	retry   []telegraf.Metric
+	resend  []*pendingAggregate
+}
+
+type pendingAggregate struct {
+	aggregate telegraf.Metric
+	metrics   []telegraf.Metric
+	// seq is the journal sequence number, zero if not journaled
+	seq uint64
+	// hold is set if the metrics are held for delivery tracking and must be
+	// accepted once the aggregate is delivered
+	hold bool
+}
+
+func newAckTracker(j *journal) *ackTracker {
+	return &ackTracker{
+		journal: j,
+		pending: make(map[telegraf.TrackingID]*pendingAggregate),
+	}
+}
+
+// track returns a tracking copy of the aggregate whose delivery releases or
+// retries the aggregate and its source metrics.
+func (a *ackTracker) track(p *pendingAggregate) telegraf.Metric {
+	tracked, id := metric.WithTracking(p.aggregate.Copy(), a.onDelivery)
+
+	a.mu.Lock()
+	a.pending[id] = p
+	a.mu.Unlock()
+
+	return tracked
+}
+
+func (a *ackTracker) onDelivery(info telegraf.DeliveryInfo) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pending[info.ID()]
+	if !ok {
+		return
+	}
+	delete(a.pending, info.ID())
+
+	switch {
+	case info.Delivered() && p.seq != 0:
+		// A failure leaves the record pending, so it is replayed on restart
+		_ = a.journal.complete(p.seq)
+		p.accept()
+	case info.Delivered():
+		p.accept()
+	case p.seq != 0:
+		a.resend = append(a.resend, p)
+	default:
+		a.retry = append(a.retry, p.metrics...)
+	}
+}
+
+func (p *pendingAggregate) accept() {
+	if !p.hold {
+		return
+	}
+	for _, m := range p.metrics {
+		m.Accept()
+	}
+}
+
+// takeRetries returns the source metrics of undelivered aggregates and the
+// journaled aggregates to resend.
+func (a *ackTracker) takeRetries() ([]telegraf.Metric, []*pendingAggregate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	retry, resend := a.retry, a.resend
+	a.retry, a.resend = nil, nil
+	return retry, resend
+}
+
+// trackAggregate journals the aggregate if a journal is configured and
+// returns the metric to emit in its place.
+func (t *CycleStats) trackAggregate(aggregate telegraf.Metric, ms []telegraf.Metric) telegraf.Metric {
+	if !t.AckFlush && t.journal == nil {
+		t.releaseSources(ms, true)
+		return aggregate
+	}
+
+	p := &pendingAggregate{aggregate: aggregate, metrics: ms, hold: t.TrackDeliveries}
+	if t.journal != nil {
+		seq, err := t.journal.append(aggregate)
+		if err != nil {
+			t.Log.Errorf("Could not journal aggregate: %v", err)
+			t.reportProblem(problemStatePersistence)
+		}
+		p.seq = seq
+	}
+	return t.acks.track(p)
+}
+
+// releaseSources accepts the source metrics held for delivery tracking once
+// their aggregate is produced, or rejects them if it was dropped.
+func (t *CycleStats) releaseSources(ms []telegraf.Metric, produced bool) {
+	if !t.TrackDeliveries {
+		return
+	}
+	for _, m := range ms {
+		if produced {
+			m.Accept()
+		} else {
+			m.Reject()
+		}
+	}
+}
+
+// requeueUndelivered puts the source metrics of undelivered aggregates back
+// into the cache so they are part of the next flush and returns the
+// journaled aggregates to emit again.
+func (t *CycleStats) requeueUndelivered() []telegraf.Metric {
+	if !t.AckFlush && t.journal == nil {
+		return nil
+	}
+
+	retry, resend := t.acks.takeRetries()
+	if len(retry) > 0 {
+		t.Log.Warnf("Aggregate was not delivered, retrying %d metrics on next flush", len(retry))
+		t.reportProblem(problemDelivery)
+	}
+	for _, m := range retry {
+		t.groupBy(m)
+	}
+
+	if len(resend) > 0 {
+		t.Log.Warnf("Resending %d undelivered journaled aggregates", len(resend))
+		t.reportProblem(problemDelivery)
+	}
+	out := make([]telegraf.Metric, 0, len(resend))
+	for _, p := range resend {
+		out = append(out, t.acks.track(p))
+	}
+	return out
+}
+
+// replayJournal emits the aggregates left pending in the journal by a
+// previous run.
+func (t *CycleStats) replayJournal(acc telegraf.Accumulator) {
+	replay := t.journal.replay()
+	if len(replay) == 0 {
+		return
+	}
+
+	t.Log.Infof("Replaying %d journaled aggregates", len(replay))
+	for _, p := range replay {
+		acc.AddMetric(t.acks.track(p))
+	}
+}
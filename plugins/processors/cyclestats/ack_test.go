@@ -0,0 +1,61 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func TestAckFlush(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered bool
+		retried   int64
+	}{
+		{name: "delivered", delivered: true},
+		{name: "undelivered", delivered: false, retried: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.AckFlush = true
+				p.DropOriginal = true
+				p.SampleCounts = true
+			})
+
+			start := time.Unix(1600000000, 0)
+			cycle := make([]telegraf.Metric, 0, 5)
+			for _, field := range []string{"stop_cook_count", "error", "flows", "pd_timeouts", "stag_recoveries"} {
+				cycle = append(cycle, steamStats(nil, field, int64(1), start))
+			}
+			out := applyAll(p, cycle...)
+			if len(out) != 1 {
+				t.Fatalf("got %d metrics for the cycle, want 1: %v", len(out), out)
+			}
+			if tt.delivered {
+				out[0].Accept()
+			} else {
+				out[0].Reject()
+			}
+
+			// Undelivered cycles are cached again on the next metric
+			next := steamStats(map[string]string{"id": "2"}, "flows", int64(3), start)
+			if out := applyAll(p, next); len(out) != 0 {
+				t.Fatalf("got metrics after delivery: %v", out)
+			}
+
+			var retried int64
+			for _, m := range p.flushIncomplete() {
+				if device, _ := m.GetTag("id"); device == "1" {
+					samples, _ := m.GetField("samples")
+					retried, _ = samples.(int64)
+				}
+				m.Accept()
+			}
+			if retried != tt.retried {
+				t.Errorf("retried %d metrics of the cycle, want %d", retried, tt.retried)
+			}
+		})
+	}
+}
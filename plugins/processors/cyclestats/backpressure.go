@@ -0,0 +1,146 @@
+package cyclestats
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Policies for new groups when the cache holds max_groups groups.
+const (
+	fullDropNew     = "drop_new"
+	fullDropOldest  = "drop_oldest"
+	fullFlushOldest = "flush_oldest"
+)
+
+func validateFullPolicy(policy string) error {
+	switch policy {
+	case fullDropNew, fullDropOldest, fullFlushOldest:
+		return nil
+	}
+	return fmt.Errorf("invalid full_policy %q", policy)
+}
+
+// makeRoom makes room for a new group when the cache is full according to
+// the full policy. It returns false if the metric of the new group is to be
+// dropped instead.
+func (t *CycleStats) makeRoom(m telegraf.Metric) bool {
+	if t.MaxGroups <= 0 || len(t.cache) < t.MaxGroups {
+		return true
+	}
+	t.countFull()
+
+	if t.FullPolicy == fullDropNew {
+		t.Log.Warnf("Cache full with %d groups, dropping metric of %q", len(t.cache), m.Name())
+		t.releaseSources([]telegraf.Metric{m}, false)
+		t.reportProblem(problemEviction)
+		return false
+	}
+
+	// The oldest group is the one with the earliest window, among the groups
+	// of the lowest field group priority so that compliance-critical fields
+	// are retained longest
+	var oldest string
+	var lowest int
+	for groupkey, ms := range t.cache {
+		priority := t.metricsPriority(ms)
+		if oldest == "" || priority < lowest ||
+			priority == lowest && ms[0].Time().Before(t.cache[oldest][0].Time()) {
+			oldest = groupkey
+			lowest = priority
+		}
+	}
+	ms := t.cache[oldest]
+
+	if t.FullPolicy == fullFlushOldest {
+		t.Log.Warnf("Cache full with %d groups, flushing the oldest group incomplete", len(t.cache))
+		t.warnIncomplete(oldest, flushEviction)
+		ms[0].AddTag("incomplete", "true")
+		t.carry = append(t.carry, t.flushGroup(oldest, ms)...)
+		t.carry = append(t.carry, t.emitJoined()...)
+		return true
+	}
+
+	t.Log.Warnf("Cache full with %d groups, dropping the oldest group", len(t.cache))
+	t.releaseSources(ms, false)
+	delete(t.cache, oldest)
+	delete(t.keys, oldest)
+	delete(t.updated, oldest)
+	delete(t.running, oldest)
+	delete(t.sharedSynced, oldest)
+	t.reportProblem(problemEviction)
+	return true
+}
+
+// Policies for metrics of a group holding max_samples_per_group metrics.
+const (
+	capMerge = "merge"
+	capFlush = "flush"
+)
+
+func validateSamplesPolicy(policy string) error {
+	switch policy {
+	case capMerge, capFlush:
+		return nil
+	}
+	return fmt.Errorf("invalid samples_policy %q", policy)
+}
+
+// capGroup applies max_samples_per_group to a group about to receive a
+// metric and reports whether the metric is still to be added to it. With
+// the merge policy the metric's fields overwrite those of the group's last
+// metric, so the group keeps the last values but no further samples. With
+// the flush policy the group is flushed and the metric starts a new one.
+func (t *CycleStats) capGroup(groupkey string, m telegraf.Metric) bool {
+	ms := t.cache[groupkey]
+	if t.MaxSamplesPerGroup <= 0 || len(ms) < t.MaxSamplesPerGroup {
+		return true
+	}
+	t.countCapped()
+
+	if t.SamplesPolicy == capFlush {
+		t.Log.Warnf("Group %q holds %d metrics, flushing it", groupkey, len(ms))
+		if !t.isComplete(groupkey) {
+			t.warnIncomplete(groupkey, flushOverflow)
+			ms[0].AddTag("incomplete", "true")
+		}
+		t.carry = append(t.carry, t.flushGroup(groupkey, ms)...)
+		t.carry = append(t.carry, t.emitJoined()...)
+		return true
+	}
+
+	// Running statistics still cover the merged metrics, the sampled ones
+	// only the cached metrics, which the capped tag tells
+	t.accumulate(groupkey, m)
+	ms[0].AddTag("capped", "true")
+	last := ms[len(ms)-1]
+	for _, field := range m.FieldList() {
+		last.AddField(field.Key, field.Value)
+	}
+	if m.Time().After(last.Time()) {
+		last.SetTime(m.Time())
+	}
+	t.releaseSources([]telegraf.Metric{m}, true)
+	t.reportProblem(problemMemoryPressure)
+	return false
+}
+
+// countCapped counts the metrics arriving for groups holding
+// max_samples_per_group metrics in the internal_cyclestats samples_capped
+// field, per policy.
+func (t *CycleStats) countCapped() {
+	if t.samplesCapped == nil {
+		t.samplesCapped = selfstat.Register("cyclestats", "samples_capped", map[string]string{"policy": t.SamplesPolicy})
+	}
+	t.samplesCapped.Incr(1)
+}
+
+// countFull counts the times the cache was full in the internal_cyclestats
+// cache_full field, per policy.
+func (t *CycleStats) countFull() {
+	if t.cacheFull == nil {
+		t.cacheFull = selfstat.Register("cyclestats", "cache_full", map[string]string{"policy": t.FullPolicy})
+	}
+	t.cacheFull.Incr(1)
+}
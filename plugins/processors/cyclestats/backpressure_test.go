@@ -0,0 +1,123 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedDevices returns the devices of the cached groups, sorted.
+func cachedDevices(p *CycleStats) string {
+	devices := make([]string, 0, len(p.cache))
+	for _, ms := range p.cache {
+		devices = append(devices, p.deviceID(ms[0]))
+	}
+	sort.Strings(devices)
+	return strings.Join(devices, ",")
+}
+
+func TestMaxGroups(t *testing.T) {
+	tests := []struct {
+		policy  string
+		flushed string
+		cached  string
+	}{
+		{policy: "drop_new", cached: "1,2"},
+		{policy: "drop_oldest", cached: "2,3"},
+		{policy: "flush_oldest", flushed: "1", cached: "2,3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.MaxGroups = 2
+				p.FullPolicy = tt.policy
+				p.DropOriginal = true
+			})
+			p.Log = &warnings{}
+
+			start := time.Unix(1600000000, 0)
+			out := applyAll(p,
+				steamStats(nil, "flows", int64(1), start),
+				steamStats(map[string]string{"id": "2"}, "flows", int64(2), start.Add(time.Second)),
+				steamStats(map[string]string{"id": "3"}, "flows", int64(3), start.Add(2*time.Second)),
+			)
+
+			flushed := make([]string, 0, len(out))
+			for _, m := range out {
+				flushed = append(flushed, p.deviceID(m))
+				if value, _ := m.GetTag("incomplete"); value != "true" {
+					t.Errorf("evicted group of device %q not tagged incomplete", p.deviceID(m))
+				}
+			}
+			if got := strings.Join(flushed, ","); got != tt.flushed {
+				t.Errorf("flushed the groups of devices %q, want %q", got, tt.flushed)
+			}
+			if got := cachedDevices(p); got != tt.cached {
+				t.Errorf("cached the groups of devices %q, want %q", got, tt.cached)
+			}
+		})
+	}
+
+	if err := validateFullPolicy("block"); err == nil {
+		t.Errorf("invalid full_policy \"block\" accepted")
+	}
+}
+
+func TestMaxSamplesPerGroup(t *testing.T) {
+	tests := []struct {
+		policy  string
+		flushed []int64
+		cached  int
+		last    int64
+	}{
+		{policy: "merge", cached: 3, last: 5},
+		{policy: "flush", flushed: []int64{3}, cached: 2, last: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.MaxSamplesPerGroup = 3
+				p.SamplesPolicy = tt.policy
+				p.DropOriginal = true
+				p.SampleCounts = true
+			})
+			p.Log = &warnings{}
+
+			start := time.Unix(1600000000, 0)
+			var flushed []int64
+			for i := int64(1); i <= 5; i++ {
+				for _, m := range applyAll(p, steamStats(nil, "flows", i, start)) {
+					samples, _ := m.GetField("samples")
+					flushed = append(flushed, samples.(int64))
+					if value, _ := m.GetTag("incomplete"); value != "true" {
+						t.Errorf("group flushed when full not tagged incomplete")
+					}
+				}
+			}
+			if fmt.Sprint(flushed) != fmt.Sprint(tt.flushed) {
+				t.Errorf("flushed groups of %v metrics, want %v", flushed, tt.flushed)
+			}
+
+			if len(p.cache) != 1 {
+				t.Fatalf("got %d groups, want 1", len(p.cache))
+			}
+			for _, ms := range p.cache {
+				if len(ms) != tt.cached {
+					t.Errorf("cached %d metrics, want %d", len(ms), tt.cached)
+				}
+				if last, _ := ms[len(ms)-1].GetField("flows"); last != tt.last {
+					t.Errorf("last flows %v, want %d", last, tt.last)
+				}
+				if capped := ms[0].HasTag("capped"); capped != (tt.policy == "merge") {
+					t.Errorf("group tagged capped %v", capped)
+				}
+			}
+		})
+	}
+
+	if err := validateSamplesPolicy("drop"); err == nil {
+		t.Errorf("invalid samples_policy \"drop\" accepted")
+	}
+}
@@ -0,0 +1,193 @@
+package cyclestats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// fieldBaseline is the running distribution of a field, updated with
+// Welford's algorithm.
+type fieldBaseline struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+
+	// Control limits are only filled in on export
+	Lower float64 `json:"lower_limit"`
+	Upper float64 `json:"upper_limit"`
+}
+
+func (b *fieldBaseline) add(v float64) {
+	b.Count++
+	delta := v - b.Mean
+	b.Mean += delta / float64(b.Count)
+	b.M2 += delta * (v - b.Mean)
+}
+
+func (b *fieldBaseline) stddev() float64 {
+	if b.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(b.M2 / float64(b.Count-1))
+}
+
+// baselineModel is the learned model shared between agents.
+type baselineModel struct {
+	// Baselines holds the distribution per measurement and field
+	Baselines map[string]map[string]*fieldBaseline `json:"baselines"`
+
+	// mu guards the model shared between shards
+	mu sync.Mutex
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func newBaselineModel() *baselineModel {
+	return &baselineModel{
+		Baselines: make(map[string]map[string]*fieldBaseline),
+	}
+}
+
+// learnBaselines adds the numeric fields of a flushed aggregate to the
+// baselines of its measurement.
+func (t *CycleStats) learnBaselines(aggregate telegraf.Metric) {
+	if t.BaselineExport == "" && t.BaselineImport == "" {
+		return
+	}
+
+	t.model.mu.Lock()
+	defer t.model.mu.Unlock()
+
+	baselines, ok := t.model.Baselines[aggregate.Name()]
+	if !ok {
+		baselines = make(map[string]*fieldBaseline)
+		t.model.Baselines[aggregate.Name()] = baselines
+	}
+
+	for _, field := range aggregate.FieldList() {
+		v, ok := toFloat(field.Value)
+		if !ok {
+			continue
+		}
+		if _, ok := baselines[field.Key]; !ok {
+			baselines[field.Key] = &fieldBaseline{}
+		}
+		baselines[field.Key].add(v)
+	}
+}
+
+// watchBaselines exports the model every BaselineExportInterval until Stop
+// is called. Exporting off the metric path keeps a slow export location from
+// stalling Apply.
+func (t *CycleStats) watchBaselines() {
+	defer t.model.done.Done()
+
+	ticker := time.NewTicker(time.Duration(t.BaselineExportInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.model.stop:
+			return
+		case <-ticker.C:
+			t.exportBaselines()
+		}
+	}
+}
+
+// exportBaselines writes the model with its control limits to
+// BaselineExport. The model is only locked while it is encoded.
+func (t *CycleStats) exportBaselines() {
+	t.model.mu.Lock()
+	for _, baselines := range t.model.Baselines {
+		for _, b := range baselines {
+			width := t.ControlLimitSigma * b.stddev()
+			b.Lower = b.Mean - width
+			b.Upper = b.Mean + width
+		}
+	}
+
+	b, err := json.Marshal(t.model)
+	t.model.mu.Unlock()
+	if err != nil {
+		t.Log.Errorf("Could not encode baselines: %v", err)
+		return
+	}
+	if err := writeLocation(t.BaselineExport, b); err != nil {
+		t.Log.Errorf("Could not export baselines: %v", err)
+		t.reportProblem(problemStatePersistence)
+	}
+}
+
+// importBaselines seeds the model with baselines exported by another agent.
+func (t *CycleStats) importBaselines() error {
+	b, err := readLocation(t.BaselineImport)
+	if err != nil {
+		return err
+	}
+
+	model := newBaselineModel()
+	if err := json.Unmarshal(b, model); err != nil {
+		return err
+	}
+	t.model = model
+	return nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// readLocation reads the contents of a file or http(s) URL.
+func readLocation(location string) ([]byte, error) {
+	if !isURL(location) {
+		return os.ReadFile(location)
+	}
+
+	resp, err := httpClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// writeLocation replaces a file or PUTs to an http(s) URL.
+func writeLocation(location string, b []byte) error {
+	if !isURL(location) {
+		return writeFileAtomic(location, b, 0644)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, location, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", location, resp.Status)
+	}
+	return nil
+}
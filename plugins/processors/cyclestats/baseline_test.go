@@ -0,0 +1,98 @@
+package cyclestats
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+// baselineStore serves the last baselines PUT to it.
+type baselineStore struct {
+	mu   sync.Mutex
+	body []byte
+}
+
+func (s *baselineStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.body, _ = io.ReadAll(r.Body)
+	case http.MethodGet:
+		w.Write(s.body)
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	server := httptest.NewServer(&baselineStore{})
+	defer server.Close()
+
+	for _, location := range []string{
+		filepath.Join(t.TempDir(), "baselines.json"),
+		server.URL + "/baselines.json",
+	} {
+		t.Run(location, func(t *testing.T) {
+			exporter := newTestProcessor(t, func(p *CycleStats) {
+				p.BaselineExport = location
+				p.ControlLimitSigma = 2
+			})
+			for i, temp := range []float64{120, 121, 122, 123} {
+				exporter.learnBaselines(metric.New("steam_params", map[string]string{"id": "1"},
+					map[string]interface{}{"cook_temp": temp, "door": "closed"}, time.Unix(1600000000+int64(i), 0)))
+			}
+			exporter.exportBaselines()
+
+			importer := newTestProcessor(t, func(p *CycleStats) {
+				p.BaselineImport = location
+			})
+			b, ok := importer.model.Baselines["steam_params"]["cook_temp"]
+			if !ok {
+				t.Fatalf("cook_temp baseline not imported: %v", importer.model.Baselines)
+			}
+			if _, ok := importer.model.Baselines["steam_params"]["door"]; ok {
+				t.Errorf("baseline of a string field imported")
+			}
+			if b.Count != 4 || b.Mean != 121.5 {
+				t.Errorf("imported %d values with mean %v, want 4 with mean 121.5", b.Count, b.Mean)
+			}
+			width := 2 * math.Sqrt(5.0/3)
+			if math.Abs(b.Lower-(121.5-width)) > 1e-9 || math.Abs(b.Upper-(121.5+width)) > 1e-9 {
+				t.Errorf("imported control limits [%v, %v], want [%v, %v]", b.Lower, b.Upper, 121.5-width, 121.5+width)
+			}
+		})
+	}
+}
+
+func TestBaselineExportReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baselines.json")
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.BaselineExport = path
+	})
+	p.exportBaselines()
+
+	// Nothing but the export is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files next to the export, want none", len(entries)-1)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("export not readable by other agents: %v %v", info, err)
+	}
+}
@@ -0,0 +1,48 @@
+package cyclestats
+
+import (
+	"sort"
+
+	"github.com/influxdata/telegraf"
+)
+
+// limitBatch returns the aggregates carried over from previous flushes, or
+// flushed outside of them, followed by aggs, up to MaxPushBatch of them, and
+// carries the rest over to the next call, so flushing many groups at once
+// does not overwhelm the outputs. Aggregates with fields of a higher field
+// group priority go first when not all of them fit.
+func (t *CycleStats) limitBatch(aggs []telegraf.Metric) []telegraf.Metric {
+	if t.MaxPushBatch <= 0 {
+		return append(t.takeCarried(), aggs...)
+	}
+
+	t.carry = append(t.carry, aggs...)
+	if len(t.carry) <= t.MaxPushBatch {
+		batch := t.carry
+		t.carry = nil
+		return batch
+	}
+
+	if len(t.FieldGroups) > 0 {
+		priorities := make(map[telegraf.Metric]int, len(t.carry))
+		for _, m := range t.carry {
+			priorities[m] = t.metricsPriority([]telegraf.Metric{m})
+		}
+		sort.SliceStable(t.carry, func(i, j int) bool {
+			return priorities[t.carry[i]] > priorities[t.carry[j]]
+		})
+	}
+
+	batch := t.carry[:t.MaxPushBatch:t.MaxPushBatch]
+	t.carry = append([]telegraf.Metric(nil), t.carry[t.MaxPushBatch:]...)
+	t.Log.Debugf("Carrying %d aggregates over to the next flush", len(t.carry))
+	return batch
+}
+
+// takeCarried returns all aggregates carried over, when nothing may be left
+// behind.
+func (t *CycleStats) takeCarried() []telegraf.Metric {
+	carry := t.carry
+	t.carry = nil
+	return carry
+}
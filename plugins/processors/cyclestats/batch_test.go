@@ -0,0 +1,61 @@
+package cyclestats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func TestLimitBatch(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		// batches holds the flows of the aggregates returned by a flush of
+		// five aggregates, followed by two empty flushes
+		batches []string
+	}{
+		{name: "unlimited", max: 0, batches: []string{"[1 2 3 4 5]", "[]", "[]"}},
+		{name: "within limit", max: 5, batches: []string{"[1 2 3 4 5]", "[]", "[]"}},
+		{name: "carried over", max: 2, batches: []string{"[1 2]", "[3 4]", "[5]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.MaxPushBatch = tt.max
+			})
+
+			start := time.Unix(1600000000, 0)
+			aggs := make([]telegraf.Metric, 0, 5)
+			for i := int64(1); i <= 5; i++ {
+				aggs = append(aggs, steamStats(nil, "flows", i, start))
+			}
+
+			got := []string{flowsOfCycles(p.limitBatch(aggs))}
+			got = append(got, flowsOfCycles(p.limitBatch(nil)), flowsOfCycles(p.limitBatch(nil)))
+			if fmt.Sprint(got) != fmt.Sprint(tt.batches) {
+				t.Errorf("batches %v, want %v", got, tt.batches)
+			}
+		})
+	}
+}
+
+func TestTakeCarried(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.MaxPushBatch = 1
+	})
+
+	start := time.Unix(1600000000, 0)
+	p.limitBatch([]telegraf.Metric{
+		steamStats(nil, "flows", int64(1), start),
+		steamStats(nil, "flows", int64(2), start),
+		steamStats(nil, "flows", int64(3), start),
+	})
+	if got := flowsOfCycles(p.takeCarried()); got != "[2 3]" {
+		t.Errorf("took carried flows %s, want [2 3]", got)
+	}
+	if len(p.carry) != 0 {
+		t.Errorf("aggregates left carried over: %v", p.carry)
+	}
+}
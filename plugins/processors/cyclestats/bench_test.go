@@ -0,0 +1,218 @@
+package cyclestats
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/TylerHorn/cyclestats/plugins/processors/cyclestats/testutil"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/models"
+)
+
+// benchMetrics returns the metrics of steam and grind cycles of the given
+// number of devices, interleaved the way a gateway reports them.
+func benchMetrics(devices, cycles int) []telegraf.Metric {
+	g := testutil.NewGenerator(1)
+	start := time.Unix(1600000000, 0)
+
+	perDevice := make([][]telegraf.Metric, devices)
+	for d := range perDevice {
+		device := fmt.Sprint(d)
+		perDevice[d] = append(
+			g.Cycles(device, start, cycles, time.Minute, g.SteamCycle),
+			g.Cycles(device, start.Add(30*time.Second), cycles, time.Minute, g.GrindCycle)...,
+		)
+	}
+
+	out := make([]telegraf.Metric, 0)
+	for i := 0; ; i++ {
+		added := false
+		for _, ms := range perDevice {
+			if i < len(ms) {
+				out = append(out, ms[i])
+				added = true
+			}
+		}
+		if !added {
+			return out
+		}
+	}
+}
+
+// copyMetrics returns fresh copies of metrics, as processing consumes them.
+func copyMetrics(metrics []telegraf.Metric) []telegraf.Metric {
+	out := make([]telegraf.Metric, len(metrics))
+	for i, m := range metrics {
+		out[i] = m.Copy()
+	}
+	return out
+}
+
+func newBenchProcessor(b *testing.B, configure func(p *CycleStats)) *CycleStats {
+	b.Helper()
+
+	// The processor logs on every Init and flush
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	p := New()
+	p.Log = models.NewLogger("processors", "cyclestats", "")
+	if configure != nil {
+		configure(p)
+	}
+	if err := p.Init(); err != nil {
+		b.Fatal(err)
+	}
+	return p
+}
+
+func BenchmarkApply(b *testing.B) {
+	metrics := benchMetrics(10, 10)
+	p := newBenchProcessor(b, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		in := copyMetrics(metrics)
+		b.StartTimer()
+		for _, m := range in {
+			p.Apply(m)
+		}
+	}
+}
+
+func BenchmarkGroupKey(b *testing.B) {
+	metrics := benchMetrics(10, 10)
+	p := newBenchProcessor(b, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range metrics {
+			_ = p.generateGroupByKey(m)
+		}
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	metrics := benchMetrics(10, 10)
+	p := newBenchProcessor(b, nil)
+	if err := p.Start(discard{}); err != nil {
+		b.Fatal(err)
+	}
+	defer p.Stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		in := copyMetrics(metrics)
+		b.StartTimer()
+		for _, m := range in {
+			if err := p.Add(m, discard{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkAddSharded processes the metrics of many devices through a
+// growing number of shards, draining them at the end of each operation.
+// Shards only pay off with as many cores, compare with e.g. -cpu 1,4,8.
+func BenchmarkAddSharded(b *testing.B) {
+	metrics := benchMetrics(64, 5)
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				p := newBenchProcessor(b, func(p *CycleStats) {
+					p.Shards = shards
+				})
+				in := copyMetrics(metrics)
+				if err := p.Start(discard{}); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				for _, m := range in {
+					if err := p.Add(m, discard{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := p.Stop(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPush(b *testing.B) {
+	metrics := benchMetrics(10, 10)
+	p := newBenchProcessor(b, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for _, m := range copyMetrics(metrics) {
+			p.groupBy(m)
+		}
+		b.StartTimer()
+		p.push(nil)
+	}
+}
+
+func BenchmarkAggregate(b *testing.B) {
+	metrics := benchMetrics(10, 10)
+	p := newBenchProcessor(b, nil)
+	for _, m := range copyMetrics(metrics) {
+		p.groupBy(m)
+	}
+	groups := make([][]telegraf.Metric, 0, len(p.cache))
+	for _, ms := range p.cache {
+		groups = append(groups, ms)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, ms := range groups {
+			if _, err := p.Aggregate(ms); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// discard is an accumulator dropping everything added to it.
+type discard struct{}
+
+func (discard) AddFields(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddGauge(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddCounter(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddSummary(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddHistogram(string, map[string]interface{}, map[string]string, ...time.Time) {}
+
+func (discard) AddMetric(m telegraf.Metric) {
+	m.Drop()
+}
+
+func (discard) SetPrecision(time.Duration) {}
+
+func (discard) AddError(error) {}
+
+func (discard) WithTracking(int) telegraf.TrackingAccumulator {
+	return nil
+}
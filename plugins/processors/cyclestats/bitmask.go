@@ -0,0 +1,55 @@
+package cyclestats
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf"
+)
+
+func validateBitmasks(bitmasks map[string][]string) error {
+	for field, bits := range bitmasks {
+		if len(bits) > 64 {
+			return fmt.Errorf("bitmask of %q has %d bits, at most 64 are supported", field, len(bits))
+		}
+	}
+	return nil
+}
+
+// decodeBitmasks expands the packed status fields of the bitmask table into
+// a boolean field per bit, named by the bit's position in the table, before
+// the metric is aggregated. Bits without a name are skipped.
+func (t *CycleStats) decodeBitmasks(m telegraf.Metric) {
+	for field, bits := range t.Bitmasks {
+		value, ok := m.GetField(field)
+		if !ok {
+			continue
+		}
+		mask, ok := bitmaskOf(value)
+		if !ok {
+			continue
+		}
+		for i, name := range bits {
+			if name == "" {
+				continue
+			}
+			m.AddField(name, mask&(1<<uint(i)) != 0)
+		}
+	}
+}
+
+// bitmaskOf returns the bits of a packed status field. Integers keep all
+// their bits, with a negative int64 taken as its two's complement, while
+// floats only convert exactly up to 2^53.
+func bitmaskOf(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	v, ok := toFloat(value)
+	if !ok || v < 0 {
+		return 0, false
+	}
+	return uint64(v), true
+}
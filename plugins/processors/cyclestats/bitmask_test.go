@@ -0,0 +1,77 @@
+package cyclestats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestDecodeBitmasks(t *testing.T) {
+	bits := []string{"door_open", "", "heater_on", "alarm"}
+	tests := []struct {
+		name   string
+		status interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "integer",
+			status: int64(0b1101),
+			want:   map[string]interface{}{"door_open": true, "heater_on": true, "alarm": true},
+		},
+		{
+			name:   "unsigned",
+			status: uint64(0b0100),
+			want:   map[string]interface{}{"door_open": false, "heater_on": true, "alarm": false},
+		},
+		{
+			name:   "float",
+			status: 9.0,
+			want:   map[string]interface{}{"door_open": true, "heater_on": false, "alarm": true},
+		},
+		{
+			name:   "negative float",
+			status: -1.0,
+			want:   map[string]interface{}{},
+		},
+		{
+			name:   "string",
+			status: "0x1",
+			want:   map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) { p.Bitmasks = map[string][]string{"status": bits} })
+
+			m := metric.New("system_status", nil, map[string]interface{}{"status": tt.status}, time.Unix(1600000000, 0))
+			p.decodeBitmasks(m)
+			want := map[string]interface{}{"status": tt.status}
+			for k, v := range tt.want {
+				want[k] = v
+			}
+			if !reflect.DeepEqual(m.Fields(), want) {
+				t.Errorf("got fields %v, want %v", m.Fields(), want)
+			}
+		})
+	}
+}
+
+func TestBitmaskHighBits(t *testing.T) {
+	bits := make([]string, 64)
+	bits[63] = "fault"
+	p := newTestProcessor(t, func(p *CycleStats) { p.Bitmasks = map[string][]string{"status": bits} })
+
+	// The sign bit of an int64 is its highest bit
+	m := metric.New("system_status", nil, map[string]interface{}{"status": int64(-1 << 63)}, time.Unix(1600000000, 0))
+	p.decodeBitmasks(m)
+	if fault, _ := m.GetField("fault"); fault != true {
+		t.Errorf("fault %v, want true", fault)
+	}
+
+	if err := validateBitmasks(map[string][]string{"status": strings.Split(strings.Repeat(",", 64), ",")}); err == nil {
+		t.Errorf("bitmask of 65 bits accepted")
+	}
+}
@@ -0,0 +1,119 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// baselineCapture records the golden profile of the first successful cycles
+// per measurement.
+type baselineCapture struct {
+	model *baselineModel
+	// captured holds the number of cycles recorded per measurement
+	captured map[string]int
+	// mu guards the capture shared between shards
+	mu sync.Mutex
+}
+
+func newBaselineCapture() *baselineCapture {
+	return &baselineCapture{
+		model:    newBaselineModel(),
+		captured: make(map[string]int),
+	}
+}
+
+func validateCapture(capture bool, cycles int, goldenProfile string) error {
+	if !capture {
+		return nil
+	}
+	if goldenProfile == "" {
+		return fmt.Errorf("capture_baseline requires a golden_profile to write")
+	}
+	if cycles <= 0 {
+		return fmt.Errorf("capture_cycles must be positive")
+	}
+	return nil
+}
+
+// successful reports whether a cycle completed without failure: it was not
+// flushed incomplete and, if classified, got the success result.
+func (t *CycleStats) successful(aggregate telegraf.Metric) bool {
+	if aggregate.HasTag("incomplete") {
+		return false
+	}
+	result, ok := aggregate.GetTag(cycleResultTag)
+	return !ok || result == t.SuccessResult
+}
+
+// captureBaseline adds the numeric fields of a successful cycle to the
+// captured profile of its measurement, until capture_cycles cycles of it are
+// recorded. The profile of the measurements captured completely is then
+// written to golden_profile, in the format the scorer reads.
+func (t *CycleStats) captureBaseline(aggregate telegraf.Metric) {
+	if !t.CaptureBaseline || !t.successful(aggregate) {
+		return
+	}
+
+	c := t.capture
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := aggregate.Name()
+	if c.captured[name] >= t.CaptureCycles {
+		return
+	}
+
+	baselines, ok := c.model.Baselines[name]
+	if !ok {
+		baselines = make(map[string]*fieldBaseline)
+		c.model.Baselines[name] = baselines
+	}
+	for _, field := range aggregate.FieldList() {
+		v, ok := toFloat(field.Value)
+		if !ok {
+			continue
+		}
+		if _, ok := baselines[field.Key]; !ok {
+			baselines[field.Key] = &fieldBaseline{}
+		}
+		baselines[field.Key].add(v)
+	}
+
+	c.captured[name]++
+	if c.captured[name] < t.CaptureCycles {
+		return
+	}
+	if err := t.writeCapture(); err != nil {
+		t.Log.Errorf("Could not write golden profile: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return
+	}
+	t.Log.Infof("Captured the baseline of %q over %d cycles", name, t.CaptureCycles)
+}
+
+// writeCapture writes the profile of the completely captured measurements,
+// with control limits, to golden_profile.
+func (t *CycleStats) writeCapture() error {
+	c := t.capture
+	profile := newBaselineModel()
+	for name, baselines := range c.model.Baselines {
+		if c.captured[name] < t.CaptureCycles {
+			continue
+		}
+		for _, b := range baselines {
+			width := t.ControlLimitSigma * b.stddev()
+			b.Lower = b.Mean - width
+			b.Upper = b.Mean + width
+		}
+		profile.Baselines[name] = baselines
+	}
+
+	b, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return writeLocation(t.GoldenProfile, b)
+}
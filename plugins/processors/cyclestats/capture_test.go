@@ -0,0 +1,91 @@
+package cyclestats
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestCaptureBaseline(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "golden.json")
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.CaptureBaseline = true
+		p.CaptureCycles = 3
+		p.GoldenProfile = profile
+	})
+
+	start := time.Unix(1600000000, 0)
+	cycles := []struct {
+		measurement string
+		tags        map[string]string
+		flows       int64
+	}{
+		{measurement: "steam_stats", flows: 10},
+		// Failed cycles are not part of the profile
+		{measurement: "steam_stats", tags: map[string]string{"incomplete": "true"}, flows: 100},
+		{measurement: "steam_stats", tags: map[string]string{"cycle_result": "pd_timeout"}, flows: 100},
+		{measurement: "grinder", flows: 1},
+		{measurement: "steam_stats", tags: map[string]string{"cycle_result": "success"}, flows: 12},
+		{measurement: "steam_stats", flows: 14},
+		// Cycles beyond capture_cycles are not either
+		{measurement: "steam_stats", flows: 100},
+	}
+	for i, c := range cycles {
+		tags := map[string]string{"id": "1"}
+		for k, v := range c.tags {
+			tags[k] = v
+		}
+		aggregate := metric.New(c.measurement, tags, map[string]interface{}{"flows": c.flows, "door": "closed"}, start.Add(time.Duration(i)*time.Minute))
+		p.captureBaseline(aggregate)
+
+		if _, err := os.Stat(profile); (err == nil) != (i >= 5) {
+			t.Fatalf("cycle %d: golden profile written %v", i, err == nil)
+		}
+	}
+
+	golden, err := loadGoldenProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := golden["grinder"]; ok {
+		t.Errorf("profile of grinder written before capture_cycles cycles")
+	}
+	if _, ok := golden["steam_stats"]["door"]; ok {
+		t.Errorf("profile of the non-numeric field door written")
+	}
+	flows, ok := golden["steam_stats"]["flows"]
+	if !ok {
+		t.Fatalf("profile of steam_stats without flows: %v", golden)
+	}
+	if flows.Count != 3 || flows.Mean != 12 || flows.stddev() != 2 {
+		t.Errorf("flows profile of %d cycles with mean %v and stddev %v, want 3 cycles with mean 12 and stddev 2",
+			flows.Count, flows.Mean, flows.stddev())
+	}
+	if math.Abs(flows.Lower-6) > 1e-9 || math.Abs(flows.Upper-18) > 1e-9 {
+		t.Errorf("flows control limits %v to %v, want 6 to 18", flows.Lower, flows.Upper)
+	}
+}
+
+func TestValidateCapture(t *testing.T) {
+	tests := []struct {
+		capture bool
+		cycles  int
+		profile string
+		ok      bool
+	}{
+		{capture: false, ok: true},
+		{capture: true, cycles: 50, profile: "golden.json", ok: true},
+		{capture: true, cycles: 50, ok: false},
+		{capture: true, cycles: 0, profile: "golden.json", ok: false},
+	}
+	for _, tt := range tests {
+		err := validateCapture(tt.capture, tt.cycles, tt.profile)
+		if (err == nil) != tt.ok {
+			t.Errorf("capture %v of %d cycles to %q: got error %v, want ok %v", tt.capture, tt.cycles, tt.profile, err, tt.ok)
+		}
+	}
+}
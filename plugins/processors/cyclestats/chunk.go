@@ -0,0 +1,77 @@
+package cyclestats
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// lineOverhead approximates the bytes of a line protocol line besides the
+// measurement, tags and fields, i.e. separators and the timestamp.
+const lineOverhead = 22
+
+// chunk splits an aggregate exceeding chunk_max_fields or chunk_max_bytes
+// into parts. Each part carries a "part" tag with its index and the shared
+// "cycle_key" and number of "parts" as fields.
+func (t *CycleStats) chunk(aggregate telegraf.Metric, groupkey string) []telegraf.Metric {
+	if t.ChunkMaxFields <= 0 && t.ChunkMaxBytes <= 0 {
+		return []telegraf.Metric{aggregate}
+	}
+
+	base := baseSize(aggregate)
+	// Leave room for the fields and tag added to each part
+	reserved := len(",part=") + 4 + len(",cycle_key=\"\"") + 16 + len(",parts=i") + 4
+
+	parts := make([][]*telegraf.Field, 0)
+	var current []*telegraf.Field
+	size := base + reserved
+	for _, field := range aggregate.FieldList() {
+		fs := fieldSize(field)
+		full := t.ChunkMaxFields > 0 && len(current)+3 > t.ChunkMaxFields ||
+			t.ChunkMaxBytes > 0 && size+fs > t.ChunkMaxBytes
+		if full && len(current) > 0 {
+			parts = append(parts, current)
+			current = nil
+			size = base + reserved
+		}
+		current = append(current, field)
+		size += fs
+	}
+	if len(current) > 0 {
+		parts = append(parts, current)
+	}
+
+	// Leave aggregates fitting the limits untouched, only the parts of a
+	// split aggregate need the extra fields
+	if len(parts) <= 1 {
+		return []telegraf.Metric{aggregate}
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(groupkey))
+	key := strconv.FormatUint(h.Sum64(), 16)
+
+	chunks := make([]telegraf.Metric, 0, len(parts))
+	for i, fields := range parts {
+		// Copying keeps delivery tracking intact, the aggregate counts as
+		// delivered once all of its parts are
+		c := aggregate.Copy()
+		keep := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			keep[field.Key] = true
+		}
+		for _, field := range aggregate.FieldList() {
+			if !keep[field.Key] {
+				c.RemoveField(field.Key)
+			}
+		}
+		c.AddTag("part", strconv.Itoa(i))
+		c.AddField("cycle_key", key)
+		c.AddField("parts", int64(len(parts)))
+		chunks = append(chunks, c)
+	}
+	aggregate.Drop()
+
+	return chunks
+}
@@ -0,0 +1,101 @@
+package cyclestats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *CycleStats)
+		fields    int
+		parts     int
+	}{
+		{
+			name:      "no limits",
+			configure: func(*CycleStats) {},
+			fields:    20,
+			parts:     1,
+		},
+		{
+			name:      "fits max_fields",
+			configure: func(p *CycleStats) { p.ChunkMaxFields = 10 },
+			fields:    7,
+			parts:     1,
+		},
+		{
+			// Each part holds 7 fields of the aggregate besides cycle_key
+			// and parts
+			name:      "over max_fields",
+			configure: func(p *CycleStats) { p.ChunkMaxFields = 9 },
+			fields:    20,
+			parts:     3,
+		},
+		{
+			name:      "over max_bytes",
+			configure: func(p *CycleStats) { p.ChunkMaxBytes = 200 },
+			fields:    20,
+			parts:     3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, tt.configure)
+
+			fields := make(map[string]interface{}, tt.fields)
+			for i := 0; i < tt.fields; i++ {
+				fields[fmt.Sprintf("temp_%02d", i)] = 120.5
+			}
+			aggregate := metric.New("steam", map[string]string{"id": "1"}, fields, time.Unix(1600000000, 0))
+			chunks := p.chunk(aggregate, "groupkey")
+			if len(chunks) != tt.parts {
+				t.Fatalf("got %d parts, want %d", len(chunks), tt.parts)
+			}
+			if tt.parts == 1 {
+				if chunks[0] != aggregate || aggregate.HasField("cycle_key") {
+					t.Errorf("aggregate within the limits changed: %v", chunks[0])
+				}
+				return
+			}
+
+			// The parts together hold every field once and share the key
+			seen := make(map[string]bool)
+			key, _ := chunks[0].GetField("cycle_key")
+			for i, c := range chunks {
+				if part, _ := c.GetTag("part"); part != fmt.Sprint(i) {
+					t.Errorf("part %d tagged %q", i, part)
+				}
+				if k, _ := c.GetField("cycle_key"); k != key {
+					t.Errorf("part %d has cycle_key %v, want %v", i, k, key)
+				}
+				if parts, _ := c.GetField("parts"); parts != int64(tt.parts) {
+					t.Errorf("part %d has parts %v, want %d", i, parts, tt.parts)
+				}
+				if p.ChunkMaxFields > 0 && len(c.FieldList()) > p.ChunkMaxFields {
+					t.Errorf("part %d has %d fields", i, len(c.FieldList()))
+				}
+				size := baseSize(c)
+				for _, field := range c.FieldList() {
+					size += fieldSize(field)
+					if field.Key == "cycle_key" || field.Key == "parts" {
+						continue
+					}
+					if seen[field.Key] {
+						t.Errorf("field %s in more than one part", field.Key)
+					}
+					seen[field.Key] = true
+				}
+				if p.ChunkMaxBytes > 0 && size > p.ChunkMaxBytes {
+					t.Errorf("part %d has %d bytes", i, size)
+				}
+			}
+			if len(seen) != tt.fields {
+				t.Errorf("parts hold %d fields, want %d", len(seen), tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package cyclestats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// columns holds the fields of a group gathered in a single pass over its
+// metrics: the last value of every field for the aggregate and all values of
+// the fields statistics are computed for.
+type columns struct {
+	// order holds the fields in the order they first appear in the group
+	order []string
+	last  []interface{}
+	// count holds the number of metrics each field appeared in
+	count   []int64
+	metrics int
+	// start and end are the times of the earliest and latest metric
+	start, end time.Time
+
+	values map[string][]sample
+}
+
+// gatherColumns gathers the columns of a group into buffers taken from the
+// pool, to be returned with releaseColumns once the aggregate is built.
+func (t *CycleStats) gatherColumns(ms []telegraf.Metric) *columns {
+	c := columnsPool.Get().(*columns).reset(len(ms))
+	for _, m := range ms {
+		if c.start.IsZero() || m.Time().Before(c.start) {
+			c.start = m.Time()
+		}
+		if m.Time().After(c.end) {
+			c.end = m.Time()
+		}
+		for _, field := range m.FieldList() {
+			col := c.column(field.Key)
+			if col < 0 {
+				col = len(c.order)
+				c.order = append(c.order, field.Key)
+				c.last = append(c.last, nil)
+				c.count = append(c.count, 0)
+			}
+			c.last[col] = field.Value
+			c.count[col]++
+
+			if !t.hasStats(field.Key) {
+				continue
+			}
+			if c.values == nil {
+				c.values = make(map[string][]sample)
+			}
+			v, numeric := toFloat(field.Value)
+			c.values[field.Key] = append(c.values[field.Key], sample{raw: field.Value, value: v, numeric: numeric, time: m.Time()})
+		}
+	}
+	return c
+}
+
+// reset empties the columns for a group of n metrics, keeping the buffers.
+func (c *columns) reset(n int) *columns {
+	*c = columns{
+		order:   c.order[:0],
+		last:    c.last[:0],
+		count:   c.count[:0],
+		metrics: n,
+		values:  c.values,
+	}
+	return c
+}
+
+// column returns the position of a field in order, or -1. Groups have few
+// distinct fields, so scanning them is cheaper than hashing every key.
+func (c *columns) column(field string) int {
+	for i, key := range c.order {
+		if key == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// samples returns the values of a field ordered by time.
+func (c *columns) samples(field string) []sample {
+	values := c.values[field]
+	sort.SliceStable(values, func(i, j int) bool { return values[i].time.Before(values[j].time) })
+	return values
+}
+
+// addSampleCounts adds the number of metrics merged into an aggregate as the
+// samples field and the number of values of each field as "<field>_n", to
+// judge how well a cycle summary is backed by data.
+func (t *CycleStats) addSampleCounts(aggregate telegraf.Metric, cols *columns) {
+	if !t.SampleCounts {
+		return
+	}
+	aggregate.AddField("samples", int64(cols.metrics))
+	for col, field := range cols.order {
+		aggregate.AddField(field+"_n", cols.count[col])
+	}
+}
+
+// addWindowBounds adds the times of the earliest and latest metric merged
+// into an aggregate as the window_start and window_end fields in unix
+// nanoseconds.
+func (t *CycleStats) addWindowBounds(aggregate telegraf.Metric, cols *columns) {
+	if !t.WindowBounds {
+		return
+	}
+	aggregate.AddField("window_start", cols.start.UnixNano())
+	aggregate.AddField("window_end", cols.end.UnixNano())
+}
@@ -0,0 +1,126 @@
+package cyclestats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func TestSampleCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts bool
+		want   map[string]interface{}
+	}{
+		{name: "disabled", counts: false},
+		{
+			name:   "enabled",
+			counts: true,
+			want: map[string]interface{}{
+				"samples":           int64(5),
+				"flows_n":           int64(2),
+				"error_n":           int64(1),
+				"pd_timeouts_n":     int64(1),
+				"stag_recoveries_n": int64(1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.SampleCounts = tt.counts
+				p.DropOriginal = true
+			})
+
+			start := time.Unix(1600000000, 0)
+			out := applyAll(p,
+				steamStats(nil, "flows", int64(1), start),
+				steamStats(nil, "flows", int64(2), start),
+				steamStats(nil, "error", int64(0), start),
+				steamStats(nil, "pd_timeouts", int64(0), start),
+				steamStats(nil, "stag_recoveries", int64(0), start),
+			)
+			if len(out) != 1 {
+				t.Fatalf("got %d metrics, want 1: %v", len(out), out)
+			}
+			for field, want := range tt.want {
+				if got, _ := out[0].GetField(field); got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+			if !tt.counts && (out[0].HasField("samples") || out[0].HasField("flows_n")) {
+				t.Errorf("sample counts added while disabled: %v", out[0].Fields())
+			}
+			if out[0].HasField("stop_cook_count_n") {
+				t.Errorf("sample count of a field not in the cycle added")
+			}
+		})
+	}
+}
+
+func TestWindowBounds(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.WindowBounds = true
+		p.DropOriginal = true
+	})
+
+	// Out of order within the window
+	start := time.Unix(1600000000, 0)
+	out := applyAll(p,
+		steamStats(nil, "flows", int64(1), start.Add(300*time.Millisecond)),
+		steamStats(nil, "stop_cook_count", int64(1), start.Add(900*time.Millisecond)),
+		steamStats(nil, "error", int64(0), start.Add(100*time.Millisecond)),
+		steamStats(nil, "pd_timeouts", int64(0), start.Add(500*time.Millisecond)),
+		steamStats(nil, "stag_recoveries", int64(0), start.Add(700*time.Millisecond)),
+	)
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics, want 1: %v", len(out), out)
+	}
+	for field, want := range map[string]int64{
+		"window_start": start.Add(100 * time.Millisecond).UnixNano(),
+		"window_end":   start.Add(900 * time.Millisecond).UnixNano(),
+	} {
+		if got, _ := out[0].GetField(field); got != want {
+			t.Errorf("%s = %v, want %v", field, got, want)
+		}
+	}
+}
+
+func TestGatherColumns(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Stats = map[string][]string{"flows": {"median"}}
+	})
+
+	start := time.Unix(1600000000, 0)
+	ms := []telegraf.Metric{
+		steamStats(nil, "flows", int64(3), start.Add(2*time.Second)),
+		steamStats(nil, "error", int64(0), start.Add(time.Second)),
+		steamStats(nil, "flows", "n/a", start),
+		steamStats(nil, "error", int64(7), start.Add(3*time.Second)),
+	}
+
+	// Gathered twice to reuse the pooled buffers
+	for i := 0; i < 2; i++ {
+		c := p.gatherColumns(ms)
+		if fmt.Sprint(c.order) != "[flows error]" {
+			t.Errorf("columns %v, want [flows error]", c.order)
+		}
+		if fmt.Sprint(c.last) != "[n/a 7]" || fmt.Sprint(c.count) != "[2 2]" || c.metrics != 4 {
+			t.Errorf("last values %v and counts %v of %d metrics, want [n/a 7] and [2 2] of 4", c.last, c.count, c.metrics)
+		}
+		if !c.start.Equal(start) || !c.end.Equal(start.Add(3*time.Second)) {
+			t.Errorf("columns span %v to %v, want %v to %v", c.start, c.end, start, start.Add(3*time.Second))
+		}
+		if _, ok := c.values["error"]; ok {
+			t.Errorf("values of error without statistics gathered")
+		}
+
+		samples := c.samples("flows")
+		if len(samples) != 2 || samples[0].raw != "n/a" || samples[0].numeric || samples[1].value != 3 {
+			t.Errorf("flows samples %+v, want n/a then 3 in time order", samples)
+		}
+		releaseColumns(c)
+	}
+}
@@ -0,0 +1,213 @@
+package cyclestats
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// computedField is a field derived from the aggregated fields by an
+// expression of the compute table.
+type computedField struct {
+	name string
+	expr ast.Expr
+}
+
+// computeFuncs are the functions available in compute expressions.
+var computeFuncs = map[string]func(args []float64) (float64, error){
+	"abs": func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("abs takes 1 argument")
+		}
+		return math.Abs(args[0]), nil
+	},
+	"min": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("min takes at least 1 argument")
+		}
+		v := args[0]
+		for _, arg := range args[1:] {
+			v = math.Min(v, arg)
+		}
+		return v, nil
+	},
+	"max": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("max takes at least 1 argument")
+		}
+		v := args[0]
+		for _, arg := range args[1:] {
+			v = math.Max(v, arg)
+		}
+		return v, nil
+	},
+}
+
+// compileCompute parses the expressions of the compute table. Expressions
+// are arithmetic in Go syntax: numbers, field names, the operators + - * /,
+// parentheses and the functions abs, min and max. The fields are computed
+// in the order of their names.
+func compileCompute(exprs map[string]string) ([]*computedField, error) {
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	computed := make([]*computedField, 0, len(names))
+	for _, name := range names {
+		expr, err := parser.ParseExpr(exprs[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression for %q: %v", name, err)
+		}
+		if err := checkExpr(expr); err != nil {
+			return nil, fmt.Errorf("invalid expression for %q: %v", name, err)
+		}
+		computed = append(computed, &computedField{name: name, expr: expr})
+	}
+	return computed, nil
+}
+
+// checkExpr rejects the parts of Go syntax not supported in expressions.
+func checkExpr(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if _, err := literalValue(e); err != nil {
+			return err
+		}
+	case *ast.Ident:
+	case *ast.ParenExpr:
+		return checkExpr(e.X)
+	case *ast.UnaryExpr:
+		if e.Op != token.SUB && e.Op != token.ADD {
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		return checkExpr(e.X)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO:
+		default:
+			return fmt.Errorf("unsupported operator %s", e.Op)
+		}
+		if err := checkExpr(e.X); err != nil {
+			return err
+		}
+		return checkExpr(e.Y)
+	case *ast.CallExpr:
+		fn, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			return fmt.Errorf("unsupported function call")
+		}
+		if _, ok := computeFuncs[fn.Name]; !ok {
+			return fmt.Errorf("unknown function %q", fn.Name)
+		}
+		for _, arg := range e.Args {
+			if err := checkExpr(arg); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported expression %T", expr)
+	}
+	return nil
+}
+
+// literalValue returns the value of a number literal. Integers are parsed
+// with their base prefix, such as 0x1F or 0o17.
+func literalValue(lit *ast.BasicLit) (float64, error) {
+	switch lit.Kind {
+	case token.INT:
+		v, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %s", lit.Value)
+		}
+		return float64(v), nil
+	case token.FLOAT:
+		v, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %s", lit.Value)
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("unsupported literal %s", lit.Value)
+}
+
+// evalExpr evaluates an expression over the fields of m. It fails if a
+// field is missing or not numeric.
+func evalExpr(expr ast.Expr, m telegraf.Metric) (float64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return literalValue(e)
+	case *ast.Ident:
+		value, ok := m.GetField(e.Name)
+		if !ok {
+			return 0, fmt.Errorf("field %q missing", e.Name)
+		}
+		v, ok := toFloat(value)
+		if !ok {
+			return 0, fmt.Errorf("field %q is not numeric", e.Name)
+		}
+		return v, nil
+	case *ast.ParenExpr:
+		return evalExpr(e.X, m)
+	case *ast.UnaryExpr:
+		v, err := evalExpr(e.X, m)
+		if e.Op == token.SUB {
+			v = -v
+		}
+		return v, err
+	case *ast.BinaryExpr:
+		x, err := evalExpr(e.X, m)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalExpr(e.Y, m)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			return x / y, nil
+		}
+	case *ast.CallExpr:
+		args := make([]float64, 0, len(e.Args))
+		for _, arg := range e.Args {
+			v, err := evalExpr(arg, m)
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+		}
+		return computeFuncs[e.Fun.(*ast.Ident).Name](args)
+	}
+	return 0, fmt.Errorf("unsupported expression %T", expr)
+}
+
+// computeFields adds the fields of the compute table to an aggregate.
+// Fields whose expression refers to fields the aggregate lacks, or whose
+// result is not a number such as after a division by zero, are left out.
+func (t *CycleStats) computeFields(aggregate telegraf.Metric) {
+	for _, c := range t.computed {
+		v, err := evalExpr(c.expr, aggregate)
+		if err != nil {
+			t.Log.Debugf("Not computing %q for %q: %v", c.name, aggregate.Name(), err)
+			continue
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		aggregate.AddField(c.name, v)
+	}
+}
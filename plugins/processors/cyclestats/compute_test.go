@@ -0,0 +1,122 @@
+package cyclestats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestCompileCompute(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"cook_temp - control_temp", true},
+		{"-(drain_to_sec1 + +drain_to_sec2) / 2", true},
+		{"max(abs(cook_temp - 121), min(1, 2, 3))", true},
+		{"0x1F + 0o17 + 0b11 + 017 + 1_000 + 1.5e3 + .5", true},
+		{"99999999999999999999", false},
+		{"1e400", false},
+		{`"closed"`, false},
+		{"'c'", false},
+		{"cook_temp % 2", false},
+		{"cook_temp > 2", false},
+		{"!locked", false},
+		{"sqrt(cook_temp)", false},
+		{"math.Abs(cook_temp)", false},
+		{"temps[0]", false},
+		{"cook_temp +", false},
+	}
+	for _, tt := range tests {
+		_, err := compileCompute(map[string]string{"computed": tt.expr})
+		if (err == nil) != tt.ok {
+			t.Errorf("compiling %q: got error %v, want ok %v", tt.expr, err, tt.ok)
+		}
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	m := metric.New("steam_params", nil, map[string]interface{}{
+		"cook_temp":     121.5,
+		"control_temp":  120.0,
+		"drain_to_sec1": int64(30),
+		"drain_to_sec2": uint64(12),
+		"heater":        true,
+		"door":          "closed",
+	}, time.Unix(1600000000, 0))
+
+	tests := []struct {
+		expr string
+		want float64
+		ok   bool
+	}{
+		{expr: "cook_temp - control_temp", want: 1.5, ok: true},
+		{expr: "drain_to_sec1 + drain_to_sec2", want: 42, ok: true},
+		{expr: "-drain_to_sec1 * 2 + heater", want: -59, ok: true},
+		{expr: "(drain_to_sec1 + drain_to_sec2) / 4", want: 10.5, ok: true},
+		{expr: "0x1F + 0o17 + 0b11", want: 49, ok: true},
+		{expr: "017 + 1_000", want: 1015, ok: true},
+		{expr: "1.5e3 + .5", want: 1500.5, ok: true},
+		{expr: "abs(control_temp - cook_temp)", want: 1.5, ok: true},
+		{expr: "max(cook_temp - control_temp, 0)", want: 1.5, ok: true},
+		{expr: "min(cook_temp, control_temp, 100)", want: 100, ok: true},
+		{expr: "cook_temp / 0", want: math.Inf(1), ok: true},
+		{expr: "cook_temp + lid_temp", ok: false},
+		{expr: "door + 1", ok: false},
+		{expr: "abs(cook_temp, control_temp)", ok: false},
+	}
+	for _, tt := range tests {
+		computed, err := compileCompute(map[string]string{"computed": tt.expr})
+		if err != nil {
+			t.Fatalf("compiling %q: %v", tt.expr, err)
+		}
+		got, err := evalExpr(computed[0].expr, m)
+		if (err == nil) != tt.ok {
+			t.Errorf("evaluating %q: got error %v, want ok %v", tt.expr, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestComputeFields(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Compute = map[string]string{
+			"overshoot":      "max(cook_temp - control_temp, 0)",
+			"overshoot_pct":  "overshoot * 100 / control_temp",
+			"per_flow":       "cook_temp / flows",
+			"drain_seconds":  "drain_to_sec1 + drain_to_sec2",
+			"hex_difference": "0x10 - control_temp",
+		}
+	})
+
+	aggregate := metric.New("steam_params", nil, map[string]interface{}{
+		"cook_temp":    125.0,
+		"control_temp": 120.0,
+		"flows":        int64(0),
+	}, time.Unix(1600000000, 0))
+	p.computeFields(aggregate)
+
+	want := map[string]interface{}{
+		"cook_temp":    125.0,
+		"control_temp": 120.0,
+		"flows":        int64(0),
+		// Computed in name order, so later fields use earlier ones
+		"overshoot":      5.0,
+		"overshoot_pct":  500.0 / 120,
+		"hex_difference": -104.0,
+	}
+	got := aggregate.Fields()
+	if len(got) != len(want) {
+		t.Errorf("got fields %v, want %v", got, want)
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%s = %v, want %v", field, got[field], value)
+		}
+	}
+}
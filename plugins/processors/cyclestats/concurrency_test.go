@@ -0,0 +1,155 @@
+package cyclestats
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/models"
+)
+
+// addConcurrently adds the metrics from as many goroutines as there are
+// devices, each adding the metrics of its own devices, while the debug
+// endpoint reads the cache. Run with -race.
+func addConcurrently(t *testing.T, p *CycleStats, acc telegraf.Accumulator, metrics []telegraf.Metric, devices int) {
+	t.Helper()
+
+	perDevice := make([][]telegraf.Metric, devices)
+	for _, m := range metrics {
+		var d int
+		if _, err := fmt.Sscan(p.deviceID(m), &d); err != nil {
+			t.Fatal(err)
+		}
+		perDevice[d] = append(perDevice[d], m)
+	}
+
+	stop := make(chan struct{})
+	var reader sync.WaitGroup
+	reader.Add(1)
+	go func() {
+		defer reader.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.serveDebugCache(httptest.NewRecorder(), nil)
+			}
+		}
+	}()
+
+	var adders sync.WaitGroup
+	for _, ms := range perDevice {
+		adders.Add(1)
+		go func(ms []telegraf.Metric) {
+			defer adders.Done()
+			for _, m := range ms {
+				if err := p.Add(m, acc); err != nil {
+					t.Error(err)
+				}
+			}
+		}(ms)
+	}
+	adders.Wait()
+	close(stop)
+	reader.Wait()
+}
+
+// countSamples returns the number of metrics the aggregates were built
+// from.
+func countSamples(t *testing.T, metrics []telegraf.Metric) int64 {
+	t.Helper()
+
+	var n int64
+	for _, m := range metrics {
+		samples, ok := m.GetField("samples")
+		if !ok {
+			t.Fatalf("aggregate without samples: %v", m)
+		}
+		n += samples.(int64)
+	}
+	return n
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			metrics := benchMetrics(8, 5)
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Shards = shards
+				p.DropOriginal = true
+				p.SampleCounts = true
+			})
+
+			acc := &collect{}
+			if err := p.Start(acc); err != nil {
+				t.Fatal(err)
+			}
+			addConcurrently(t, p, acc, copyMetrics(metrics), 8)
+			if err := p.Stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Every metric added ends up in exactly one aggregate
+			if n := countSamples(t, acc.metrics); n != int64(len(metrics)) {
+				t.Errorf("aggregates built from %d metrics, want %d", n, len(metrics))
+			}
+		})
+	}
+}
+
+func TestConcurrentApply(t *testing.T) {
+	metrics := benchMetrics(8, 5)
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.DropOriginal = true
+		p.SampleCounts = true
+	})
+
+	var mu sync.Mutex
+	var out []telegraf.Metric
+	var wg sync.WaitGroup
+	for _, m := range copyMetrics(metrics) {
+		wg.Add(1)
+		go func(m telegraf.Metric) {
+			defer wg.Done()
+			ms := p.Apply(m)
+			mu.Lock()
+			out = append(out, ms...)
+			mu.Unlock()
+		}(m)
+	}
+	wg.Wait()
+	out = append(out, p.flushIncomplete()...)
+
+	if n := countSamples(t, out); n != int64(len(metrics)) {
+		t.Errorf("aggregates built from %d metrics, want %d", n, len(metrics))
+	}
+}
+
+func newTestProcessor(t *testing.T, configure func(p *CycleStats)) *CycleStats {
+	t.Helper()
+
+	p := New()
+	p.Log = models.NewLogger("processors", "cyclestats", "")
+	configure(p)
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// collect is an accumulator keeping the metrics added to it.
+type collect struct {
+	discard
+
+	mu      sync.Mutex
+	metrics []telegraf.Metric
+}
+
+func (c *collect) AddMetric(m telegraf.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = append(c.metrics, m)
+}
@@ -0,0 +1,121 @@
+package cyclestats
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// deviceLevels holds the recent consumable levels of a device per field and
+// when they were last recorded.
+type deviceLevels struct {
+	levels  map[string][]float64
+	updated time.Time
+}
+
+// checkConsumables records the consumable levels of a flushed aggregate and
+// returns alert metrics for levels that dropped faster than allowed (possible
+// leak) or did not drop by more than ConsumableTolerance (possible dosing
+// failure) over the last ConsumableCycles cycles. Levels not recorded within
+// ConsumableTTL are forgotten.
+func (t *CycleStats) checkConsumables(aggregate telegraf.Metric) []telegraf.Metric {
+	if len(t.Consumables) == 0 {
+		return nil
+	}
+	now := time.Now()
+	t.expireLevels(now)
+
+	device := t.deviceID(aggregate)
+	dl, ok := t.levels[device]
+	if !ok || now.Sub(dl.updated) > time.Duration(t.ConsumableTTL) {
+		dl = &deviceLevels{levels: make(map[string][]float64)}
+		t.levels[device] = dl
+	}
+	dl.updated = now
+
+	alerts := make([]telegraf.Metric, 0)
+	for field, maxRate := range t.Consumables {
+		value, ok := aggregate.GetField(field)
+		if !ok {
+			continue
+		}
+		level, ok := toFloat(value)
+		if !ok {
+			continue
+		}
+
+		levels := dl.levels[field]
+		// A level rising beyond the sensor noise means the tank was
+		// refilled, start over
+		if n := len(levels); n > 0 && level-levels[n-1] > t.ConsumableTolerance {
+			levels = levels[:0]
+		}
+		levels = append(levels, level)
+		if len(levels) > t.ConsumableCycles {
+			levels = levels[1:]
+		}
+		dl.levels[field] = levels
+
+		if len(levels) < t.ConsumableCycles {
+			continue
+		}
+
+		rate := (levels[0] - level) / float64(len(levels)-1)
+		var alert string
+		switch {
+		case rate > maxRate:
+			alert = "consumable_leak"
+		case levels[0]-level <= t.ConsumableTolerance:
+			alert = "consumable_stalled"
+		default:
+			continue
+		}
+
+		tags := map[string]string{"alert": alert, "field": field}
+		if device != "" {
+			tags[t.DeviceTag] = device
+		}
+		alerts = append(alerts, metric.New("cyclestats_alert", tags, map[string]interface{}{
+			"level": level,
+			"rate":  rate,
+		}, aggregate.Time()))
+	}
+
+	return alerts
+}
+
+// expireLevels drops the levels of devices not recorded within
+// consumable_ttl, such as those of devices that disappeared. They are
+// checked at most twice per consumable_ttl.
+func (t *CycleStats) expireLevels(now time.Time) {
+	ttl := time.Duration(t.ConsumableTTL)
+	if now.Sub(t.lastLevelsExpiry) < ttl/2 {
+		return
+	}
+	t.lastLevelsExpiry = now
+
+	for device, dl := range t.levels {
+		if now.Sub(dl.updated) > ttl {
+			delete(t.levels, device)
+		}
+	}
+}
+
+// toFloat converts a numeric or boolean field value to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
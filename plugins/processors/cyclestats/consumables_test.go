@@ -0,0 +1,82 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestCheckConsumables(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []float64
+		// alerts holds the alert after each level, "" for none
+		alerts []string
+	}{
+		{
+			name:   "consuming",
+			levels: []float64{50, 48.9, 48.1, 47, 46.1},
+			alerts: []string{"", "", "", "", ""},
+		},
+		{
+			name:   "leak",
+			levels: []float64{50, 47, 44, 41},
+			alerts: []string{"", "", "consumable_leak", "consumable_leak"},
+		},
+		{
+			name:   "stalled with noise",
+			levels: []float64{50, 50.05, 49.98, 50.02, 49.96},
+			alerts: []string{"", "", "consumable_stalled", "consumable_stalled", "consumable_stalled"},
+		},
+		{
+			name:   "refilled",
+			levels: []float64{12, 11, 80, 79, 78},
+			alerts: []string{"", "", "", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Consumables = map[string]float64{"oil_tank": 2}
+				p.ConsumableCycles = 3
+				p.ConsumableTolerance = 0.1
+			})
+
+			start := time.Unix(1600000000, 0)
+			for i, level := range tt.levels {
+				aggregate := metric.New("system_status", map[string]string{"id": "1"},
+					map[string]interface{}{"oil_tank": level}, start.Add(time.Duration(i)*time.Hour))
+				alerts := p.checkConsumables(aggregate)
+
+				var alert string
+				if len(alerts) > 0 {
+					alert, _ = alerts[0].GetTag("alert")
+				}
+				if alert != tt.alerts[i] {
+					t.Errorf("alert %q at level %v, want %q", alert, level, tt.alerts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpireLevels(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Consumables = map[string]float64{"oil_tank": 2}
+	})
+	for _, device := range []string{"1", "2"} {
+		p.checkConsumables(metric.New("system_status", map[string]string{"id": device},
+			map[string]interface{}{"oil_tank": 50.0}, time.Unix(1600000000, 0)))
+	}
+
+	p.levels["1"].updated = time.Now().Add(-25 * time.Hour)
+	p.lastLevelsExpiry = time.Time{}
+	p.expireLevels(time.Now())
+	if _, ok := p.levels["1"]; ok {
+		t.Errorf("levels of the device gone for a day kept")
+	}
+	if _, ok := p.levels["2"]; !ok {
+		t.Errorf("levels of the active device dropped")
+	}
+}
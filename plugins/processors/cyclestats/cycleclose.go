@@ -0,0 +1,57 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func validateCycleClose(mode, tag string) error {
+	switch mode {
+	case "complete":
+	case "tag":
+		if tag == "" {
+			return fmt.Errorf("close_tag must not be empty")
+		}
+	default:
+		return fmt.Errorf("invalid cycle_close %q", mode)
+	}
+	return nil
+}
+
+// closedByTag reports whether any metric of a group carries the close tag
+// set to "true", telling that the device closed its cycle.
+func (t *CycleStats) closedByTag(ms []telegraf.Metric) bool {
+	for _, m := range ms {
+		if value, ok := m.GetTag(t.CloseTag); ok && value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// closeInactive returns the devices with groups not updated within
+// CloseAfter, whose cycles are taken as closed, or nil if there are none. It
+// is checked as metrics arrive, at most twice per CloseAfter.
+func (t *CycleStats) closeInactive() map[string]bool {
+	if t.CloseAfter <= 0 {
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(t.lastClose) < time.Duration(t.CloseAfter)/2 {
+		return nil
+	}
+	t.lastClose = now
+
+	var closed map[string]bool
+	for groupkey, updated := range t.updated {
+		if now.Sub(updated) > time.Duration(t.CloseAfter) && len(t.cache[groupkey]) > 0 {
+			if closed == nil {
+				closed = make(map[string]bool)
+			}
+			closed[t.deviceID(t.cache[groupkey][0])] = true
+		}
+	}
+	return closed
+}
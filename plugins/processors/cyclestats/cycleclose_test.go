@@ -0,0 +1,88 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestValidateCycleClose(t *testing.T) {
+	tests := []struct {
+		mode string
+		tag  string
+		ok   bool
+	}{
+		{mode: "complete", ok: true},
+		{mode: "tag", tag: "completed", ok: true},
+		{mode: "tag", tag: "", ok: false},
+		{mode: "timeout", ok: false},
+	}
+	for _, tt := range tests {
+		err := validateCycleClose(tt.mode, tt.tag)
+		if (err == nil) != tt.ok {
+			t.Errorf("cycle_close %q with close_tag %q: got error %v, want ok %v", tt.mode, tt.tag, err, tt.ok)
+		}
+	}
+}
+
+func TestCycleCloseTag(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.CycleClose = "tag"
+		p.DropOriginal = true
+		p.SampleCounts = true
+	})
+
+	start := time.Unix(1600000000, 0)
+	// All fields of steam_stats, which would complete the group on their own
+	cycle := []telegraf.Metric{
+		steamStats(nil, "stop_cook_count", int64(1), start),
+		steamStats(nil, "error", int64(0), start),
+		steamStats(nil, "flows", int64(10), start),
+		steamStats(nil, "pd_timeouts", int64(0), start),
+		steamStats(nil, "stag_recoveries", int64(0), start),
+		steamStats(map[string]string{"completed": "false"}, "flows", int64(11), start),
+	}
+	if out := applyAll(p, cycle...); len(out) != 0 {
+		t.Fatalf("cycle flushed before it was closed: %v", out)
+	}
+
+	// The closing metric joins the group of its cycle
+	out := applyAll(p, steamStats(map[string]string{"completed": "true"}, "flows", int64(12), start))
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics when the cycle closed, want 1: %v", len(out), out)
+	}
+	if samples, _ := out[0].GetField("samples"); samples != int64(7) {
+		t.Errorf("cycle aggregated from %v metrics, want 7", samples)
+	}
+	if len(p.cache) != 0 {
+		t.Errorf("groups left after the cycle closed: %v", p.cache)
+	}
+}
+
+func TestCloseAfter(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.CloseAfter = config.Duration(20 * time.Millisecond)
+		p.DropOriginal = true
+	})
+
+	start := time.Unix(1600000000, 0)
+	if out := applyAll(p, steamStats(nil, "flows", int64(10), start)); len(out) != 0 {
+		t.Fatalf("open cycle flushed: %v", out)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// A metric of another device finds the inactive cycle of device "1"
+	other := steamStats(map[string]string{"id": "2"}, "flows", int64(3), start)
+	out := applyAll(p, other)
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics after close_after, want 1: %v", len(out), out)
+	}
+	if device, _ := out[0].GetTag("id"); device != "1" {
+		t.Errorf("flushed the cycle of device %q, want 1", device)
+	}
+	if len(p.cache) != 1 {
+		t.Errorf("got %d groups left, want the open cycle of device 2", len(p.cache))
+	}
+}
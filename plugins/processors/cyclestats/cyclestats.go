@@ -3,23 +3,331 @@ package cyclestats
 import (
 	_ "embed"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
-var sampleConfig = ``
+//go:embed sample.conf
+var sampleConfig string
 
 type CycleStats struct {
-	Name    string          `toml:"name"`
-	GroupBy []string        `toml:"group_by"`
-	Log     telegraf.Logger `toml:"-"`
+	Name        string          `toml:"name"`
+	GroupBy     []string        `toml:"group_by"`
+	MergeTags   []string        `toml:"merge_tags"`
+	TagConflict string          `toml:"tag_conflict"`
+	DeviceTag   string          `toml:"device_tag"`
+	Window      config.Duration `toml:"window"`
+	AlignTo     string          `toml:"align_to"`
+	GroupKey    string          `toml:"group_key"`
+
+	Windows map[string]string `toml:"windows"`
+	Log     telegraf.Logger   `toml:"-"`
 	Fields  map[string][]string
 
-	cache   map[string][]telegraf.Metric
-	filters filter.Filter
+	NameOverride string `toml:"name_override"`
+	NamePrefix   string `toml:"name_prefix"`
+	NameSuffix   string `toml:"name_suffix"`
+
+	AggregateTimestamp string `toml:"aggregate_timestamp"`
+
+	Output           string   `toml:"output"`
+	JoinMeasurements []string `toml:"join"`
+	JoinName         string   `toml:"join_name"`
+
+	OutputName   map[string]string            `toml:"output_name"`
+	RenameFields map[string]map[string]string `toml:"rename_fields"`
+
+	KeepUnmatched bool     `toml:"keep_unmatched"`
+	DropOriginal  bool     `toml:"drop_original"`
+	Passthrough   []string `toml:"passthrough"`
+
+	MeasurementInclude []string `toml:"measurement_include"`
+	MeasurementExclude []string `toml:"measurement_exclude"`
+
+	LogSkippedEvery int    `toml:"log_skipped_every"`
+	SchemaFile      string `toml:"schema_file"`
+
+	RequiredFields map[string][]string `toml:"required_fields"`
+	ExcludeFields  map[string][]string `toml:"exclude_fields"`
+
+	SampleCounts        bool   `toml:"sample_counts"`
+	WindowBounds        bool   `toml:"window_bounds"`
+	ReportMissingFields bool   `toml:"report_missing_fields"`
+	Completeness        bool   `toml:"completeness"`
+	MissingFieldsTag    string `toml:"missing_fields_tag"`
+
+	Stats     map[string][]string  `toml:"stats"`
+	Histogram map[string][]float64 `toml:"histogram"`
+
+	SlidingWindow config.Duration `toml:"sliding_window"`
+
+	EWMAFields []string        `toml:"ewma_fields"`
+	EWMAAlpha  float64         `toml:"ewma_alpha"`
+	EWMATTL    config.Duration `toml:"ewma_ttl"`
+
+	DeltaPrevFields []string        `toml:"delta_prev_fields"`
+	DeltaPrevTTL    config.Duration `toml:"delta_prev_ttl"`
+
+	Compute map[string]string `toml:"compute"`
+
+	SchemaPreset string `toml:"schema_preset"`
+	RollupLevel  string `toml:"rollup_level"`
+
+	UnitsProfile string            `toml:"units_profile"`
+	Units        map[string]string `toml:"units"`
+
+	UnitConversions     map[string]string `toml:"unit_conversions"`
+	UnitConversionRules []*UnitConversion `toml:"unit_conversion"`
+
+	Bitmasks map[string][]string `toml:"bitmask"`
+	Enums    []*Enum             `toml:"enum"`
+
+	Thresholds []string `toml:"thresholds"`
+
+	Consumables         map[string]float64 `toml:"consumables"`
+	ConsumableCycles    int                `toml:"consumable_cycles"`
+	ConsumableTolerance float64            `toml:"consumable_tolerance"`
+	ConsumableTTL       config.Duration    `toml:"consumable_ttl"`
+
+	StateFile string         `toml:"state_file"`
+	Service   []*ServiceItem `toml:"service"`
+
+	OEE       *OEE            `toml:"oee"`
+	TopErrors *TopErrors      `toml:"top_errors"`
+	Phases    *PhaseDetection `toml:"phases"`
+
+	CycleEvents bool   `toml:"cycle_events"`
+	CycleIDTag  string `toml:"cycle_id_tag"`
+
+	CycleResults  []*CycleResultRule `toml:"cycle_result"`
+	SuccessResult string             `toml:"success_result"`
+
+	IdleTimeout config.Duration `toml:"idle_timeout"`
+	Expiry      config.Duration `toml:"expiry"`
+
+	CycleClose string          `toml:"cycle_close"`
+	CloseTag   string          `toml:"close_tag"`
+	CloseAfter config.Duration `toml:"close_after"`
+	MinSamples int             `toml:"min_samples"`
+
+	HealthInterval    config.Duration `toml:"health_interval"`
+	HealthMemoryLimit config.Size     `toml:"health_memory_limit"`
+
+	BaselineExport         string          `toml:"baseline_export"`
+	BaselineExportInterval config.Duration `toml:"baseline_export_interval"`
+	BaselineImport         string          `toml:"baseline_import"`
+	ControlLimitSigma      float64         `toml:"control_limit_sigma"`
+
+	GoldenProfile   string `toml:"golden_profile"`
+	CaptureBaseline bool   `toml:"capture_baseline"`
+	CaptureCycles   int    `toml:"capture_cycles"`
+
+	ErrorDictionary       string          `toml:"error_dictionary"`
+	ErrorDictionaryReload config.Duration `toml:"error_dictionary_reload"`
+	ErrorMeasurements     []string        `toml:"error_measurements"`
+
+	Shards int `toml:"shards"`
+
+	HistoryFile      string          `toml:"history_file"`
+	HistoryRetention config.Duration `toml:"history_retention"`
+	HistoryMaxCycles int             `toml:"history_max_cycles"`
+
+	MQTTServers            []string `toml:"mqtt_servers"`
+	MQTTTopic              string   `toml:"mqtt_topic"`
+	MQTTQoS                int      `toml:"mqtt_qos"`
+	MQTTRetain             bool     `toml:"mqtt_retain"`
+	MQTTClientID           string   `toml:"mqtt_client_id"`
+	MQTTUsername           string   `toml:"mqtt_username"`
+	MQTTPassword           string   `toml:"mqtt_password"`
+	MQTTTLSCA              string   `toml:"mqtt_tls_ca"`
+	MQTTTLSCert            string   `toml:"mqtt_tls_cert"`
+	MQTTTLSKey             string   `toml:"mqtt_tls_key"`
+	MQTTInsecureSkipVerify bool     `toml:"mqtt_insecure_skip_verify"`
+
+	DebugListen  string              `toml:"debug_listen"`
+	DebugMetrics bool                `toml:"debug_metrics"`
+	DebugTagpass map[string][]string `toml:"debug_tagpass"`
+
+	SharedCache       string          `toml:"shared_cache"`
+	SharedCachePrefix string          `toml:"shared_cache_prefix"`
+	SharedCacheTTL    config.Duration `toml:"shared_cache_ttl"`
+
+	AckFlush        bool   `toml:"ack_flush"`
+	JournalFile     string `toml:"journal_file"`
+	TrackDeliveries bool   `toml:"track_deliveries"`
+
+	ChunkMaxFields int `toml:"chunk_max_fields"`
+	ChunkMaxBytes  int `toml:"chunk_max_bytes"`
+
+	MaxFields  int    `toml:"max_fields"`
+	MaxBytes   int    `toml:"max_bytes"`
+	TrimPolicy string `toml:"trim_policy"`
+
+	FieldGroups []*FieldGroup `toml:"field_group"`
+	FieldSets   []*FieldSet   `toml:"field_set"`
+
+	MaxPushBatch int    `toml:"max_push_batch"`
+	MaxGroups    int    `toml:"max_groups"`
+	FullPolicy   string `toml:"full_policy"`
+
+	MaxSamplesPerGroup int    `toml:"max_samples_per_group"`
+	SamplesPolicy      string `toml:"samples_policy"`
+
+	ExpectedDevices        int `toml:"expected_devices"`
+	ExpectedFieldsPerCycle int `toml:"expected_fields_per_cycle"`
+
+	// schema holds the field types and units loaded from SchemaFile
+	schema schema
+
+	// fields holds the compiled Fields
+	fields *compiledFields
+	// joinOrder holds the position of the JoinMeasurements, joined the
+	// aggregates held for joining
+	joinOrder map[string]int
+	joined    []*joinPart
+	// excludeFilters holds the compiled ExcludeFields per measurement
+	excludeFilters map[string]filter.Filter
+
+	cache             map[string][]telegraf.Metric
+	filters           filter.Filter
+	tagFilter         filter.Filter
+	passthroughFilter filter.Filter
+	measurementFilter filter.Filter
+	errorMeasurements filter.Filter
+
+	// levels holds the recent consumable levels per device, expired at
+	// lastLevelsExpiry
+	levels           map[string]*deviceLevels
+	lastLevelsExpiry time.Time
+	// thresholds are parsed from Thresholds; crossed holds the thresholds
+	// currently exceeded per device
+	thresholds []*threshold
+	crossed    map[string]map[*threshold]bool
+	// computed are parsed from Compute
+	computed []*computedField
+	// conversions are parsed from UnitConversionRules, preceded by the
+	// UnitConversions of all metrics
+	conversions []*UnitConversion
+	// oee holds the current OEE period per device
+	oee map[string]*oeePeriod
+
+	// topErrors holds the current error counting period per device
+	topErrors map[string]*errorPeriod
+	// phases holds the detected cycle phase per device
+	phases map[string]*phaseState
+	// openCycles holds the devices with a cycle in progress and
+	// endingCycles the aggregates ending them, for the cycle events
+	openCycles   map[string]bool
+	endingCycles map[string]telegraf.Metric
+	// sliding holds the samples within the sliding window per series,
+	// expired at lastSlidingExpiry
+	sliding           map[string]*slidingWindow
+	lastSlidingExpiry time.Time
+
+	// ewma holds the moving averages of the ewma_fields per series,
+	// expired at lastEWMAExpiry
+	ewma           map[string]*ewmaSeries
+	lastEWMAExpiry time.Time
+
+	// prevCycles holds the last flushed cycle per series for the
+	// delta_prev_fields, expired at lastPrevExpiry
+	prevCycles     map[string]*prevCycle
+	lastPrevExpiry time.Time
+	// downtime tracks silent devices
+	downtime *downtimeTracker
+	// health counts the problems reported in cyclestats_health
+	health *healthTracker
+	// periods emits the OEE periods ended by the clock
+	periods *periodTicker
+	// state is persisted to StateFile across restarts
+	state *persistentState
+	// model holds the learned baselines shared with other agents
+	model *baselineModel
+	// errors holds the error codes loaded from ErrorDictionary
+	errors *errorDictionary
+	// golden holds the baselines loaded from GoldenProfile
+	golden map[string]map[string]*fieldBaseline
+	// capture records the golden profile with CaptureBaseline
+	capture *baselineCapture
+	// acks holds source metrics until their aggregate is delivered
+	acks    *ackTracker
+	journal *journal
+
+	acc     telegraf.Accumulator
+	workers []*worker
+
+	// groupsLoad and cycleLoad report how full the caches got relative to
+	// the sizing hints, in percent
+	groupsLoad selfstat.Stat
+	cycleLoad  selfstat.Stat
+	// cacheFull counts the times the cache held max_groups groups
+	cacheFull selfstat.Stat
+	// samplesCapped counts the metrics for groups at max_samples_per_group
+	samplesCapped selfstat.Stat
+	// skipped counts the metrics without matching fields per measurement
+	skipped map[string]selfstat.Stat
+	// incomplete counts the groups flushed before their cycle completed per
+	// reason
+	incomplete map[string]selfstat.Stat
+
+	// keys interns the group keys of the cache so building the key of a
+	// known group does not allocate
+	keys map[string]string
+	// updated holds when groups were last updated, with lastExpiry and
+	// lastClose the times of the last checks for stale groups and inactive
+	// devices
+	updated    map[string]time.Time
+	lastExpiry time.Time
+	lastClose  time.Time
+	// running holds the running statistics of the runningFields per group,
+	// while sampledFields are gathered from the metrics of a group
+	running       map[string]map[string]*runningStats
+	runningFields map[string]bool
+	sampledFields map[string]bool
+
+	// shared holds the groups in Redis if SharedCache is set, with
+	// sharedSynced counting the metrics of each group known to be shared
+	shared       *sharedCache
+	sharedSynced map[string]int
+	// mu guards the cache and per-device state against concurrent Add
+	// calls, the flush on Stop and the debug endpoint served by debugServer
+	mu          *sync.Mutex
+	debugServer *http.Server
+	// debugTagpass restricts the metrics traced with DebugMetrics
+	debugTagpass map[string]filter.Filter
+	// history records the emitted cycles if HistoryFile is set
+	history         *history
+	historyRecorded int
+	// publisher publishes the emitted cycles if MQTTServers is set
+	publisher *publisher
+
+	// carry holds the aggregates exceeding MaxPushBatch for the next flush
+	carry []telegraf.Metric
+
+	// windows are parsed from Windows and alignment from AlignTo
+	windows   map[string]time.Duration
+	alignment alignment
+	// groupTag is the tag driving the grouping with a "tag:" GroupKey,
+	// sentinel the field with a "sentinel:" one and sessions the current
+	// cycle tag or sentinel value per device
+	groupTag string
+	sentinel string
+	sessions map[string]string
+	// keyBuf is reused to build group keys
+	keyBuf []byte
+	// keyTime caches the formatted truncated time of the last group key
+	keyTime    time.Time
+	keyTimeStr string
 }
 
 func (r *CycleStats) Description() string {
@@ -128,7 +436,60 @@ func New() *CycleStats {
 		"error",
 	}
 
-	cyclestats.GroupBy = []string{"*"}
+	cyclestats.MergeTags = []string{"*"}
+	cyclestats.TagConflict = "first"
+	cyclestats.DeviceTag = "id"
+	cyclestats.DropOriginal = true
+	cyclestats.ConsumableCycles = 5
+	cyclestats.ConsumableTTL = config.Duration(24 * time.Hour)
+	cyclestats.levels = make(map[string]*deviceLevels)
+	cyclestats.crossed = make(map[string]map[*threshold]bool)
+	cyclestats.oee = make(map[string]*oeePeriod)
+	cyclestats.topErrors = make(map[string]*errorPeriod)
+	cyclestats.phases = make(map[string]*phaseState)
+	cyclestats.sliding = make(map[string]*slidingWindow)
+	cyclestats.ewma = make(map[string]*ewmaSeries)
+	cyclestats.EWMAAlpha = 0.3
+	cyclestats.EWMATTL = config.Duration(time.Hour)
+	cyclestats.prevCycles = make(map[string]*prevCycle)
+	cyclestats.DeltaPrevTTL = config.Duration(time.Hour)
+	cyclestats.openCycles = make(map[string]bool)
+	cyclestats.sessions = make(map[string]string)
+	cyclestats.endingCycles = make(map[string]telegraf.Metric)
+	cyclestats.downtime = newDowntimeTracker()
+	cyclestats.health = newHealthTracker()
+	cyclestats.periods = &periodTicker{}
+	cyclestats.skipped = make(map[string]selfstat.Stat)
+	cyclestats.mu = &sync.Mutex{}
+	cyclestats.incomplete = make(map[string]selfstat.Stat)
+	cyclestats.state = newPersistentState()
+	cyclestats.model = newBaselineModel()
+	cyclestats.capture = newBaselineCapture()
+	cyclestats.CaptureCycles = 50
+	cyclestats.MQTTTopic = "cycles/{id}/summary"
+	cyclestats.MQTTQoS = 1
+	cyclestats.acks = newAckTracker(nil)
+	cyclestats.BaselineExportInterval = config.Duration(time.Hour)
+	cyclestats.ControlLimitSigma = 3
+	cyclestats.TrimPolicy = "trim"
+	cyclestats.RollupLevel = "cycle"
+	cyclestats.AggregateTimestamp = "start"
+	cyclestats.CycleClose = "complete"
+	cyclestats.CloseTag = "completed"
+	cyclestats.FullPolicy = fullDropOldest
+	cyclestats.SamplesPolicy = capMerge
+	cyclestats.SharedCachePrefix = "cyclestats:"
+	cyclestats.SharedCacheTTL = config.Duration(10 * time.Minute)
+	cyclestats.HistoryRetention = config.Duration(30 * 24 * time.Hour)
+	cyclestats.HistoryMaxCycles = 10000
+	cyclestats.SuccessResult = "success"
+	cyclestats.CycleIDTag = "steam_cycle"
+	cyclestats.Output = "per_measurement"
+	cyclestats.GroupKey = "window"
+	cyclestats.Window = config.Duration(time.Second)
+	cyclestats.JoinName = "cycle"
+	cyclestats.ErrorDictionaryReload = config.Duration(time.Minute)
+	cyclestats.ErrorMeasurements = []string{"steam_stats", "vessel_lid_failure"}
 
 	// Initialize cache
 	cyclestats.Reset()
@@ -142,114 +503,964 @@ func (*CycleStats) SampleConfig() string {
 
 func (t *CycleStats) Init() error {
 	t.Log.Info("Initializing Portal CycleStats Processor")
+
+	if t.SchemaFile != "" {
+		s, err := loadSchema(t.SchemaFile)
+		if err != nil {
+			return fmt.Errorf("could not load schema file: %v", err)
+		}
+		t.schema = s
+		t.Fields = s.fields()
+	}
+
+	if err := t.compileFieldSets(); err != nil {
+		return err
+	}
+	if err := t.compileExcludes(); err != nil {
+		return err
+	}
+
+	for measurement, fields := range t.RequiredFields {
+		if len(fields) == 0 {
+			return fmt.Errorf("required_fields for %q must not be empty", measurement)
+		}
+	}
+
+	if err := validateStats(t.Stats); err != nil {
+		return err
+	}
+
+	if err := validateHistogram(t.Histogram); err != nil {
+		return err
+	}
+	t.compileRunning()
+
+	for measurement, name := range t.OutputName {
+		if name == "" {
+			return fmt.Errorf("output_name for %q must not be empty", measurement)
+		}
+	}
+
+	if err := validateRenames(t.RenameFields, t.Fields); err != nil {
+		return err
+	}
+	if err := validateBitmasks(t.Bitmasks); err != nil {
+		return err
+	}
+	for _, e := range t.Enums {
+		if err := e.init(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateOutput(t.Output); err != nil {
+		return err
+	}
+	if err := validateJoin(t.JoinMeasurements); err != nil {
+		return err
+	}
+	if len(t.JoinMeasurements) > 0 {
+		t.joinOrder = make(map[string]int, len(t.JoinMeasurements))
+		for i, name := range t.JoinMeasurements {
+			t.joinOrder[name] = i
+		}
+	}
+
+	if t.SlidingWindow < 0 {
+		return fmt.Errorf("sliding_window must not be negative")
+	}
+	if err := validateEWMA(t.EWMAFields, t.EWMAAlpha); err != nil {
+		return err
+	}
+	if t.EWMATTL <= 0 {
+		return fmt.Errorf("ewma_ttl must be positive")
+	}
+	if t.DeltaPrevTTL <= 0 {
+		return fmt.Errorf("delta_prev_ttl must be positive")
+	}
+
+	if err := validatePreset(t.SchemaPreset, t.RollupLevel); err != nil {
+		return err
+	}
+	if err := validateAggregateTimestamp(t.AggregateTimestamp); err != nil {
+		return err
+	}
+
+	if err := validateUnits(t.Units, t.UnitsProfile); err != nil {
+		return err
+	}
+
+	if err := t.validateWindows(); err != nil {
+		return err
+	}
+
+	switch t.TagConflict {
+	case "":
+		t.TagConflict = "first"
+	case "first", "last", "drop":
+	default:
+		return fmt.Errorf("invalid tag_conflict %q", t.TagConflict)
+	}
+
+	if t.Shards < 0 {
+		return fmt.Errorf("shards must not be negative, got %d", t.Shards)
+	}
+
+	if t.ChunkMaxFields != 0 && t.ChunkMaxFields < 3 {
+		return fmt.Errorf("chunk_max_fields must be at least 3, got %d", t.ChunkMaxFields)
+	}
+
+	switch t.TrimPolicy {
+	case "":
+		t.TrimPolicy = "trim"
+	case "trim", "drop":
+	default:
+		return fmt.Errorf("invalid trim_policy %q", t.TrimPolicy)
+	}
+	if t.MaxFields != 0 && t.MaxFields < 2 {
+		return fmt.Errorf("max_fields must be at least 2, got %d", t.MaxFields)
+	}
+
+	t.thresholds = make([]*threshold, 0, len(t.Thresholds))
+	for _, condition := range t.Thresholds {
+		th, err := parseThreshold(condition)
+		if err != nil {
+			return err
+		}
+		t.thresholds = append(t.thresholds, th)
+	}
+	t.warnUnknownThresholds()
+
+	if t.ExpectedDevices < 0 || t.ExpectedFieldsPerCycle < 0 {
+		return fmt.Errorf("expected_devices and expected_fields_per_cycle must not be negative")
+	}
+	if t.ExpectedDevices > 0 {
+		t.groupsLoad = selfstat.Register("cyclestats", "groups_load_percent", nil)
+	}
+	if t.ExpectedFieldsPerCycle > 0 {
+		t.cycleLoad = selfstat.Register("cyclestats", "cycle_load_percent", nil)
+	}
+	// Size the cache according to the hints
+	t.Reset()
+
+	if len(t.Consumables) > 0 && t.ConsumableCycles < 2 {
+		return fmt.Errorf("consumable_cycles must be at least 2, got %d", t.ConsumableCycles)
+	}
+	if t.ConsumableTolerance < 0 {
+		return fmt.Errorf("consumable_tolerance must not be negative")
+	}
+	if t.ConsumableTTL <= 0 {
+		return fmt.Errorf("consumable_ttl must be positive")
+	}
+
+	var err error
+	if t.conversions, err = t.compileConversions(); err != nil {
+		return err
+	}
+	if t.computed, err = compileCompute(t.Compute); err != nil {
+		return err
+	}
+	if t.groupTag, t.sentinel, err = parseGroupKey(t.GroupKey); err != nil {
+		return err
+	}
+	if t.debugTagpass, err = compileTagpass("debug_tagpass", t.DebugTagpass); err != nil {
+		return err
+	}
+
+	// The filters are compiled once here and not modified afterwards, so
+	// they are safe to share between shards
+	t.filters, err = compileGroupBy(t.GroupBy)
+	if err != nil {
+		return fmt.Errorf("could not compile group_by: %v %v", t.GroupBy, err)
+	}
+
+	t.tagFilter, err = filter.Compile(t.MergeTags)
+	if err != nil {
+		return fmt.Errorf("could not compile merge_tags: %v %v", t.MergeTags, err)
+	}
+
+	t.measurementFilter, err = filter.NewIncludeExcludeFilter(t.MeasurementInclude, t.MeasurementExclude)
+	if err != nil {
+		return fmt.Errorf("could not compile measurement filters: %v", err)
+	}
+
+	t.passthroughFilter, err = filter.Compile(t.Passthrough)
+	if err != nil {
+		return fmt.Errorf("could not compile passthrough: %v %v", t.Passthrough, err)
+	}
+
+	for _, g := range t.FieldGroups {
+		if len(g.Fields) == 0 {
+			return fmt.Errorf("field_group %q has no fields", g.Name)
+		}
+		g.filter, err = filter.Compile(g.Fields)
+		if err != nil {
+			return fmt.Errorf("could not compile field_group %q: %v %v", g.Name, g.Fields, err)
+		}
+	}
+
+	for _, item := range t.Service {
+		if item.Name == "" || item.Measurement == "" {
+			return fmt.Errorf("service items require a name and a measurement")
+		}
+		if item.Interval <= 0 {
+			return fmt.Errorf("service item %q requires a positive interval", item.Name)
+		}
+		if item.Counter && item.Field == "" {
+			return fmt.Errorf("service item %q counts a field, but has none", item.Name)
+		}
+	}
+
+	if t.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+	if t.Expiry < 0 {
+		return fmt.Errorf("expiry must not be negative")
+	}
+	if err := validateCycleClose(t.CycleClose, t.CloseTag); err != nil {
+		return err
+	}
+	if t.MaxPushBatch < 0 {
+		return fmt.Errorf("max_push_batch must not be negative")
+	}
+	if t.MaxGroups < 0 {
+		return fmt.Errorf("max_groups must not be negative")
+	}
+	if err := validateFullPolicy(t.FullPolicy); err != nil {
+		return err
+	}
+	if t.MaxSamplesPerGroup < 0 {
+		return fmt.Errorf("max_samples_per_group must not be negative")
+	}
+	if err := validateSamplesPolicy(t.SamplesPolicy); err != nil {
+		return err
+	}
+	if t.CloseAfter < 0 {
+		return fmt.Errorf("close_after must not be negative")
+	}
+	if t.MinSamples < 0 {
+		return fmt.Errorf("min_samples must not be negative")
+	}
+	if t.HealthInterval < 0 {
+		return fmt.Errorf("health_interval must not be negative")
+	}
+	if t.BaselineExportInterval < 0 {
+		return fmt.Errorf("baseline_export_interval must not be negative")
+	}
+	if t.HistoryRetention < 0 {
+		return fmt.Errorf("history_retention must not be negative")
+	}
+	if t.SharedCacheTTL < 0 {
+		return fmt.Errorf("shared_cache_ttl must not be negative")
+	}
+	if t.ErrorDictionaryReload < 0 {
+		return fmt.Errorf("error_dictionary_reload must not be negative")
+	}
+
+	if err := validateCycleResults(t.CycleResults); err != nil {
+		return err
+	}
+
+	if t.OEE != nil {
+		if err := t.OEE.init(); err != nil {
+			return err
+		}
+	}
+
+	if t.TopErrors != nil {
+		if err := t.TopErrors.init(); err != nil {
+			return err
+		}
+	}
+
+	if t.Phases != nil {
+		if err := t.Phases.init(); err != nil {
+			return err
+		}
+	}
+
+	if t.StateFile != "" {
+		if err := t.state.load(t.StateFile); err != nil {
+			return fmt.Errorf("could not load state file: %v", err)
+		}
+	}
+
+	if t.HistoryFile != "" {
+		if t.HistoryRetention < 0 || t.HistoryMaxCycles < 0 {
+			return fmt.Errorf("history_retention and history_max_cycles must not be negative")
+		}
+		t.history, err = openHistory(t.HistoryFile, time.Duration(t.HistoryRetention), t.HistoryMaxCycles)
+		if err != nil {
+			return fmt.Errorf("could not open history: %v", err)
+		}
+		if err := t.history.prune(); err != nil {
+			return fmt.Errorf("could not prune history: %v", err)
+		}
+	}
+
+	if len(t.MQTTServers) > 0 {
+		t.publisher, err = t.newPublisher()
+		if err != nil {
+			return fmt.Errorf("could not set up mqtt publisher: %v", err)
+		}
+	}
+
+	if t.SharedCache != "" {
+		if t.SharedCacheTTL <= 0 {
+			return fmt.Errorf("shared_cache_ttl must be positive")
+		}
+		t.shared, err = newSharedCache(t.SharedCache, t.SharedCachePrefix, time.Duration(t.SharedCacheTTL))
+		if err != nil {
+			return fmt.Errorf("could not set up shared cache: %v", err)
+		}
+	}
+
+	if t.JournalFile != "" {
+		t.journal, err = openJournal(t.JournalFile)
+		if err != nil {
+			return fmt.Errorf("could not open journal: %v", err)
+		}
+		t.acks = newAckTracker(t.journal)
+	}
+
+	if t.BaselineImport != "" {
+		if err := t.importBaselines(); err != nil {
+			return fmt.Errorf("could not import baselines: %v", err)
+		}
+	}
+
+	if err := validateCapture(t.CaptureBaseline, t.CaptureCycles, t.GoldenProfile); err != nil {
+		return err
+	}
+	// The golden profile is written rather than scored against while
+	// capturing it
+	if t.GoldenProfile != "" && !t.CaptureBaseline {
+		t.golden, err = loadGoldenProfile(t.GoldenProfile)
+		if err != nil {
+			return fmt.Errorf("could not load golden profile: %v", err)
+		}
+	}
+
+	if t.ErrorDictionary != "" {
+		if len(t.ErrorMeasurements) == 0 {
+			return fmt.Errorf("error_dictionary requires error_measurements")
+		}
+		t.errorMeasurements, err = filter.Compile(t.ErrorMeasurements)
+		if err != nil {
+			return fmt.Errorf("could not compile error_measurements: %v %v", t.ErrorMeasurements, err)
+		}
+		t.errors, err = openErrorDictionary(t.ErrorDictionary, time.Duration(t.ErrorDictionaryReload))
+		if err != nil {
+			return fmt.Errorf("could not load error dictionary: %v", err)
+		}
+	}
+
 	return nil
 }
 
-
 func (t *CycleStats) Reset() {
-	t.cache = make(map[string][]telegraf.Metric)
+	t.cache = make(map[string][]telegraf.Metric, t.ExpectedDevices)
+	t.keys = make(map[string]string, t.ExpectedDevices)
+	t.updated = make(map[string]time.Time)
+	t.running = make(map[string]map[string]*runningStats)
+	t.sharedSynced = make(map[string]int)
 }
 
-func (t *CycleStats) generateGroupByKey(m telegraf.Metric) (string, error) {
-	// Create the filter.Filter objects if they have not been created
-	if t.filters == nil && len(t.GroupBy) > 0 {
-		var err error
-		t.filters, err = filter.Compile(t.GroupBy)
+// deviceID returns the device a metric originates from, or an empty string
+// if the metric carries no device tag.
+func (t *CycleStats) deviceID(m telegraf.Metric) string {
+	id, _ := m.GetTag(t.DeviceTag)
+	return id
+}
+
+// windowStart returns the start of the group window of the measurement
+// containing ts, aligned according to align_to.
+func (t *CycleStats) windowStart(measurement string, ts time.Time) time.Time {
+	a := t.alignment
+	w := t.window(measurement)
+	if a.period == 0 {
+		return ts.Add(-a.offset).Truncate(w).Add(a.offset)
+	}
+
+	// Windows restart at the position in every minute or hour, cutting the
+	// last one short unless the window divides the minute or hour
+	anchor := ts.Add(-a.offset).Truncate(a.period).Add(a.offset)
+	return anchor.Add(ts.Sub(anchor).Truncate(w))
+}
+
+// compileTagpass compiles the tag filters of a tagpass option, keyed by
+// tag.
+func compileTagpass(option string, tagpass map[string][]string) (map[string]filter.Filter, error) {
+	filters := make(map[string]filter.Filter, len(tagpass))
+	for tag, patterns := range tagpass {
+		f, err := filter.Compile(patterns)
 		if err != nil {
-			return "", fmt.Errorf("could not compile pattern: %v %v", t.GroupBy, err)
+			return nil, fmt.Errorf("invalid %s for %q: %v", option, tag, err)
+		}
+		if f != nil {
+			filters[tag] = f
 		}
 	}
+	return filters, nil
+}
+
+// passes reports whether any tag of a metric matches its filter, like
+// tagpass does.
+func passes(filters map[string]filter.Filter, m telegraf.Metric) bool {
+	for tag, f := range filters {
+		if value, ok := m.GetTag(tag); ok && f.Match(value) {
+			return true
+		}
+	}
+	return false
+}
 
-	groupkey := m.Name() + "&" + m.Time().Truncate(1000*time.Millisecond).String()
+// compileGroupBy compiles the group_by patterns into a filter of the tags in
+// the group key. Patterns prefixed with "!" exclude the tags they match; if
+// there are only those, all other tags are included. No patterns means no
+// tags, and a nil filter.
+func compileGroupBy(patterns []string) (filter.Filter, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
 
-	return groupkey, nil
+	var include, exclude []string
+	for _, p := range patterns {
+		if p == "" {
+			return nil, fmt.Errorf("empty pattern")
+		}
+		if strings.HasPrefix(p, "!") {
+			if p == "!" {
+				return nil, fmt.Errorf("empty negated pattern")
+			}
+			exclude = append(exclude, p[1:])
+			continue
+		}
+		include = append(include, p)
+	}
+	return filter.NewIncludeExcludeFilter(include, exclude)
 }
 
-func (t *CycleStats) groupBy(m telegraf.Metric) {
+// appendKeyPart appends a part of a group key to buf prefixed by its length,
+// so values containing any character cannot run into the next part and
+// collide with the key of another group.
+func appendKeyPart(buf []byte, part string) []byte {
+	buf = strconv.AppendInt(buf, int64(len(part)), 10)
+	buf = append(buf, ':')
+	return append(buf, part...)
+}
+
+// cycleKey returns the group key without its measurement, the same for the
+// groups of all measurements of a cycle.
+func cycleKey(groupkey string) string {
+	n := strings.IndexByte(groupkey, ':')
+	length, _ := strconv.Atoi(groupkey[:n])
+	return groupkey[n+1+length:]
+}
+
+// generateGroupByKey returns the key of the group a metric belongs to: the
+// measurement, device, window start, cycle tag or session and group_by
+// tags, each prefixed by its length.
+func (t *CycleStats) generateGroupByKey(m telegraf.Metric) string {
+	// Metrics of a cycle arrive in bursts, so the time is only formatted
+	// when it changes
+	ts := t.windowStart(m.Name(), m.Time())
+	if t.keyTimeStr == "" || !ts.Equal(t.keyTime) || ts.Location() != t.keyTime.Location() {
+		t.keyTime = ts
+		t.keyTimeStr = ts.String()
+	}
+
+	// Devices reporting in the same second must not be fused into one cycle
+	t.keyBuf = appendKeyPart(t.keyBuf[:0], m.Name())
+	t.keyBuf = appendKeyPart(t.keyBuf, t.deviceID(m))
+
+	// A cycle tag or sentinel session replaces the window if known. The tag
+	// or sentinel name follows the cycle, so the key has one part more than
+	// a window key and the two cannot collide.
+	if cycle, by, ok := t.cycleOf(m); ok {
+		t.keyBuf = appendKeyPart(t.keyBuf, cycle)
+		t.keyBuf = appendKeyPart(t.keyBuf, by)
+	} else {
+		t.keyBuf = appendKeyPart(t.keyBuf, t.keyTimeStr)
+	}
+
+	// Cycles of the same device overlapping in a window, such as retries,
+	// are kept apart by the group_by tags. The tags are sorted, so the key
+	// does not depend on the order they were added in.
+	for _, tag := range m.TagList() {
+		if t.filters == nil || tag.Key == t.DeviceTag || !t.filters.Match(tag.Key) {
+			continue
+		}
+		// The phase is detected after grouping and would split the cycle
+		// of a requeued metric from the rest, the close tag would split the
+		// closing metric from its cycle
+		if t.Phases != nil && tag.Key == t.Phases.Tag {
+			continue
+		}
+		if t.CycleClose == "tag" && tag.Key == t.CloseTag {
+			continue
+		}
+		if tag.Key == t.groupTag {
+			continue
+		}
+		t.keyBuf = appendKeyPart(t.keyBuf, tag.Key)
+		t.keyBuf = appendKeyPart(t.keyBuf, tag.Value)
+	}
+
+	// Looking up a converted byte slice does not allocate
+	if groupkey, ok := t.keys[string(t.keyBuf)]; ok {
+		return groupkey
+	}
+	groupkey := string(t.keyBuf)
+	t.keys[groupkey] = groupkey
+
+	return groupkey
+}
+
+// groupBy adds a metric to its group and returns the group key, or an empty
+// key if the cache is full and the metric was dropped.
+func (t *CycleStats) groupBy(m telegraf.Metric) string {
 	// Generate the metric group key
-	groupkey, err := t.generateGroupByKey(m)
-	if err != nil {
-		// If we could not generate the groupkey, fail hard
-		// by dropping this and all subsequent metrics
-		t.Log.Errorf("Could not generate group key: %v", err)
-		return
+	groupkey := t.generateGroupByKey(m)
+
+	// A full group either takes the metric in without growing or is
+	// flushed to make way for a new one
+	if _, ok := t.cache[groupkey]; ok && !t.capGroup(groupkey, m) {
+		t.touchGroup(groupkey)
+		return groupkey
 	}
 
 	// Initialize the key with an empty list if necessary
 	if _, ok := t.cache[groupkey]; !ok {
-		t.cache[groupkey] = make([]telegraf.Metric, 0, 10)
+		if !t.makeRoom(m) {
+			return ""
+		}
+		size := t.ExpectedFieldsPerCycle
+		if size <= 0 {
+			size = 10
+		}
+		t.cache[groupkey] = newGroup(size)
 	}
 
+	t.touchGroup(groupkey)
+
 	// Append the metric to the corresponding key list
 	t.cache[groupkey] = append(t.cache[groupkey], m)
+	t.accumulate(groupkey, m)
+
+	return groupkey
 }
 
 func (t *CycleStats) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireGroups()
+
+	resent := t.requeueUndelivered()
 
-	groupkey := ""
 	// Add the metrics received to our internal cache
-	var measurment string
+	out := make([]telegraf.Metric, 0)
+	touched := make(map[string]bool)
 	for _, m := range in {
-		measurment = m.Name()
+		if t.isPassthrough(m) {
+			out = append(out, m)
+			continue
+		}
+
+		// Unmatched and, unless dropped, original metrics are passed on as
+		// received, so they are copied before being prepared for
+		// aggregation
+		var raw telegraf.Metric
+		if t.KeepUnmatched || !t.DropOriginal {
+			raw = m.Copy()
+		}
+
+		t.excludeFields(m)
+		t.convertTypes(m)
+		t.decodeBitmasks(m)
+		t.applyConversions(m)
+
+		// Alert on crossed thresholds right away instead of at the end of
+		// the cycle
+		out = append(out, t.checkThresholds(m)...)
+		out = append(out, t.recordSeen(m)...)
+
+		// Check if the metric has any of the fields over which we are aggregating
+		if !t.hasMatchingField(m) {
+			t.recordSkipped(m)
+			t.traceSkipped(m)
+			m.Drop()
+			if t.KeepUnmatched {
+				out = append(out, raw)
+			} else if raw != nil {
+				raw.Drop()
+			}
+			continue
+		}
+
+		// Outputs never see the metrics the aggregates are built from, only
+		// the copies taken before
+		if !t.DropOriginal {
+			out = append(out, raw)
+		} else if raw != nil {
+			raw.Drop()
+		}
+
 		// When tracking metrics this plugin could deadlock the input by
 		// holding undelivered metrics while the input waits for metrics to be
-		// delivered.  Instead, treat all handled metrics as delivered and
-		// produced metrics as untracked in a similar way to aggregators.
-		m.Drop()
-		gkey, _ := t.generateGroupByKey(m)
-		groupkey = gkey
-		// Check if the metric has any of the fields over which we are aggregating
-		hasField := false
-		for _, f := range t.Fields[m.Name()] {
-			if m.HasField(f) {
-				hasField = true
-				break
+		// delivered.  Unless asked to hold them, treat all handled metrics as
+		// delivered and produced metrics as untracked in a similar way to
+		// aggregators.
+		if !t.TrackDeliveries {
+			m.Drop()
+		}
+
+		t.detectPhase(m)
+		out = append(out, t.detectSession(m)...)
+
+		// Add the metric to the internal cache
+		if groupkey := t.groupBy(m); groupkey != "" {
+			t.traceAssigned(m, groupkey)
+			touched[groupkey] = true
+			out = append(out, t.cycleStartEvent(m)...)
+		}
+	}
+	out = append(out, resent...)
+
+	// A completed cycle flushes the groups of its device only, other
+	// devices may be in the middle of their cycles
+	completed := t.closeInactive()
+	if len(completed) > 0 {
+		for groupkey, ms := range t.cache {
+			if completed[t.deviceID(ms[0])] {
+				t.warnIncomplete(groupkey, flushTimeout)
 			}
 		}
-		if !hasField {
+	}
+	for groupkey := range touched {
+		complete := t.isComplete(groupkey)
+		t.traceComplete(groupkey, complete)
+		if !complete {
 			continue
 		}
+		if completed == nil {
+			completed = make(map[string]bool)
+		}
+		completed[t.deviceID(t.cache[groupkey][0])] = true
+	}
+	if len(completed) > 0 {
+		return append(out, t.push(completed)...)
+	}
 
-		// Add the metric to the internal cache
-		t.groupBy(m)
+	return append(out, t.limitBatch(nil)...)
+}
+
+// isPassthrough returns true for metrics of measurements not selected by the
+// measurement filters or without configured fields that are routed through
+// untouched.
+func (t *CycleStats) isPassthrough(m telegraf.Metric) bool {
+	if !t.measurementFilter.Match(m.Name()) {
+		return true
+	}
+	if t.passthroughFilter == nil {
+		return false
+	}
+	if _, ok := t.fieldsOf(m).fields[m.Name()]; ok {
+		return false
+	}
+	return t.passthroughFilter.Match(m.Name())
+}
+
+// hasMatchingField reports whether the metric has any of the fields
+// configured for its measurement.
+func (t *CycleStats) hasMatchingField(m telegraf.Metric) bool {
+	for _, f := range m.FieldList() {
+		if matched, _ := t.matchField(m, f.Key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isComplete reports whether a group holds everything expected for its
+// measurement: all required fields if configured, otherwise one metric per
+// configured field. With cycle_close "tag" a group is complete only once
+// the device tagged a metric as closing its cycle. Groups of fewer than
+// MinSamples metrics and the groups of a cycle tag or sentinel session,
+// which end when the tag or sentinel changes, are never complete.
+func (t *CycleStats) isComplete(groupkey string) bool {
+	ms := t.cache[groupkey]
+	if len(ms) == 0 || len(ms) < t.MinSamples {
+		return false
+	}
+
+	if t.CycleClose == "tag" {
+		return t.closedByTag(ms)
+	}
+	// Cycle tag and sentinel sessions end when the tag or sentinel changes
+	if t.cycleDriven(ms[0]) {
+		return false
 	}
 
-	if keyCount := len(t.cache[groupkey]); keyCount >= len(t.Fields[measurment]) {
-		return t.push()
+	required, ok := t.RequiredFields[ms[0].Name()]
+	if !ok {
+		return len(ms) >= len(t.fieldsOf(ms[0]).fields[ms[0].Name()])
 	}
 
-	return []telegraf.Metric{}
+	for _, f := range required {
+		observed := false
+		for _, m := range ms {
+			if m.HasField(f) {
+				observed = true
+				break
+			}
+		}
+		if !observed {
+			return false
+		}
+	}
+	return true
 }
 
-func (t *CycleStats) push() []telegraf.Metric {
+// flushIncomplete flushes the groups left in the cache, whose cycles did not
+// complete, and the open periods, tagged with incomplete=true.
+func (t *CycleStats) flushIncomplete() []telegraf.Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := t.flushIncompleteGroups()
+	// The periods still open include the cycles flushed above
+	out = append(out, t.flushOEE()...)
+	return append(out, t.flushTopErrors()...)
+}
+
+// flushIncompleteGroups flushes the groups left in the cache. The caller
+// must hold the lock.
+func (t *CycleStats) flushIncompleteGroups() []telegraf.Metric {
+	if len(t.cache) == 0 {
+		return t.takeCarried()
+	}
+	if t.shared != nil && !t.shared.last {
+		// The other agents go on with the shared cycles, unless they cannot
+		// be shared
+		_, err := t.syncShared()
+		if err == nil {
+			t.Log.Infof("Leaving %d groups in the shared cache", len(t.cache))
+			t.Reset()
+			return t.takeCarried()
+		}
+		t.Log.Errorf("Could not share groups left, flushing them: %v", err)
+		t.reportProblem(problemStatePersistence)
+	}
+	for groupkey, ms := range t.cache {
+		t.warnIncomplete(groupkey, flushShutdown)
+		// Aggregates take their tags from the first metric of the group
+		ms[0].AddTag("incomplete", "true")
+	}
+	t.Log.Infof("Flushing %d incomplete groups", len(t.cache))
+	return append(t.push(nil), t.takeCarried()...)
+}
+
+// push flushes the groups of the given devices, or all groups if devices is
+// nil.
+func (t *CycleStats) push(devices map[string]bool) []telegraf.Metric {
 	// Generate aggregations list using the selected fields
+	t.reportLoad()
+
 	aggs := make([]telegraf.Metric, 0)
-	for _, ms := range t.cache {
-		aggregate, _ := t.Aggregate(ms)
-		aggs = append(aggs, aggregate)
+	for groupkey, ms := range t.cache {
+		if devices != nil && !devices[t.deviceID(ms[0])] {
+			continue
+		}
+		aggs = append(aggs, t.flushGroup(groupkey, ms)...)
 	}
 
-	t.Reset()
+	aggs = append(aggs, t.emitJoined()...)
+	aggs = append(aggs, t.cycleEndEvents()...)
+	aggs = append(aggs, t.takeDowntime()...)
+
+	t.saveState()
+
+	return t.limitBatch(aggs)
+}
+
+// flushGroup removes a group from the cache and returns its aggregate
+// along with the metrics derived from it.
+func (t *CycleStats) flushGroup(groupkey string, ms []telegraf.Metric) []telegraf.Metric {
+	t.traceFlush(groupkey, ms)
+	running := t.running[groupkey]
+	synced := t.sharedSynced[groupkey]
+	delete(t.cache, groupkey)
+	delete(t.keys, groupkey)
+	delete(t.updated, groupkey)
+	delete(t.running, groupkey)
+	delete(t.sharedSynced, groupkey)
 
+	ms, ok := t.takeShared(groupkey, ms, synced)
+	if !ok {
+		return nil
+	}
+
+	aggregate, cols, err := t.aggregate(ms)
+	if err != nil {
+		// Rejecting the metrics lets the inputs retry them
+		t.Log.Errorf("Could not aggregate group: %v", err)
+		t.releaseSources(ms, false)
+		return nil
+	}
+	t.addSampleCounts(aggregate, cols)
+	t.addWindowBounds(aggregate, cols)
+	t.reportMissingFields(aggregate)
+	t.addCompleteness(aggregate)
+	t.slide(aggregate, cols)
+	t.computeStats(aggregate, cols, running)
+	releaseColumns(cols)
+	t.addPhaseDurations(aggregate, ms)
+	t.computeFields(aggregate)
+	t.addEWMA(aggregate)
+	t.addDeltaPrev(aggregate)
+	t.applyEnums(aggregate)
+	t.describeError(aggregate)
+
+	// Analyses work on the aggregate as aggregated, before it is reshaped
+	// for the outputs
+	aggs := make([]telegraf.Metric, 0)
+	aggs = append(aggs, t.checkConsumables(aggregate)...)
+	aggs = append(aggs, t.estimateMaintenance(aggregate)...)
+	aggs = append(aggs, t.computeOEE(aggregate)...)
+	aggs = append(aggs, t.trackErrors(aggregate)...)
+	t.learnBaselines(aggregate)
+	t.scoreGolden(aggregate)
+	t.classifyCycle(aggregate)
+	t.captureBaseline(aggregate)
+	t.noteCycleEnd(aggregate)
+
+	if t.holdJoined(aggregate, ms, groupkey) {
+		return aggs
+	}
+	aggs = append(aggs, t.emit(aggregate, ms, groupkey)...)
+	t.recycleGroup(ms)
 	return aggs
 }
 
-func (c *CycleStats) Aggregate(ms []telegraf.Metric) (telegraf.Metric, error) {
-	var metric telegraf.Metric
-	for _, m := range ms {
-		if metric == nil {
-			metric = m.Copy()
-		} else {
-			for _, field := range m.FieldList() {
-				metric.AddField(field.Key, field.Value)
+// reportLoad reports the number of groups and the largest group about to be
+// flushed relative to the sizing hints. Values above 100 mean the cache had
+// to grow.
+func (t *CycleStats) reportLoad() {
+	if t.groupsLoad != nil {
+		t.groupsLoad.Set(int64(100 * len(t.cache) / t.ExpectedDevices))
+	}
+	if t.cycleLoad != nil {
+		largest := 0
+		for _, ms := range t.cache {
+			if len(ms) > largest {
+				largest = len(ms)
 			}
 		}
+		t.cycleLoad.Set(int64(100 * largest / t.ExpectedFieldsPerCycle))
+	}
+}
+
+// emit reshapes an aggregate for the outputs and returns the metrics to
+// emit for it.
+func (t *CycleStats) emit(aggregate telegraf.Metric, ms []telegraf.Metric, groupkey string) []telegraf.Metric {
+	t.applyUnitsProfile(aggregate)
+	t.applyRenames(aggregate)
+	return t.finish(aggregate, ms, groupkey)
+}
+
+// finish reshapes an aggregate with its fields in their final names for the
+// outputs and returns the metrics to emit for it.
+func (t *CycleStats) finish(aggregate telegraf.Metric, ms []telegraf.Metric, groupkey string) []telegraf.Metric {
+	if !t.trim(aggregate) {
+		t.releaseSources(ms, false)
+		return nil
+	}
+	t.applyPreset(aggregate)
+	t.applyNaming(aggregate)
+	t.applyTimestamp(aggregate, ms)
+	t.recordHistory(aggregate)
+	t.publishSummary(aggregate)
+
+	return t.chunk(t.trackAggregate(aggregate, ms), groupkey)
+}
+
+func (c *CycleStats) Aggregate(ms []telegraf.Metric) (telegraf.Metric, error) {
+	aggregate, cols, err := c.aggregate(ms)
+	if err != nil {
+		return nil, err
+	}
+	releaseColumns(cols)
+	return aggregate, nil
+}
+
+// aggregate merges the metrics of a group into one metric, taking the last
+// value of every field, and returns it with the gathered field values to be
+// released with releaseColumns. It fails if there is nothing to aggregate.
+func (c *CycleStats) aggregate(ms []telegraf.Metric) (telegraf.Metric, *columns, error) {
+	if len(ms) == 0 {
+		return nil, nil, fmt.Errorf("no metrics to aggregate")
+	}
+
+	cols := c.gatherColumns(ms)
+	first := ms[0]
+	// The tags are added from the sorted tag list, which unlike Tags does
+	// not build a map
+	aggregate := metric.New(first.Name(), nil, nil, first.Time(), first.Type())
+	for _, tag := range first.TagList() {
+		aggregate.AddTag(tag.Key, tag.Value)
+	}
+	for col, field := range cols.order {
+		aggregate.AddField(field, cols.last[col])
+	}
+
+	// Tags removed because of a conflict must not be re-added by later metrics
+	dropped := make(map[string]bool)
+	for _, m := range ms[1:] {
+		c.mergeTags(aggregate, m, dropped)
+	}
+
+	if len(aggregate.FieldList()) == 0 {
+		releaseColumns(cols)
+		return nil, nil, fmt.Errorf("no fields to aggregate in %d metrics of %q", len(ms), first.Name())
+	}
+	return aggregate, cols, nil
+}
+
+// mergeTags adds the allowed tags of m to the aggregate, resolving values
+// that differ from the ones already present according to the conflict policy.
+func (c *CycleStats) mergeTags(metric, m telegraf.Metric, dropped map[string]bool) {
+	if c.tagFilter == nil {
+		return
+	}
+
+	for _, tag := range m.TagList() {
+		if !c.tagFilter.Match(tag.Key) || dropped[tag.Key] {
+			continue
+		}
+
+		value, ok := metric.GetTag(tag.Key)
+		if !ok {
+			metric.AddTag(tag.Key, tag.Value)
+			continue
+		}
+		if value == tag.Value {
+			continue
+		}
+
+		switch c.TagConflict {
+		case "last":
+			metric.AddTag(tag.Key, tag.Value)
+		case "drop":
+			metric.RemoveTag(tag.Key)
+			dropped[tag.Key] = true
+		}
 	}
-	return metric, nil
 }
 
 func init() {
-	processors.Add("cyclestats", func() telegraf.Processor {
+	processors.AddStreaming("cyclestats", func() telegraf.StreamingProcessor {
 		return New()
 	})
 }
@@ -0,0 +1,132 @@
+package cyclestats
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// debugGroup describes a group in the cache for the debug endpoint.
+type debugGroup struct {
+	Key          string    `json:"key"`
+	Measurement  string    `json:"measurement"`
+	Device       string    `json:"device"`
+	Metrics      int       `json:"metrics"`
+	Fields       int       `json:"fields"`
+	Complete     bool      `json:"complete"`
+	OldestMetric time.Time `json:"oldest_metric"`
+	NewestMetric time.Time `json:"newest_metric"`
+	// AgeSeconds is the time since the group was last updated, if known
+	AgeSeconds *float64 `json:"age_seconds,omitempty"`
+}
+
+type debugCache struct {
+	Shard  int          `json:"shard"`
+	Groups []debugGroup `json:"groups"`
+}
+
+// startDebugListener serves the cache contents of the processor and its
+// shards as JSON on DebugListen under /debug/cache.
+func (t *CycleStats) startDebugListener() error {
+	if t.DebugListen == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", t.DebugListen)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/cache", t.serveDebugCache)
+	t.debugServer = &http.Server{Handler: mux}
+	go func() {
+		if err := t.debugServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			t.Log.Errorf("Debug listener failed: %v", err)
+		}
+	}()
+	t.Log.Infof("Serving the cache on http://%s/debug/cache", listener.Addr())
+	return nil
+}
+
+func (t *CycleStats) stopDebug() {
+	if t.debugServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.debugServer.Shutdown(ctx); err != nil {
+		t.Log.Errorf("Could not stop debug listener: %v", err)
+	}
+	t.debugServer = nil
+}
+
+func (t *CycleStats) serveDebugCache(w http.ResponseWriter, _ *http.Request) {
+	processors := []*CycleStats{t}
+	if len(t.workers) > 0 {
+		processors = processors[:0]
+		for _, w := range t.workers {
+			processors = append(processors, w.processor)
+		}
+	}
+
+	caches := make([]debugCache, 0, len(processors))
+	for i, p := range processors {
+		caches = append(caches, debugCache{Shard: i, Groups: p.debugGroups()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(caches); err != nil {
+		t.Log.Errorf("Could not write debug response: %v", err)
+	}
+}
+
+// debugGroups describes the groups in the cache, holding off Apply while
+// reading it.
+func (t *CycleStats) debugGroups() []debugGroup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	groups := make([]debugGroup, 0, len(t.cache))
+	for groupkey, ms := range t.cache {
+		if len(ms) == 0 {
+			continue
+		}
+		g := debugGroup{
+			Key:          groupkey,
+			Measurement:  ms[0].Name(),
+			Device:       t.deviceID(ms[0]),
+			Metrics:      len(ms),
+			Complete:     t.isComplete(groupkey),
+			OldestMetric: ms[0].Time(),
+			NewestMetric: ms[0].Time(),
+		}
+		fields := make(map[string]bool)
+		for _, m := range ms {
+			for _, field := range m.FieldList() {
+				fields[field.Key] = true
+			}
+			if m.Time().Before(g.OldestMetric) {
+				g.OldestMetric = m.Time()
+			}
+			if m.Time().After(g.NewestMetric) {
+				g.NewestMetric = m.Time()
+			}
+		}
+		g.Fields = len(fields)
+		if updated, ok := t.updated[groupkey]; ok {
+			age := now.Sub(updated).Seconds()
+			g.AgeSeconds = &age
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
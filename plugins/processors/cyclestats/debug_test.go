@@ -0,0 +1,69 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestServeDebugCache(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Expiry = config.Duration(time.Hour)
+		p.DropOriginal = true
+	})
+
+	start := time.Unix(1600000000, 0)
+	applyAll(p,
+		steamStats(nil, "flows", int64(1), start.Add(500*time.Millisecond)),
+		steamStats(nil, "pd_timeouts", int64(0), start),
+		steamStats(map[string]string{"id": "2"}, "flows", int64(3), start),
+	)
+
+	rec := httptest.NewRecorder()
+	p.serveDebugCache(rec, nil)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %q", ct)
+	}
+	var caches []debugCache
+	if err := json.Unmarshal(rec.Body.Bytes(), &caches); err != nil {
+		t.Fatal(err)
+	}
+	if len(caches) != 1 || len(caches[0].Groups) != 2 {
+		t.Fatalf("got caches %+v, want one with 2 groups", caches)
+	}
+
+	tests := []struct {
+		device  string
+		metrics int
+		fields  int
+		oldest  time.Time
+		newest  time.Time
+	}{
+		{device: "1", metrics: 2, fields: 2, oldest: start, newest: start.Add(500 * time.Millisecond)},
+		{device: "2", metrics: 1, fields: 1, oldest: start, newest: start},
+	}
+	for _, tt := range tests {
+		var g *debugGroup
+		for i := range caches[0].Groups {
+			if caches[0].Groups[i].Device == tt.device {
+				g = &caches[0].Groups[i]
+			}
+		}
+		if g == nil {
+			t.Errorf("no group of device %q", tt.device)
+			continue
+		}
+		if g.Measurement != "steam_stats" || g.Metrics != tt.metrics || g.Fields != tt.fields || g.Complete {
+			t.Errorf("group of device %q: %+v", tt.device, g)
+		}
+		if !g.OldestMetric.Equal(tt.oldest) || !g.NewestMetric.Equal(tt.newest) {
+			t.Errorf("group of device %q spans %v to %v, want %v to %v", tt.device, g.OldestMetric, g.NewestMetric, tt.oldest, tt.newest)
+		}
+		if g.AgeSeconds == nil || *g.AgeSeconds < 0 || *g.AgeSeconds > 60 {
+			t.Errorf("group of device %q updated %v seconds ago", tt.device, g.AgeSeconds)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cyclestats
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// prevCycle holds the values of the delta_prev_fields of the last flushed
+// cycle of a series.
+type prevCycle struct {
+	values  map[string]interface{}
+	flushed time.Time
+}
+
+// addDeltaPrev adds the difference of each of the delta_prev_fields to its
+// value in the previous cycle of the aggregate's series as
+// <field>_delta_prev. Previous cycles flushed longer than delta_prev_ttl ago
+// are forgotten, so the first cycle after a pause has no delta.
+func (t *CycleStats) addDeltaPrev(aggregate telegraf.Metric) {
+	if len(t.DeltaPrevFields) == 0 {
+		return
+	}
+	now := time.Now()
+	t.expireDeltaPrev(now)
+
+	key := t.slidingKey(aggregate)
+	prev, ok := t.prevCycles[key]
+	if ok && now.Sub(prev.flushed) > time.Duration(t.DeltaPrevTTL) {
+		ok = false
+	}
+	cur := &prevCycle{values: make(map[string]interface{}, len(t.DeltaPrevFields)), flushed: now}
+
+	for _, field := range t.DeltaPrevFields {
+		value, found := aggregate.GetField(field)
+		if !found {
+			continue
+		}
+		if _, numeric := toFloat(value); !numeric {
+			continue
+		}
+		cur.values[field] = value
+		if !ok {
+			continue
+		}
+		if before, found := prev.values[field]; found {
+			aggregate.AddField(field+"_delta_prev", deltaValue(before, value))
+		}
+	}
+	t.prevCycles[key] = cur
+}
+
+// deltaValue returns the difference of two numeric field values, an integer
+// if both are.
+func deltaValue(before, after interface{}) interface{} {
+	b, bok := before.(int64)
+	a, aok := after.(int64)
+	if bok && aok {
+		return a - b
+	}
+	x, _ := toFloat(before)
+	y, _ := toFloat(after)
+	return y - x
+}
+
+// expireDeltaPrev drops the previous cycles older than delta_prev_ttl, such
+// as those of devices that disappeared. They are checked at most twice per
+// delta_prev_ttl.
+func (t *CycleStats) expireDeltaPrev(now time.Time) {
+	ttl := time.Duration(t.DeltaPrevTTL)
+	if now.Sub(t.lastPrevExpiry) < ttl/2 {
+		return
+	}
+	t.lastPrevExpiry = now
+
+	for key, prev := range t.prevCycles {
+		if now.Sub(prev.flushed) > ttl {
+			delete(t.prevCycles, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestDeltaPrev(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.DeltaPrevFields = []string{"cook_temp", "flows", "door"}
+	})
+
+	steps := []struct {
+		device string
+		fields map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			device: "1",
+			fields: map[string]interface{}{"cook_temp": 121.0, "flows": int64(10), "door": "closed"},
+			want:   map[string]interface{}{},
+		},
+		{
+			// Other devices are other series
+			device: "2",
+			fields: map[string]interface{}{"cook_temp": 100.0},
+			want:   map[string]interface{}{},
+		},
+		{
+			device: "1",
+			fields: map[string]interface{}{"cook_temp": 120.5, "flows": int64(7), "door": "open"},
+			want:   map[string]interface{}{"cook_temp_delta_prev": -0.5, "flows_delta_prev": int64(-3)},
+		},
+		{
+			// Mixed types are compared as floats
+			device: "1",
+			fields: map[string]interface{}{"flows": 9.5},
+			want:   map[string]interface{}{"flows_delta_prev": 2.5},
+		},
+		{
+			// Only the previous cycle counts, not the last value of a field
+			device: "1",
+			fields: map[string]interface{}{"cook_temp": 122.0},
+			want:   map[string]interface{}{},
+		},
+	}
+	for i, step := range steps {
+		aggregate := metric.New("steam_params", map[string]string{"id": step.device}, step.fields, time.Unix(1600000000, 0))
+		p.addDeltaPrev(aggregate)
+
+		got := aggregate.Fields()
+		for field := range step.fields {
+			delete(got, field)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: got deltas %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestDeltaPrevTTL(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.DeltaPrevFields = []string{"cook_temp"}
+	})
+	cycle := func(device string) {
+		p.addDeltaPrev(metric.New("steam_params", map[string]string{"id": device},
+			map[string]interface{}{"cook_temp": 121.0}, time.Unix(1600000000, 0)))
+	}
+	cycle("1")
+	cycle("2")
+
+	// The previous cycle of a device gone for longer than the TTL is
+	// forgotten
+	key := p.slidingKey(metric.New("steam_params", map[string]string{"id": "1"}, nil, time.Unix(0, 0)))
+	p.prevCycles[key].flushed = time.Now().Add(-2 * time.Hour)
+	p.lastPrevExpiry = time.Time{}
+	p.expireDeltaPrev(time.Now())
+	if _, ok := p.prevCycles[key]; ok {
+		t.Errorf("previous cycle of the device gone kept")
+	}
+	if len(p.prevCycles) != 1 {
+		t.Errorf("kept %d previous cycles, want 1", len(p.prevCycles))
+	}
+}
@@ -0,0 +1,138 @@
+package cyclestats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// downtimeTracker follows when devices last reported, shared between shards.
+type downtimeTracker struct {
+	mu       sync.Mutex
+	lastSeen map[string]deviceSeen
+	// down holds the devices a downtime start was reported for
+	down map[string]bool
+	// downtime holds the seconds of closed downtime windows since the last
+	// flush per device
+	downtime map[string]float64
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// deviceSeen is the time of the last metric of a device and when it was
+// received. Idle times are measured on the wall clock since the metric was
+// received and events are timestamped on the device's clock.
+type deviceSeen struct {
+	last time.Time
+	seen time.Time
+}
+
+func newDowntimeTracker() *downtimeTracker {
+	return &downtimeTracker{
+		lastSeen: make(map[string]deviceSeen),
+		down:     make(map[string]bool),
+		downtime: make(map[string]float64),
+	}
+}
+
+func (t *CycleStats) downtimeEvent(device, event string, fields map[string]interface{}, ts time.Time) telegraf.Metric {
+	return metric.New("cyclestats_downtime", map[string]string{"event": event, t.DeviceTag: device}, fields, ts)
+}
+
+// recordSeen notes that the device of a metric reported and returns an end
+// event if this closes a downtime window, that is if the device was reported
+// down or went silent for longer than IdleTimeout.
+func (t *CycleStats) recordSeen(m telegraf.Metric) []telegraf.Metric {
+	if t.IdleTimeout <= 0 {
+		return nil
+	}
+	device := t.deviceID(m)
+	if device == "" {
+		return nil
+	}
+
+	d := t.downtime
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, ok := d.lastSeen[device]
+	if ok && !m.Time().After(prev.last) {
+		return nil
+	}
+	d.lastSeen[device] = deviceSeen{last: m.Time(), seen: time.Now()}
+	if !ok {
+		return nil
+	}
+
+	gap := m.Time().Sub(prev.last)
+	if !d.down[device] && gap <= time.Duration(t.IdleTimeout) {
+		return nil
+	}
+	delete(d.down, device)
+	d.downtime[device] += gap.Seconds()
+
+	return []telegraf.Metric{
+		t.downtimeEvent(device, "end", map[string]interface{}{"duration_seconds": gap.Seconds()}, m.Time()),
+	}
+}
+
+// checkIdle returns a start event for every device silent for longer than
+// IdleTimeout at the wall-clock time now.
+func (t *CycleStats) checkIdle(now time.Time) []telegraf.Metric {
+	d := t.downtime
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := make([]telegraf.Metric, 0)
+	for device, seen := range d.lastSeen {
+		idle := now.Sub(seen.seen)
+		if d.down[device] || idle <= time.Duration(t.IdleTimeout) {
+			continue
+		}
+		d.down[device] = true
+		ts := deviceClock(seen.last, seen.seen, now)
+		events = append(events, t.downtimeEvent(device, "start", map[string]interface{}{"idle_seconds": idle.Seconds()}, ts))
+	}
+	return events
+}
+
+// takeDowntime returns the downtime accumulated per device since the last
+// flush.
+func (t *CycleStats) takeDowntime() []telegraf.Metric {
+	if t.IdleTimeout <= 0 {
+		return nil
+	}
+
+	d := t.downtime
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]telegraf.Metric, 0, len(d.downtime))
+	for device, seconds := range d.downtime {
+		out = append(out, t.downtimeEvent(device, "period", map[string]interface{}{"downtime_seconds": seconds}, d.lastSeen[device].last))
+	}
+	d.downtime = make(map[string]float64)
+	return out
+}
+
+// watchIdle reports devices going silent until Stop is called.
+func (t *CycleStats) watchIdle(acc telegraf.Accumulator) {
+	d := t.downtime
+	defer d.done.Done()
+
+	ticker := time.NewTicker(time.Duration(t.IdleTimeout) / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			for _, m := range t.checkIdle(now) {
+				acc.AddMetric(m)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestDowntime(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) { p.IdleTimeout = config.Duration(5 * time.Minute) })
+
+	start := time.Unix(1600000000, 0)
+	seen := func(offset time.Duration) []telegraf.Metric {
+		return p.recordSeen(metric.New("steam_stats", map[string]string{"id": "1"},
+			map[string]interface{}{"flows": int64(1)}, start.Add(offset)))
+	}
+	event := func(ms []telegraf.Metric) (string, map[string]interface{}) {
+		if len(ms) != 1 {
+			return "", nil
+		}
+		e, _ := ms[0].GetTag("event")
+		return e, ms[0].Fields()
+	}
+
+	if out := seen(0); len(out) != 0 {
+		t.Errorf("first metric ended a downtime: %v", out)
+	}
+	if out := seen(time.Minute); len(out) != 0 {
+		t.Errorf("metric within the idle timeout ended a downtime: %v", out)
+	}
+	// Late metrics do not count
+	if out := seen(-time.Hour); len(out) != 0 {
+		t.Errorf("late metric ended a downtime: %v", out)
+	}
+	if e, fields := event(seen(11 * time.Minute)); e != "end" || fields["duration_seconds"] != 600.0 {
+		t.Errorf("got %s event %v after a gap, want end of 600 seconds", e, fields)
+	}
+
+	// A device silent on the wall clock is reported down once, and its next
+	// metric ends the downtime
+	now := time.Now().Add(6 * time.Minute)
+	if e, _ := event(p.checkIdle(now)); e != "start" {
+		t.Errorf("got %q event for a silent device, want start", e)
+	}
+	if out := p.checkIdle(now.Add(time.Minute)); len(out) != 0 {
+		t.Errorf("downtime started again: %v", out)
+	}
+	if e, fields := event(seen(12 * time.Minute)); e != "end" || fields["duration_seconds"] != 60.0 {
+		t.Errorf("got %s event %v after going down, want end of 60 seconds", e, fields)
+	}
+
+	if e, fields := event(p.takeDowntime()); e != "period" || fields["downtime_seconds"] != 660.0 {
+		t.Errorf("got %s event %v, want period of 660 seconds", e, fields)
+	}
+	if out := p.takeDowntime(); len(out) != 0 {
+		t.Errorf("downtime taken twice: %v", out)
+	}
+}
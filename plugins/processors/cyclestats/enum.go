@@ -0,0 +1,83 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Enum translates the numeric states of a field into labels added to the
+// aggregate as a tag or field.
+type Enum struct {
+	Field   string            `toml:"field"`
+	Dest    string            `toml:"dest"`
+	As      string            `toml:"as"`
+	Default string            `toml:"default"`
+	Values  map[string]string `toml:"values"`
+}
+
+func (e *Enum) init() error {
+	if e.Field == "" {
+		return fmt.Errorf("enum field must not be empty")
+	}
+	if e.Dest == "" {
+		e.Dest = e.Field + "_label"
+	}
+	switch e.As {
+	case "":
+		e.As = "tag"
+	case "tag", "field":
+	default:
+		return fmt.Errorf("invalid as %q for enum of %q", e.As, e.Field)
+	}
+	return nil
+}
+
+// enumKey formats a field value as it is written in the values of an enum,
+// with integral floats written as integers.
+func enumKey(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10), true
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// applyEnums adds the labels of the aggregate's enum fields. States without
+// a label get the default label, or none if it is empty.
+func (t *CycleStats) applyEnums(aggregate telegraf.Metric) {
+	for _, e := range t.Enums {
+		value, ok := aggregate.GetField(e.Field)
+		if !ok {
+			continue
+		}
+		key, ok := enumKey(value)
+		if !ok {
+			continue
+		}
+		label, ok := e.Values[key]
+		if !ok {
+			label = e.Default
+		}
+		if label == "" {
+			continue
+		}
+		if e.As == "field" {
+			aggregate.AddField(e.Dest, label)
+		} else {
+			aggregate.AddTag(e.Dest, label)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestApplyEnums(t *testing.T) {
+	states := map[string]string{"0": "idle", "1": "heating", "2": "cooking", "true": "on"}
+	tests := []struct {
+		name   string
+		enum   Enum
+		value  interface{}
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{
+			name:  "tag",
+			enum:  Enum{Field: "state", Values: states},
+			value: int64(2),
+			tags:  map[string]string{"state_label": "cooking"},
+		},
+		{
+			name:   "field",
+			enum:   Enum{Field: "state", Dest: "phase", As: "field", Values: states},
+			value:  uint64(1),
+			tags:   map[string]string{},
+			fields: map[string]interface{}{"phase": "heating"},
+		},
+		{
+			name:  "integral float",
+			enum:  Enum{Field: "state", Values: states},
+			value: 1.0,
+			tags:  map[string]string{"state_label": "heating"},
+		},
+		{
+			name:  "boolean",
+			enum:  Enum{Field: "state", Values: states},
+			value: true,
+			tags:  map[string]string{"state_label": "on"},
+		},
+		{
+			name:  "default",
+			enum:  Enum{Field: "state", Default: "unknown", Values: states},
+			value: int64(9),
+			tags:  map[string]string{"state_label": "unknown"},
+		},
+		{
+			name:  "no label",
+			enum:  Enum{Field: "state", Values: states},
+			value: 1.5,
+			tags:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.enum
+			p := newTestProcessor(t, func(p *CycleStats) { p.Enums = []*Enum{&e} })
+
+			aggregate := metric.New("steam", nil, map[string]interface{}{"state": tt.value}, time.Unix(1600000000, 0))
+			p.applyEnums(aggregate)
+			if !reflect.DeepEqual(aggregate.Tags(), tt.tags) {
+				t.Errorf("got tags %v, want %v", aggregate.Tags(), tt.tags)
+			}
+			want := map[string]interface{}{"state": tt.value}
+			for k, v := range tt.fields {
+				want[k] = v
+			}
+			if !reflect.DeepEqual(aggregate.Fields(), want) {
+				t.Errorf("got fields %v, want %v", aggregate.Fields(), want)
+			}
+		})
+	}
+}
+
+func TestEnumInit(t *testing.T) {
+	tests := []struct {
+		enum Enum
+		ok   bool
+	}{
+		{enum: Enum{Field: "state"}, ok: true},
+		{enum: Enum{Field: "state", As: "field"}, ok: true},
+		{enum: Enum{}},
+		{enum: Enum{Field: "state", As: "label"}},
+	}
+	for _, tt := range tests {
+		if err := tt.enum.init(); (err == nil) != tt.ok {
+			t.Errorf("enum %+v: got error %v, want ok %v", tt.enum, err, tt.ok)
+		}
+	}
+}
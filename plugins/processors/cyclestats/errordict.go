@@ -0,0 +1,145 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/influxdata/telegraf"
+)
+
+// errorEntry describes an error code of the dictionary.
+type errorEntry struct {
+	Message  string `json:"message" toml:"message"`
+	Category string `json:"category" toml:"category"`
+}
+
+// errorDictionary holds the error codes loaded from a file, e.g. in TOML
+//
+//	[12]
+//	  message = "Top lid failed to open"
+//	  category = "lid"
+//
+// and reloads them when the file changes. It is shared between shards.
+type errorDictionary struct {
+	path     string
+	interval time.Duration
+
+	sync.Mutex
+	entries   map[string]errorEntry
+	modTime   time.Time
+	lastCheck time.Time
+	// failed holds why the file could not be reloaded, until it reloads
+	failed error
+}
+
+func loadErrorEntries(path string) (map[string]errorEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]errorEntry)
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(b, &entries)
+	case ".toml":
+		err = toml.Unmarshal(b, &entries)
+	default:
+		return nil, fmt.Errorf("unsupported error dictionary format %q, expected .json or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func openErrorDictionary(path string, interval time.Duration) (*errorDictionary, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadErrorEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	return &errorDictionary{
+		path:      path,
+		interval:  interval,
+		entries:   entries,
+		modTime:   info.ModTime(),
+		lastCheck: time.Now(),
+	}, nil
+}
+
+// lookup returns the entry of an error code, reloading the dictionary first
+// if the file changed since it was last checked, at most once per interval.
+// A dictionary that fails to reload is kept, and the error is returned until
+// the file reloads.
+func (d *errorDictionary) lookup(code string, log telegraf.Logger) (errorEntry, bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if now := time.Now(); d.interval > 0 && now.Sub(d.lastCheck) >= d.interval {
+		d.lastCheck = now
+		if info, err := os.Stat(d.path); err != nil {
+			if d.failed == nil {
+				log.Errorf("Could not check error dictionary: %v", err)
+			}
+			d.failed = err
+		} else if !info.ModTime().Equal(d.modTime) {
+			entries, err := loadErrorEntries(d.path)
+			if err != nil {
+				log.Errorf("Could not reload error dictionary, keeping the previous one: %v", err)
+				d.failed = err
+			} else {
+				d.entries = entries
+				d.failed = nil
+				log.Infof("Reloaded %d error codes", len(entries))
+			}
+			d.modTime = info.ModTime()
+		}
+	}
+
+	entry, ok := d.entries[code]
+	return entry, ok, d.failed
+}
+
+// describeError tags an aggregate of the error_measurements with a nonzero
+// error field with the error_message and error_category of its code in the
+// dictionary. Lookups in a dictionary that fails to reload degrade the
+// health of the processor.
+func (t *CycleStats) describeError(aggregate telegraf.Metric) {
+	if t.errors == nil || !t.errorMeasurements.Match(aggregate.Name()) {
+		return
+	}
+	value, ok := aggregate.GetField("error")
+	if !ok {
+		return
+	}
+	if v, ok := toFloat(value); ok && v == 0 {
+		return
+	}
+	code, ok := enumKey(value)
+	if !ok {
+		return
+	}
+
+	entry, ok, err := t.errors.lookup(code, t.Log)
+	if err != nil {
+		t.reportProblem(problemEnrichment)
+	}
+	if !ok {
+		return
+	}
+	if entry.Message != "" {
+		aggregate.AddTag("error_message", entry.Message)
+	}
+	if entry.Category != "" {
+		aggregate.AddTag("error_category", entry.Category)
+	}
+}
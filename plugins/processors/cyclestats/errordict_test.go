@@ -0,0 +1,141 @@
+package cyclestats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+const lidErrors = `
+[12]
+  message = "Top lid failed to open"
+  category = "lid"
+`
+
+// writeDictionary writes an error dictionary, dated mod so that reloads see
+// the change.
+func writeDictionary(t *testing.T, path, content string, mod time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newDictionaryProcessor(t *testing.T, reload time.Duration) (*CycleStats, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "errors.toml")
+	writeDictionary(t, path, lidErrors, time.Unix(1600000000, 0))
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.ErrorDictionary = path
+		p.ErrorDictionaryReload = config.Duration(reload)
+	})
+	return p, path
+}
+
+// describe returns the error tags added to an aggregate of a measurement
+// with an error code.
+func describe(p *CycleStats, measurement string, code interface{}) map[string]string {
+	aggregate := metric.New(measurement, map[string]string{"id": "1"}, map[string]interface{}{"error": code}, time.Unix(1600000000, 0))
+	p.describeError(aggregate)
+	return aggregate.Tags()
+}
+
+func TestDescribeError(t *testing.T) {
+	p, _ := newDictionaryProcessor(t, 0)
+
+	tests := []struct {
+		name        string
+		measurement string
+		code        interface{}
+		message     string
+		category    string
+	}{
+		{
+			name:        "steam_stats",
+			measurement: "steam_stats",
+			code:        int64(12),
+			message:     "Top lid failed to open",
+			category:    "lid",
+		},
+		{
+			name:        "vessel_lid_failure",
+			measurement: "vessel_lid_failure",
+			code:        12.0,
+			message:     "Top lid failed to open",
+			category:    "lid",
+		},
+		{
+			name:        "other measurement",
+			measurement: "steam_params",
+			code:        int64(12),
+		},
+		{
+			name:        "no error",
+			measurement: "steam_stats",
+			code:        int64(0),
+		},
+		{
+			name:        "unknown code",
+			measurement: "steam_stats",
+			code:        int64(13),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := describe(p, tt.measurement, tt.code)
+			if tags["error_message"] != tt.message {
+				t.Errorf("error_message %q, want %q", tags["error_message"], tt.message)
+			}
+			if tags["error_category"] != tt.category {
+				t.Errorf("error_category %q, want %q", tags["error_category"], tt.category)
+			}
+		})
+	}
+}
+
+func TestErrorDictionaryReload(t *testing.T) {
+	p, path := newDictionaryProcessor(t, time.Nanosecond)
+
+	writeDictionary(t, path, lidErrors+`
+[13]
+  message = "Bottom lid failed to close"
+  category = "lid"
+`, time.Unix(1600000060, 0))
+	if tags := describe(p, "steam_stats", int64(13)); tags["error_message"] != "Bottom lid failed to close" {
+		t.Errorf("code added to the file not reloaded: %v", tags)
+	}
+	if status, _ := p.healthMetric(time.Now()).GetTag("status"); status != "ok" {
+		t.Errorf("health %q after reloading, want ok", status)
+	}
+
+	// A broken file keeps the codes loaded before, but degrades the health
+	// until it is fixed
+	writeDictionary(t, path, "[13", time.Unix(1600000120, 0))
+	for i := 0; i < 2; i++ {
+		if tags := describe(p, "steam_stats", int64(13)); tags["error_message"] != "Bottom lid failed to close" {
+			t.Errorf("codes lost when the file failed to reload: %v", tags)
+		}
+	}
+	m := p.healthMetric(time.Now())
+	if count, _ := m.GetField(problemEnrichment); count != int64(2) {
+		t.Errorf("enrichment failed %v times, want 2", count)
+	}
+
+	writeDictionary(t, path, lidErrors, time.Unix(1600000180, 0))
+	if tags := describe(p, "steam_stats", int64(13)); tags["error_message"] != "" {
+		t.Errorf("code removed from the file still known: %v", tags)
+	}
+	m = p.healthMetric(time.Now())
+	if count, _ := m.GetField(problemEnrichment); count != int64(0) {
+		t.Errorf("enrichment failed %v times after the file was fixed, want 0", count)
+	}
+}
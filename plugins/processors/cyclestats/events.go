@@ -0,0 +1,97 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// cycleEventMeasurement holds the cycle start and end events, shaped to be
+// used as Grafana annotations: the title and text fields describe the event
+// and the tags filter them.
+const cycleEventMeasurement = "cyclestats_event"
+
+// cycleStartEvent returns a start event when a metric opens a new cycle of
+// its device, that is the device has no cycle in progress.
+func (t *CycleStats) cycleStartEvent(m telegraf.Metric) []telegraf.Metric {
+	if !t.CycleEvents {
+		return nil
+	}
+	device := t.deviceID(m)
+	if t.openCycles[device] {
+		return nil
+	}
+	t.openCycles[device] = true
+
+	tags := t.cycleEventTags("start", m)
+	text := fmt.Sprintf("Cycle of %s started", device)
+	if id, ok := tags["cycle_id"]; ok {
+		text = fmt.Sprintf("Cycle %s of %s started", id, device)
+	}
+	return []telegraf.Metric{t.cycleEvent(tags, "Cycle started", text, m.Time())}
+}
+
+// noteCycleEnd keeps the aggregate describing the end of its device's cycle,
+// preferring the one classified with a result.
+func (t *CycleStats) noteCycleEnd(aggregate telegraf.Metric) {
+	if !t.CycleEvents {
+		return
+	}
+	device := t.deviceID(aggregate)
+	if noted, ok := t.endingCycles[device]; ok && noted.HasTag(cycleResultTag) {
+		return
+	}
+	t.endingCycles[device] = aggregate
+}
+
+// cycleEndEvents returns the end events of the cycles flushed since the last
+// call.
+func (t *CycleStats) cycleEndEvents() []telegraf.Metric {
+	if !t.CycleEvents || len(t.endingCycles) == 0 {
+		return nil
+	}
+
+	events := make([]telegraf.Metric, 0, len(t.endingCycles))
+	for device, aggregate := range t.endingCycles {
+		delete(t.endingCycles, device)
+		delete(t.openCycles, device)
+
+		tags := t.cycleEventTags("end", aggregate)
+		text := fmt.Sprintf("Cycle of %s ended", device)
+		if id, ok := tags["cycle_id"]; ok {
+			text = fmt.Sprintf("Cycle %s of %s ended", id, device)
+		}
+		if result, ok := tags["result"]; ok {
+			text += ": " + result
+		}
+		events = append(events, t.cycleEvent(tags, "Cycle ended", text, aggregate.Time()))
+	}
+	return events
+}
+
+// cycleEventTags returns the tags of an event for the cycle m belongs to.
+func (t *CycleStats) cycleEventTags(event string, m telegraf.Metric) map[string]string {
+	tags := map[string]string{"event": event}
+	if device, ok := m.GetTag(t.DeviceTag); ok {
+		tags[t.DeviceTag] = device
+	}
+	if id, ok := m.GetTag(t.CycleIDTag); ok {
+		tags["cycle_id"] = id
+	}
+	if wasteType, ok := m.GetTag("waste_type"); ok {
+		tags["waste_type"] = wasteType
+	}
+	if result, ok := m.GetTag(cycleResultTag); ok {
+		tags["result"] = result
+	}
+	return tags
+}
+
+func (t *CycleStats) cycleEvent(tags map[string]string, title, text string, ts time.Time) telegraf.Metric {
+	return metric.New(cycleEventMeasurement, tags, map[string]interface{}{
+		"title": title,
+		"text":  text,
+	}, ts)
+}
@@ -0,0 +1,60 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestCycleEvents(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) { p.CycleEvents = true })
+
+	ts := time.Unix(1600000000, 0)
+	source := func(device, cycle string) telegraf.Metric {
+		return metric.New("steam_stats", map[string]string{"id": device, "steam_cycle": cycle, "waste_type": "mixed"},
+			map[string]interface{}{"flows": int64(1)}, ts)
+	}
+
+	// Only the first metric of a device starts a cycle
+	start := p.cycleStartEvent(source("1", "17"))
+	if len(start) != 1 {
+		t.Fatalf("got %v for the first metric, want a start event", start)
+	}
+	wantTags := map[string]string{"event": "start", "id": "1", "cycle_id": "17", "waste_type": "mixed"}
+	if !reflect.DeepEqual(start[0].Tags(), wantTags) {
+		t.Errorf("start event tags %v, want %v", start[0].Tags(), wantTags)
+	}
+	if text, _ := start[0].GetField("text"); text != "Cycle 17 of 1 started" {
+		t.Errorf("start event text %q", text)
+	}
+	if out := p.cycleStartEvent(source("1", "17")); len(out) != 0 {
+		t.Errorf("cycle in progress started again: %v", out)
+	}
+
+	// The aggregate with a result describes the end of the cycle
+	classified := source("1", "17")
+	classified.AddTag(cycleResultTag, "aborted")
+	p.noteCycleEnd(classified)
+	p.noteCycleEnd(source("1", "17"))
+	end := p.cycleEndEvents()
+	if len(end) != 1 {
+		t.Fatalf("got %v, want an end event", end)
+	}
+	if text, _ := end[0].GetField("text"); text != "Cycle 17 of 1 ended: aborted" {
+		t.Errorf("end event text %q", text)
+	}
+	if result, _ := end[0].GetTag("result"); result != "aborted" {
+		t.Errorf("end event result %q, want aborted", result)
+	}
+	if out := p.cycleEndEvents(); len(out) != 0 {
+		t.Errorf("cycle ended twice: %v", out)
+	}
+
+	// The next metric starts the next cycle
+	if out := p.cycleStartEvent(source("1", "18")); len(out) != 1 {
+		t.Errorf("got %v after the cycle ended, want a start event", out)
+	}
+}
@@ -0,0 +1,79 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func validateEWMA(fields []string, alpha float64) error {
+	if len(fields) > 0 && (alpha <= 0 || alpha > 1) {
+		return fmt.Errorf("ewma_alpha must be in (0, 1], got %v", alpha)
+	}
+	return nil
+}
+
+// ewmaSeries holds the moving averages of a series and when it was last
+// flushed.
+type ewmaSeries struct {
+	averages map[string]float64
+	updated  time.Time
+}
+
+// addEWMA adds the exponentially weighted moving average of each of the
+// ewma_fields over the flushed cycles of the aggregate's series as
+// <field>_ewma. The first cycle of a series starts the average at its value.
+// Incomplete cycles would drag the average, so they are left out.
+func (t *CycleStats) addEWMA(aggregate telegraf.Metric) {
+	if len(t.EWMAFields) == 0 {
+		return
+	}
+	if incomplete, _ := aggregate.GetTag("incomplete"); incomplete == "true" {
+		return
+	}
+	now := time.Now()
+	t.expireEWMA(now)
+
+	key := t.slidingKey(aggregate)
+	series, ok := t.ewma[key]
+	if !ok || now.Sub(series.updated) > time.Duration(t.EWMATTL) {
+		series = &ewmaSeries{averages: make(map[string]float64, len(t.EWMAFields))}
+		t.ewma[key] = series
+	}
+	series.updated = now
+	averages := series.averages
+
+	for _, field := range t.EWMAFields {
+		value, ok := aggregate.GetField(field)
+		if !ok {
+			continue
+		}
+		v, ok := toFloat(value)
+		if !ok {
+			continue
+		}
+		if avg, ok := averages[field]; ok {
+			v = t.EWMAAlpha*v + (1-t.EWMAAlpha)*avg
+		}
+		averages[field] = v
+		aggregate.AddField(field+"_ewma", v)
+	}
+}
+
+// expireEWMA drops the averages of series not flushed within ewma_ttl, such
+// as those of devices that disappeared. They are checked at most twice per
+// ewma_ttl.
+func (t *CycleStats) expireEWMA(now time.Time) {
+	ttl := time.Duration(t.EWMATTL)
+	if now.Sub(t.lastEWMAExpiry) < ttl/2 {
+		return
+	}
+	t.lastEWMAExpiry = now
+
+	for key, series := range t.ewma {
+		if now.Sub(series.updated) > ttl {
+			delete(t.ewma, key)
+		}
+	}
+}
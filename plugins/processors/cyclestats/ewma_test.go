@@ -0,0 +1,84 @@
+package cyclestats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestEWMA(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.EWMAFields = []string{"cook_temp"}
+		p.EWMAAlpha = 0.5
+	})
+
+	steps := []struct {
+		device     string
+		cookTemp   interface{}
+		incomplete bool
+		// want is the average added, NaN for none
+		want float64
+	}{
+		{device: "1", cookTemp: 120.0, want: 120},
+		{device: "1", cookTemp: int64(122), want: 121},
+		{device: "2", cookTemp: 100.0, want: 100},
+		// Incomplete cycles are left out
+		{device: "1", cookTemp: 80.0, incomplete: true, want: math.NaN()},
+		{device: "1", cookTemp: 125.0, want: 123},
+		{device: "1", cookTemp: "n/a", want: math.NaN()},
+	}
+	for i, step := range steps {
+		tags := map[string]string{"id": step.device}
+		if step.incomplete {
+			tags["incomplete"] = "true"
+		}
+		aggregate := metric.New("steam_params", tags, map[string]interface{}{"cook_temp": step.cookTemp}, time.Unix(1600000000, 0))
+		p.addEWMA(aggregate)
+
+		got, ok := aggregate.GetField("cook_temp_ewma")
+		if ok != !math.IsNaN(step.want) || ok && got != step.want {
+			t.Errorf("step %d: average %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestEWMATTL(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.EWMAFields = []string{"cook_temp"}
+		p.EWMAAlpha = 0.5
+	})
+	cycle := func(temp float64) interface{} {
+		aggregate := metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"cook_temp": temp}, time.Unix(1600000000, 0))
+		p.addEWMA(aggregate)
+		avg, _ := aggregate.GetField("cook_temp_ewma")
+		return avg
+	}
+	cycle(120)
+	for _, series := range p.ewma {
+		series.updated = time.Now().Add(-2 * time.Hour)
+	}
+
+	// The average of a series paused for longer than the TTL starts over
+	if avg := cycle(100); avg != 100.0 {
+		t.Errorf("average %v after a pause, want 100", avg)
+	}
+}
+
+func TestValidateEWMA(t *testing.T) {
+	tests := []struct {
+		alpha float64
+		ok    bool
+	}{
+		{alpha: 0.3, ok: true},
+		{alpha: 1, ok: true},
+		{alpha: 0},
+		{alpha: 1.5},
+	}
+	for _, tt := range tests {
+		if err := validateEWMA([]string{"cook_temp"}, tt.alpha); (err == nil) != tt.ok {
+			t.Errorf("alpha %v: got error %v, want ok %v", tt.alpha, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package cyclestats
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+// compileExcludes compiles the exclude_fields globs per measurement, with
+// the globs under "*" applying to all measurements.
+func (t *CycleStats) compileExcludes() error {
+	t.excludeFilters = make(map[string]filter.Filter, len(t.ExcludeFields))
+	for measurement, fields := range t.ExcludeFields {
+		f, err := filter.Compile(fields)
+		if err != nil {
+			return fmt.Errorf("could not compile exclude_fields of %q: %v %v", measurement, fields, err)
+		}
+		if f != nil {
+			t.excludeFilters[measurement] = f
+		}
+	}
+	return nil
+}
+
+// excludeFields strips the excluded fields from a metric before it is
+// cached, so they never reach the aggregates.
+func (t *CycleStats) excludeFields(m telegraf.Metric) {
+	if len(t.excludeFilters) == 0 {
+		return
+	}
+
+	scoped := t.excludeFilters[m.Name()]
+	all := t.excludeFilters[allMeasurements]
+
+	// Removing fields shifts the field list, so the fields are collected
+	// before any is removed
+	var excluded []string
+	for _, field := range m.FieldList() {
+		if (scoped != nil && scoped.Match(field.Key)) || (all != nil && all.Match(field.Key)) {
+			excluded = append(excluded, field.Key)
+		}
+	}
+	for _, key := range excluded {
+		m.RemoveField(key)
+	}
+}
@@ -0,0 +1,52 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestExcludeFields(t *testing.T) {
+	excludes := map[string][]string{
+		"*":            {"debug_*"},
+		"steam_params": {"raw_temp", "pv_*"},
+	}
+	tests := []struct {
+		name        string
+		measurement string
+		fields      map[string]interface{}
+		want        map[string]interface{}
+	}{
+		{
+			name:        "scoped and all",
+			measurement: "steam_params",
+			fields:      map[string]interface{}{"cook_temp": 121.3, "raw_temp": 4711.0, "pv_unsafe": false, "debug_tick": int64(7)},
+			want:        map[string]interface{}{"cook_temp": 121.3},
+		},
+		{
+			name:        "all only",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"raw_temp": 4711.0, "debug_tick": int64(7)},
+			want:        map[string]interface{}{"raw_temp": 4711.0},
+		},
+		{
+			name:        "nothing excluded",
+			measurement: "grinder",
+			fields:      map[string]interface{}{"reversals": int64(2)},
+			want:        map[string]interface{}{"reversals": int64(2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) { p.ExcludeFields = excludes })
+
+			m := metric.New(tt.measurement, nil, tt.fields, time.Unix(1600000000, 0))
+			p.excludeFields(m)
+			if got := m.Fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package cyclestats
+
+import (
+	"time"
+)
+
+// touchGroup records that a group was updated, for expiring stale groups
+// and closing the cycles of inactive devices.
+func (t *CycleStats) touchGroup(groupkey string) {
+	if t.Expiry > 0 || t.CloseAfter > 0 {
+		t.updated[groupkey] = time.Now()
+	}
+}
+
+// expireGroups drops the groups not updated within Expiry, such as the
+// partial cycles of devices that disappeared. Groups are checked at most
+// twice per Expiry.
+func (t *CycleStats) expireGroups() {
+	if t.Expiry <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(t.lastExpiry) < time.Duration(t.Expiry)/2 {
+		return
+	}
+	t.lastExpiry = now
+
+	expired := 0
+	for groupkey, updated := range t.updated {
+		if now.Sub(updated) <= time.Duration(t.Expiry) {
+			continue
+		}
+		t.releaseSources(t.cache[groupkey], false)
+		delete(t.cache, groupkey)
+		delete(t.keys, groupkey)
+		delete(t.updated, groupkey)
+		delete(t.running, groupkey)
+		delete(t.sharedSynced, groupkey)
+		expired++
+	}
+	if expired > 0 {
+		t.Log.Warnf("Dropped %d groups not updated within %s", expired, time.Duration(t.Expiry))
+		t.reportProblem(problemEviction)
+	}
+}
@@ -0,0 +1,53 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestExpireGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		groups int
+	}{
+		{name: "disabled", groups: 2},
+		{name: "not expired", expiry: time.Hour, groups: 2},
+		{name: "expired", expiry: 20 * time.Millisecond, groups: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Expiry = config.Duration(tt.expiry)
+				p.DropOriginal = true
+			})
+
+			start := time.Unix(1600000000, 0)
+			if out := applyAll(p, steamStats(nil, "flows", int64(10), start)); len(out) != 0 {
+				t.Fatalf("open cycle flushed: %v", out)
+			}
+			time.Sleep(30 * time.Millisecond)
+
+			// Expired groups are dropped, not flushed
+			other := steamStats(map[string]string{"id": "2"}, "flows", int64(3), start)
+			if out := applyAll(p, other); len(out) != 0 {
+				t.Fatalf("got metrics after expiry: %v", out)
+			}
+			if len(p.cache) != tt.groups {
+				t.Fatalf("got %d groups, want %d", len(p.cache), tt.groups)
+			}
+			if len(p.updated) > tt.groups {
+				t.Errorf("got update times of %d groups, want at most %d", len(p.updated), tt.groups)
+			}
+			if tt.groups == 1 {
+				for _, ms := range p.cache {
+					if device, _ := ms[0].GetTag("id"); device != "2" {
+						t.Errorf("kept the group of device %q, want 2", device)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+// FieldSet replaces the configured fields of the measurements it lists for
+// the metrics whose tag has one of the values, so devices of a mixed fleet
+// reporting different fields can share an instance.
+type FieldSet struct {
+	Tag    string              `toml:"tag"`
+	Values []string            `toml:"values"`
+	Fields map[string][]string `toml:"fields"`
+
+	filter filter.Filter
+	fields *compiledFields
+}
+
+// compiledFields splits the fields of each measurement into exact names and
+// glob patterns.
+type compiledFields struct {
+	fields  map[string][]string
+	exact   map[string]map[string]bool
+	filters map[string]filter.Filter
+}
+
+func compileFields(fields map[string][]string) (*compiledFields, error) {
+	if err := validateFields(fields); err != nil {
+		return nil, err
+	}
+
+	c := &compiledFields{
+		fields:  fields,
+		exact:   make(map[string]map[string]bool, len(fields)),
+		filters: make(map[string]filter.Filter, len(fields)),
+	}
+	for measurement, names := range fields {
+		exact := make(map[string]bool, len(names))
+		patterns := make([]string, 0)
+		for _, f := range names {
+			if strings.ContainsAny(f, "*?[") {
+				patterns = append(patterns, f)
+			} else {
+				exact[f] = true
+			}
+		}
+		c.exact[measurement] = exact
+
+		f, err := filter.Compile(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("could not compile fields of %q: %v %v", measurement, patterns, err)
+		}
+		if f != nil {
+			c.filters[measurement] = f
+		}
+	}
+	return c, nil
+}
+
+// validateFields checks that every measurement has fields and no name is
+// empty.
+func validateFields(fields map[string][]string) error {
+	for measurement, names := range fields {
+		if measurement == "" {
+			return fmt.Errorf("fields with an empty measurement name")
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("fields of %q must not be empty", measurement)
+		}
+		for _, name := range names {
+			if name == "" {
+				return fmt.Errorf("fields of %q contain an empty field name", measurement)
+			}
+		}
+	}
+	return nil
+}
+
+// match reports whether a field is configured for the measurement, and
+// whether it is configured by its exact name rather than a glob pattern.
+func (c *compiledFields) match(measurement, field string) (matched, exact bool) {
+	if c.exact[measurement][field] {
+		return true, true
+	}
+	if f, ok := c.filters[measurement]; ok && f.Match(field) {
+		return true, false
+	}
+	return false, false
+}
+
+// compileFieldSets compiles the fields table and the field sets.
+func (t *CycleStats) compileFieldSets() error {
+	var err error
+	if t.fields, err = compileFields(t.Fields); err != nil {
+		return err
+	}
+
+	for _, s := range t.FieldSets {
+		if s.Tag == "" || len(s.Values) == 0 || len(s.Fields) == 0 {
+			return fmt.Errorf("field_set requires a tag, values and fields")
+		}
+		if s.filter, err = filter.Compile(s.Values); err != nil {
+			return fmt.Errorf("could not compile field_set values of %q: %v %v", s.Tag, s.Values, err)
+		}
+		if s.fields, err = compileFields(s.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldsOf returns the fields configured for the metric's measurement, by
+// the first field set selecting the metric or the fields table.
+func (t *CycleStats) fieldsOf(m telegraf.Metric) *compiledFields {
+	for _, s := range t.FieldSets {
+		if _, ok := s.Fields[m.Name()]; !ok {
+			continue
+		}
+		if value, ok := m.GetTag(s.Tag); ok && s.filter.Match(value) {
+			return s.fields
+		}
+	}
+	return t.fields
+}
+
+// matchField reports whether a field of the metric is configured, and
+// whether it is configured by its exact name rather than a glob pattern.
+func (t *CycleStats) matchField(m telegraf.Metric, field string) (matched, exact bool) {
+	return t.fieldsOf(m).match(m.Name(), field)
+}
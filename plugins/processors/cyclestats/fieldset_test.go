@@ -0,0 +1,135 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestMatchField(t *testing.T) {
+	fields, err := compileFields(map[string][]string{
+		"steam_params": {"cook_temp", "*_temp", "drain_to_sec?"},
+		"grinder":      {"reversal[sc]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		measurement string
+		field       string
+		matched     bool
+		exact       bool
+	}{
+		{measurement: "steam_params", field: "cook_temp", matched: true, exact: true},
+		{measurement: "steam_params", field: "control_temp", matched: true},
+		{measurement: "steam_params", field: "drain_to_sec2", matched: true},
+		{measurement: "steam_params", field: "drain_to_sec12"},
+		{measurement: "steam_params", field: "temperature"},
+		{measurement: "grinder", field: "reversals", matched: true},
+		{measurement: "grinder", field: "reversalx"},
+		{measurement: "grinder", field: "cook_temp"},
+		{measurement: "steam_stats", field: "cook_temp"},
+	}
+	for _, tt := range tests {
+		matched, exact := fields.match(tt.measurement, tt.field)
+		if matched != tt.matched || exact != tt.exact {
+			t.Errorf("%s.%s: matched %v exact %v, want %v %v", tt.measurement, tt.field, matched, exact, tt.matched, tt.exact)
+		}
+	}
+}
+
+func TestCompileFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string][]string
+		ok     bool
+	}{
+		{name: "names and patterns", fields: map[string][]string{"steam": {"cook_temp", "*_temp"}}, ok: true},
+		{name: "empty measurement", fields: map[string][]string{"": {"cook_temp"}}},
+		{name: "no fields", fields: map[string][]string{"steam": {}}},
+		{name: "empty field", fields: map[string][]string{"steam": {""}}},
+		{name: "invalid pattern", fields: map[string][]string{"steam": {"cook_[temp"}}},
+	}
+	for _, tt := range tests {
+		_, err := compileFields(tt.fields)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestGlobFields(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Fields = map[string][]string{"steam_params": {"cook_temp", "*_temp"}}
+		p.DropOriginal = true
+	})
+
+	// The metric matching only a pattern counts towards the completion
+	ts := time.Unix(1600000000, 0)
+	out := applyAll(p,
+		metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"control_temp": 120.9}, ts),
+		metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"cook_temp": 121.3}, ts),
+	)
+	if len(out) != 1 {
+		t.Fatalf("got %d aggregates, want 1: %v", len(out), out)
+	}
+	if !out[0].HasField("control_temp") || !out[0].HasField("cook_temp") {
+		t.Errorf("aggregate %v misses fields", out[0])
+	}
+}
+
+func TestFieldSets(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Fields = map[string][]string{"steam_params": {"cook_temp", "control_temp"}}
+		p.FieldSets = []*FieldSet{{
+			Tag:    "model",
+			Values: []string{"mini-*"},
+			Fields: map[string][]string{"steam_params": {"cook_temp"}},
+		}}
+	})
+
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		field   string
+		matched bool
+		fields  int
+	}{
+		{name: "fields table", tags: map[string]string{"model": "pro-2"}, field: "control_temp", matched: true, fields: 2},
+		{name: "no tag", tags: map[string]string{}, field: "control_temp", matched: true, fields: 2},
+		{name: "field set", tags: map[string]string{"model": "mini-1"}, field: "control_temp", fields: 1},
+		{name: "field set field", tags: map[string]string{"model": "mini-1"}, field: "cook_temp", matched: true, fields: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metric.New("steam_params", tt.tags, map[string]interface{}{tt.field: 120.5}, time.Unix(1600000000, 0))
+			if matched, _ := p.matchField(m, tt.field); matched != tt.matched {
+				t.Errorf("matched %v, want %v", matched, tt.matched)
+			}
+			if n := len(p.fieldsOf(m).fields["steam_params"]); n != tt.fields {
+				t.Errorf("%d fields configured, want %d", n, tt.fields)
+			}
+		})
+	}
+}
+
+func TestFieldSetsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		set  *FieldSet
+	}{
+		{name: "no tag", set: &FieldSet{Values: []string{"mini"}, Fields: map[string][]string{"steam": {"f"}}}},
+		{name: "no values", set: &FieldSet{Tag: "model", Fields: map[string][]string{"steam": {"f"}}}},
+		{name: "no fields", set: &FieldSet{Tag: "model", Values: []string{"mini"}}},
+		{name: "empty field", set: &FieldSet{Tag: "model", Values: []string{"mini"}, Fields: map[string][]string{"steam": {""}}}},
+	}
+	for _, tt := range tests {
+		p := New()
+		p.FieldSets = []*FieldSet{tt.set}
+		if err := p.compileFieldSets(); err == nil {
+			t.Errorf("%s: field set accepted", tt.name)
+		}
+	}
+}
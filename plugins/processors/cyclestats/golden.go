@@ -0,0 +1,59 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/influxdata/telegraf"
+)
+
+// loadGoldenProfile reads the baselines of a known-good machine, in the
+// format written by baseline_export, to score cycles against.
+func loadGoldenProfile(location string) (map[string]map[string]*fieldBaseline, error) {
+	b, err := readLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	model := newBaselineModel()
+	if err := json.Unmarshal(b, model); err != nil {
+		return nil, err
+	}
+	return model.Baselines, nil
+}
+
+// scoreGolden adds the z-score of every field with a golden baseline as
+// "<field>_zscore" and their root mean square as deviation_score.
+func (t *CycleStats) scoreGolden(aggregate telegraf.Metric) {
+	baselines, ok := t.golden[aggregate.Name()]
+	if !ok {
+		return
+	}
+
+	scores := make(map[string]float64)
+	for _, field := range aggregate.FieldList() {
+		b, ok := baselines[field.Key]
+		if !ok {
+			continue
+		}
+		v, ok := toFloat(field.Value)
+		if !ok {
+			continue
+		}
+		stddev := b.stddev()
+		if stddev == 0 {
+			continue
+		}
+		scores[field.Key] = (v - b.Mean) / stddev
+	}
+	if len(scores) == 0 {
+		return
+	}
+
+	var sum float64
+	for field, z := range scores {
+		aggregate.AddField(field+"_zscore", z)
+		sum += z * z
+	}
+	aggregate.AddField("deviation_score", math.Sqrt(sum/float64(len(scores))))
+}
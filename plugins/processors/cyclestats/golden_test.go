@@ -0,0 +1,78 @@
+package cyclestats
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestScoreGolden(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "golden.json")
+	baselines := `{"baselines": {"steam_stats": {
+		"flows": {"count": 3, "mean": 10, "m2": 8},
+		"cook_temp": {"count": 5, "mean": 100, "m2": 64},
+		"pd_timeouts": {"count": 1, "mean": 0, "m2": 0}
+	}}}`
+	if err := os.WriteFile(profile, []byte(baselines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := loadGoldenProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &CycleStats{golden: golden}
+
+	tests := []struct {
+		name        string
+		measurement string
+		fields      map[string]interface{}
+		want        map[string]float64
+	}{
+		{
+			name:        "single field",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"flows": int64(14)},
+			want:        map[string]float64{"flows_zscore": 2, "deviation_score": 2},
+		},
+		{
+			name:        "root mean square",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"flows": int64(14), "cook_temp": 96.0},
+			want:        map[string]float64{"flows_zscore": 2, "cook_temp_zscore": -1, "deviation_score": math.Sqrt(2.5)},
+		},
+		{
+			// Baselines of a single cycle and non-numeric fields are not scored
+			name:        "unscored fields",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"pd_timeouts": int64(3), "flows": "n/a", "door": "closed"},
+		},
+		{
+			name:        "measurement without baselines",
+			measurement: "grinder",
+			fields:      map[string]interface{}{"flows": int64(14)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregate := metric.New(tt.measurement, map[string]string{"id": "1"}, tt.fields, time.Unix(1600000000, 0))
+			p.scoreGolden(aggregate)
+			if got := len(aggregate.FieldList()) - len(tt.fields); got != len(tt.want) {
+				t.Errorf("got %d scores, want %d: %v", got, len(tt.want), aggregate.Fields())
+			}
+			for field, want := range tt.want {
+				got, _ := aggregate.GetField(field)
+				if g, ok := got.(float64); !ok || math.Abs(g-want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := loadGoldenProfile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("missing golden profile loaded")
+	}
+}
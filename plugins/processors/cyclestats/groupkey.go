@@ -0,0 +1,83 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+)
+
+// parseGroupKey returns the tag driving the grouping of a "tag:<name>"
+// group_key or the sentinel field of a "sentinel:<field>" one, both empty
+// for grouping by time window.
+func parseGroupKey(groupKey string) (tag, sentinel string, err error) {
+	switch {
+	case groupKey == "window":
+		return "", "", nil
+	case strings.HasPrefix(groupKey, "tag:") && len(groupKey) > len("tag:"):
+		return strings.TrimPrefix(groupKey, "tag:"), "", nil
+	case strings.HasPrefix(groupKey, "sentinel:") && len(groupKey) > len("sentinel:"):
+		return "", strings.TrimPrefix(groupKey, "sentinel:"), nil
+	}
+	return "", "", fmt.Errorf("invalid group_key %q, expected \"window\", \"tag:<name>\" or \"sentinel:<field>\"", groupKey)
+}
+
+// cycleOf returns the cycle a metric belongs to and the tag or sentinel
+// field telling it, if the grouping is driven by a tag the metric carries
+// or by a sentinel field already seen for its device.
+func (t *CycleStats) cycleOf(m telegraf.Metric) (cycle, by string, ok bool) {
+	switch {
+	case t.groupTag != "":
+		cycle, ok = m.GetTag(t.groupTag)
+		return cycle, t.groupTag, ok
+	case t.sentinel != "":
+		cycle, ok = t.sessions[t.deviceID(m)]
+		return cycle, t.sentinel, ok
+	}
+	return "", "", false
+}
+
+// cycleDriven reports whether the group of a metric is a cycle tag or
+// sentinel session, which ends only when the device's tag or sentinel
+// changes rather than once the group is complete.
+func (t *CycleStats) cycleDriven(m telegraf.Metric) bool {
+	_, _, ok := t.cycleOf(m)
+	return ok
+}
+
+// detectSession ends the current cycle of the metric's device if the metric
+// carries the cycle tag or the sentinel field with a value other than the
+// current one. The groups of the ended cycle are flushed and their
+// aggregates returned. The groups a device collected by time window before
+// its sentinel field was first seen end with it too.
+func (t *CycleStats) detectSession(m telegraf.Metric) []telegraf.Metric {
+	var session string
+	switch {
+	case t.groupTag != "":
+		var ok bool
+		if session, ok = m.GetTag(t.groupTag); !ok {
+			return nil
+		}
+	case t.sentinel != "":
+		value, ok := m.GetField(t.sentinel)
+		if !ok {
+			return nil
+		}
+		if session, ok = enumKey(value); !ok {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	device := t.deviceID(m)
+	current, started := t.sessions[device]
+	if started && current == session {
+		return nil
+	}
+	t.sessions[device] = session
+	if !started && t.groupTag != "" {
+		return nil
+	}
+	return t.push(map[string]bool{device: true})
+}
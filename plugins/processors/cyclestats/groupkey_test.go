@@ -0,0 +1,106 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// steamStats returns a steam_stats metric of device "1" with a single field.
+func steamStats(tags map[string]string, field string, value interface{}, ts time.Time) telegraf.Metric {
+	all := map[string]string{"id": "1"}
+	for k, v := range tags {
+		all[k] = v
+	}
+	return metric.New("steam_stats", all, map[string]interface{}{field: value}, ts)
+}
+
+// applyAll applies the metrics one by one and returns the metrics emitted.
+func applyAll(p *CycleStats, ms ...telegraf.Metric) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0)
+	for _, m := range ms {
+		out = append(out, p.Apply(m)...)
+	}
+	return out
+}
+
+func TestSentinelSessions(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.GroupKey = "sentinel:stop_cook_count"
+		p.DropOriginal = true
+		p.SampleCounts = true
+	})
+
+	start := time.Unix(1600000000, 0)
+	// All fields of steam_stats, which would complete a time window group
+	session := []telegraf.Metric{
+		steamStats(nil, "stop_cook_count", int64(1), start),
+		steamStats(nil, "error", int64(0), start.Add(time.Second)),
+		steamStats(nil, "flows", int64(10), start.Add(2*time.Second)),
+		steamStats(nil, "pd_timeouts", int64(0), start.Add(3*time.Second)),
+		steamStats(nil, "stag_recoveries", int64(0), start.Add(4*time.Second)),
+	}
+	if out := applyAll(p, session...); len(out) != 0 {
+		t.Fatalf("session flushed before the sentinel changed: %v", out)
+	}
+
+	// Metrics of the session arriving in another window stay in it
+	late := steamStats(nil, "flows", int64(12), start.Add(time.Minute))
+	if out := applyAll(p, late); len(out) != 0 {
+		t.Fatalf("session flushed before the sentinel changed: %v", out)
+	}
+
+	out := applyAll(p, steamStats(nil, "stop_cook_count", int64(2), start.Add(2*time.Minute)))
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics when the sentinel changed, want 1: %v", len(out), out)
+	}
+	if samples, _ := out[0].GetField("samples"); samples != int64(6) {
+		t.Errorf("session aggregated from %v metrics, want 6", samples)
+	}
+	if out[0].HasTag("incomplete") {
+		t.Errorf("session ended by the sentinel tagged incomplete")
+	}
+
+	out = p.flushIncomplete()
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics on shutdown, want 1: %v", len(out), out)
+	}
+	if value, _ := out[0].GetTag("incomplete"); value != "true" {
+		t.Errorf("open session flushed on shutdown not tagged incomplete")
+	}
+}
+
+func TestTagSessions(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.GroupKey = "tag:steam_cycle"
+		p.DropOriginal = true
+		p.SampleCounts = true
+	})
+
+	start := time.Unix(1600000000, 0)
+	first := map[string]string{"steam_cycle": "41"}
+	session := []telegraf.Metric{
+		steamStats(first, "stop_cook_count", int64(1), start),
+		steamStats(first, "error", int64(0), start.Add(time.Second)),
+		steamStats(first, "flows", int64(10), start.Add(2*time.Second)),
+		steamStats(first, "pd_timeouts", int64(0), start.Add(3*time.Second)),
+		steamStats(first, "stag_recoveries", int64(0), start.Add(4*time.Second)),
+	}
+	if out := applyAll(p, session...); len(out) != 0 {
+		t.Fatalf("cycle flushed before its tag changed: %v", out)
+	}
+
+	next := map[string]string{"steam_cycle": "42"}
+	out := applyAll(p, steamStats(next, "stop_cook_count", int64(2), start.Add(time.Minute)))
+	if len(out) != 1 {
+		t.Fatalf("got %d metrics when the tag changed, want 1: %v", len(out), out)
+	}
+	if cycle, _ := out[0].GetTag("steam_cycle"); cycle != "41" {
+		t.Errorf("flushed cycle %q, want 41", cycle)
+	}
+	if samples, _ := out[0].GetField("samples"); samples != int64(5) {
+		t.Errorf("cycle aggregated from %v metrics, want 5", samples)
+	}
+}
@@ -0,0 +1,94 @@
+package cyclestats
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// Problems degrading the health of the processor.
+const (
+	problemMemoryPressure   = "memory_pressure"
+	problemEviction         = "eviction"
+	problemStatePersistence = "state_persistence"
+	problemDelivery         = "delivery"
+	problemEnrichment       = "enrichment"
+)
+
+// healthTracker counts the problems that occurred since the last health
+// report, shared between shards.
+type healthTracker struct {
+	mu       sync.Mutex
+	problems map[string]int64
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{problems: make(map[string]int64)}
+}
+
+// reportProblem records a problem for the next health report.
+func (t *CycleStats) reportProblem(problem string) {
+	t.health.mu.Lock()
+	t.health.problems[problem]++
+	t.health.mu.Unlock()
+}
+
+// healthMetric returns the health of the processor since the last report:
+// status "ok", or "degraded" with the problems that occurred as reasons.
+func (t *CycleStats) healthMetric(now time.Time) telegraf.Metric {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	if t.HealthMemoryLimit > 0 && mem.HeapAlloc > uint64(t.HealthMemoryLimit) {
+		t.reportProblem(problemMemoryPressure)
+	}
+
+	t.health.mu.Lock()
+	problems := t.health.problems
+	t.health.problems = make(map[string]int64)
+	t.health.mu.Unlock()
+
+	fields := map[string]interface{}{
+		"heap_bytes": int64(mem.HeapAlloc),
+	}
+	reasons := make([]string, 0, len(problems))
+	for _, problem := range []string{problemMemoryPressure, problemEviction, problemStatePersistence, problemDelivery, problemEnrichment} {
+		fields[problem] = problems[problem]
+		if problems[problem] > 0 {
+			reasons = append(reasons, problem)
+		}
+	}
+	sort.Strings(reasons)
+
+	status := "ok"
+	if len(reasons) > 0 {
+		status = "degraded"
+	}
+	fields["reasons"] = strings.Join(reasons, ",")
+
+	return metric.New("cyclestats_health", map[string]string{"status": status}, fields, now)
+}
+
+// watchHealth emits a health metric every HealthInterval until Stop is
+// called.
+func (t *CycleStats) watchHealth(acc telegraf.Accumulator) {
+	defer t.health.done.Done()
+
+	ticker := time.NewTicker(time.Duration(t.HealthInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.health.stop:
+			return
+		case now := <-ticker.C:
+			acc.AddMetric(t.healthMetric(now))
+		}
+	}
+}
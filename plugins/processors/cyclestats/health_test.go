@@ -0,0 +1,66 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestHealthMetric(t *testing.T) {
+	p := newTestProcessor(t, func(*CycleStats) {})
+	now := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name     string
+		problems []string
+		limit    config.Size
+		status   string
+		reasons  string
+	}{
+		{
+			name:    "ok",
+			status:  "ok",
+			reasons: "",
+		},
+		{
+			name:     "degraded",
+			problems: []string{problemEnrichment, problemDelivery, problemDelivery},
+			status:   "degraded",
+			reasons:  "delivery,enrichment",
+		},
+		{
+			name:    "recovered",
+			status:  "ok",
+			reasons: "",
+		},
+		{
+			name:    "memory pressure",
+			limit:   1,
+			status:  "degraded",
+			reasons: "memory_pressure",
+		},
+	}
+	for _, tt := range tests {
+		// Each report covers the problems since the one before
+		t.Run(tt.name, func(t *testing.T) {
+			p.HealthMemoryLimit = tt.limit
+			for _, problem := range tt.problems {
+				p.reportProblem(problem)
+			}
+
+			m := p.healthMetric(now)
+			if status, _ := m.GetTag("status"); status != tt.status {
+				t.Errorf("status %q, want %q", status, tt.status)
+			}
+			if reasons, _ := m.GetField("reasons"); reasons != tt.reasons {
+				t.Errorf("reasons %q, want %q", reasons, tt.reasons)
+			}
+			for _, problem := range tt.problems {
+				if count, _ := m.GetField(problem); count.(int64) == 0 {
+					t.Errorf("%s not counted", problem)
+				}
+			}
+		})
+	}
+}
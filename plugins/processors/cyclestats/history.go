@@ -0,0 +1,157 @@
+package cyclestats
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+
+	// SQLite driver without cgo, so the gateway builds stay static
+	_ "modernc.org/sqlite"
+)
+
+const historySchema = `CREATE TABLE IF NOT EXISTS cycles (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	time   INTEGER NOT NULL,
+	name   TEXT NOT NULL,
+	device TEXT NOT NULL,
+	line   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS cycles_device_time ON cycles (device, time);`
+
+// historyPruneEvery is the number of recorded cycles after which the
+// history is pruned.
+const historyPruneEvery = 100
+
+// history records the emitted cycle summaries in a SQLite database on the
+// gateway, for inspecting the last cycles while it is offline.
+type history struct {
+	db        *sql.DB
+	retention time.Duration
+	maxCycles int
+
+	// Cycles are stored as line protocol to keep the field types; shards
+	// share the serializer
+	serializer *serializer.Serializer
+	mu         sync.Mutex
+}
+
+func openHistory(path string, retention time.Duration, maxCycles int) (*history, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &history{
+		db:         db,
+		retention:  retention,
+		maxCycles:  maxCycles,
+		serializer: serializer.NewSerializer(),
+	}, nil
+}
+
+func (h *history) record(device string, aggregate telegraf.Metric) error {
+	h.mu.Lock()
+	line, err := h.serializer.Serialize(aggregate)
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = h.db.Exec("INSERT INTO cycles (time, name, device, line) VALUES (?, ?, ?, ?)",
+		aggregate.Time().UnixNano(), aggregate.Name(), device, string(bytes.TrimSuffix(line, []byte("\n"))))
+	return err
+}
+
+// prune deletes the cycles older than the retention and beyond the maximum
+// number of cycles.
+func (h *history) prune() error {
+	if h.retention > 0 {
+		cutoff := time.Now().Add(-h.retention).UnixNano()
+		if _, err := h.db.Exec("DELETE FROM cycles WHERE time < ?", cutoff); err != nil {
+			return err
+		}
+	}
+	if h.maxCycles > 0 {
+		_, err := h.db.Exec("DELETE FROM cycles WHERE id <= (SELECT id FROM cycles ORDER BY id DESC LIMIT 1 OFFSET ?)", h.maxCycles)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *history) close() error {
+	return h.db.Close()
+}
+
+// QueryHistory returns the last n cycles recorded in the history database at
+// path, latest first, of the given device or of all devices if empty.
+func QueryHistory(path, device string, n int) ([]telegraf.Metric, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT line FROM cycles"
+	args := []interface{}{}
+	if device != "" {
+		query += " WHERE device = ?"
+		args = append(args, device)
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT ?"
+	args = append(args, n)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parser := influx.NewParser(influx.NewMetricHandler())
+	var cycles []telegraf.Metric
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		m, err := parser.ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cycle %q: %v", line, err)
+		}
+		cycles = append(cycles, m)
+	}
+	return cycles, rows.Err()
+}
+
+// recordHistory records an emitted aggregate in the history database and
+// prunes it every historyPruneEvery cycles.
+func (t *CycleStats) recordHistory(aggregate telegraf.Metric) {
+	if t.history == nil {
+		return
+	}
+	if err := t.history.record(t.deviceID(aggregate), aggregate); err != nil {
+		t.Log.Errorf("Could not record cycle history: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return
+	}
+
+	t.historyRecorded++
+	if t.historyRecorded%historyPruneEvery != 0 {
+		return
+	}
+	if err := t.history.prune(); err != nil {
+		t.Log.Errorf("Could not prune cycle history: %v", err)
+		t.reportProblem(problemStatePersistence)
+	}
+}
@@ -0,0 +1,116 @@
+package cyclestats
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// recordCycles records a cycle per minute, ending now, alternating between
+// devices "1" and "2". The flows of the cycles count up from 0.
+func recordCycles(t *testing.T, h *history, n int) {
+	t.Helper()
+
+	start := time.Now().Add(-time.Duration(n-1) * time.Minute)
+	for i := 0; i < n; i++ {
+		device := fmt.Sprint(1 + i%2)
+		m := metric.New("steam_stats", map[string]string{"id": device},
+			map[string]interface{}{"flows": int64(i), "door": "closed"}, start.Add(time.Duration(i)*time.Minute))
+		if err := h.record(device, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func flowsOfCycles(cycles []telegraf.Metric) string {
+	out := make([]interface{}, 0, len(cycles))
+	for _, m := range cycles {
+		v, _ := m.GetField("flows")
+		out = append(out, v)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestQueryHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	h, err := openHistory(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordCycles(t, h, 5)
+	h.close()
+
+	tests := []struct {
+		device string
+		n      int
+		want   string
+	}{
+		{device: "", n: 10, want: "[4 3 2 1 0]"},
+		{device: "", n: 2, want: "[4 3]"},
+		{device: "1", n: 10, want: "[4 2 0]"},
+		{device: "2", n: 1, want: "[3]"},
+		{device: "3", n: 10, want: "[]"},
+	}
+	for _, tt := range tests {
+		cycles, err := QueryHistory(path, tt.device, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := flowsOfCycles(cycles); got != tt.want {
+			t.Errorf("last %d cycles of device %q: flows %s, want %s", tt.n, tt.device, got, tt.want)
+		}
+	}
+
+	// Field types survive the round trip
+	cycles, err := QueryHistory(path, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if door, _ := cycles[0].GetField("door"); door != "closed" {
+		t.Errorf("door %v, want closed", door)
+	}
+	if device, _ := cycles[0].GetTag("id"); device != "1" {
+		t.Errorf("device %q, want 1", device)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention time.Duration
+		maxCycles int
+		want      string
+	}{
+		{name: "unlimited", want: "[5 4 3 2 1 0]"},
+		{name: "retention", retention: 150 * time.Second, want: "[5 4 3]"},
+		{name: "max cycles", maxCycles: 4, want: "[5 4 3 2]"},
+		{name: "both", retention: 150 * time.Second, maxCycles: 2, want: "[5 4]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.db")
+			h, err := openHistory(path, tt.retention, tt.maxCycles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.close()
+
+			recordCycles(t, h, 6)
+			if err := h.prune(); err != nil {
+				t.Fatal(err)
+			}
+
+			cycles, err := QueryHistory(path, "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := flowsOfCycles(cycles); got != tt.want {
+				t.Errorf("kept flows %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
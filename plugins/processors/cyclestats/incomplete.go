@@ -0,0 +1,43 @@
+package cyclestats
+
+import (
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Reasons groups are flushed before their cycle completed.
+const (
+	flushTimeout  = "timeout"
+	flushEviction = "eviction"
+	flushShutdown = "shutdown"
+	flushOverflow = "overflow"
+)
+
+// warnIncomplete logs a group about to be flushed for the given reason if
+// its cycle did not complete, with the missing fields, and counts it in the
+// internal_cyclestats incomplete_flushes field per reason.
+func (t *CycleStats) warnIncomplete(groupkey string, reason string) {
+	ms := t.cache[groupkey]
+	if len(ms) == 0 || t.isComplete(groupkey) {
+		return
+	}
+
+	stat, ok := t.incomplete[reason]
+	if !ok {
+		stat = selfstat.Register("cyclestats", "incomplete_flushes", map[string]string{"reason": reason})
+		t.incomplete[reason] = stat
+	}
+	stat.Incr(1)
+
+	oldest := ms[0].Time()
+	for _, m := range ms[1:] {
+		if m.Time().Before(oldest) {
+			oldest = m.Time()
+		}
+	}
+	missing, _ := t.missingFields(ms...)
+	t.Log.Warnf("Flushing incomplete cycle of device %q on %s: key %q, age %s, missing fields %s",
+		t.deviceID(ms[0]), reason, groupkey, time.Since(oldest).Round(time.Millisecond), strings.Join(missing, ","))
+}
@@ -0,0 +1,56 @@
+package cyclestats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+func TestWarnIncomplete(t *testing.T) {
+	log := &warnings{}
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.DropOriginal = true
+	})
+	p.Log = log
+
+	// Counters are shared between processors
+	stat := selfstat.Register("cyclestats", "incomplete_flushes", map[string]string{"reason": flushShutdown})
+	before := stat.Get()
+
+	start := time.Unix(1600000000, 0)
+	applyAll(p,
+		steamStats(nil, "flows", int64(10), start),
+		steamStats(map[string]string{"id": "2"}, "flows", int64(3), start),
+		steamStats(map[string]string{"id": "2"}, "pd_timeouts", int64(0), start),
+	)
+	if out := p.flushIncomplete(); len(out) != 2 {
+		t.Fatalf("got %d metrics on shutdown, want 2: %v", len(out), out)
+	}
+
+	if got := stat.Get() - before; got != 2 {
+		t.Errorf("counted %d incomplete flushes on shutdown, want 2", got)
+	}
+	if log.count() != 2 {
+		t.Fatalf("logged %d warnings, want 2: %v", log.count(), log.messages)
+	}
+	for _, message := range log.messages {
+		if !strings.Contains(message, "on shutdown") || !strings.Contains(message, "stag_recoveries") {
+			t.Errorf("warning %q without the reason or missing fields", message)
+		}
+		if strings.Contains(message, `device "2"`) && strings.Contains(message, "pd_timeouts") {
+			t.Errorf("warning %q lists a field of the cycle as missing", message)
+		}
+	}
+
+	// Groups flushed as they complete are not warned about
+	log.messages = nil
+	cycle := []string{"stop_cook_count", "error", "flows", "pd_timeouts", "stag_recoveries"}
+	for _, field := range cycle {
+		applyAll(p, steamStats(nil, field, int64(1), start))
+	}
+	if log.count() != 0 {
+		t.Errorf("warned about a complete cycle: %v", log.messages)
+	}
+}
@@ -0,0 +1,131 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// joinPart is the aggregate of one joined measurement waiting for the other
+// measurements of its cycle.
+type joinPart struct {
+	aggregate telegraf.Metric
+	ms        []telegraf.Metric
+	groupkey  string
+}
+
+func validateOutput(output string) error {
+	switch output {
+	case "per_measurement", "merged":
+		return nil
+	}
+	return fmt.Errorf("invalid output %q", output)
+}
+
+func validateJoin(measurements []string) error {
+	seen := make(map[string]bool, len(measurements))
+	for _, name := range measurements {
+		if name == "" {
+			return fmt.Errorf("join must not contain empty measurements")
+		}
+		if seen[name] {
+			return fmt.Errorf("measurement %q joined twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// joins reports whether the aggregates of a measurement are joined, which
+// with the merged output are those of all measurements.
+func (t *CycleStats) joins(measurement string) bool {
+	if t.Output == "merged" {
+		return true
+	}
+	_, ok := t.joinOrder[measurement]
+	return ok
+}
+
+// joinLess orders the joined measurements as listed in join, followed by
+// the others by name.
+func (t *CycleStats) joinLess(a, b string) bool {
+	i, ok := t.joinOrder[a]
+	if !ok {
+		i = len(t.joinOrder)
+	}
+	j, ok := t.joinOrder[b]
+	if !ok {
+		j = len(t.joinOrder)
+	}
+	if i != j {
+		return i < j
+	}
+	return a < b
+}
+
+// holdJoined keeps the aggregate of a joined measurement until the groups of
+// its device are flushed and reports whether it did.
+func (t *CycleStats) holdJoined(aggregate telegraf.Metric, ms []telegraf.Metric, groupkey string) bool {
+	if !t.joins(aggregate.Name()) {
+		return false
+	}
+
+	// Fields are prefixed by their measurement after the per-measurement
+	// reshaping
+	t.applyUnitsProfile(aggregate)
+	t.applyRenames(aggregate)
+	t.joined = append(t.joined, &joinPart{aggregate: aggregate, ms: ms, groupkey: groupkey})
+	return true
+}
+
+// emitJoined joins the held aggregates of the same cycle into one wide
+// metric named JoinName, with the fields prefixed by their measurement, and
+// returns the metrics to emit for them.
+func (t *CycleStats) emitJoined() []telegraf.Metric {
+	if len(t.joined) == 0 {
+		return nil
+	}
+
+	cycles := make(map[string][]*joinPart)
+	var order []string
+	for _, part := range t.joined {
+		cycle := cycleKey(part.groupkey)
+		if _, ok := cycles[cycle]; !ok {
+			order = append(order, cycle)
+		}
+		cycles[cycle] = append(cycles[cycle], part)
+	}
+	t.joined = t.joined[:0]
+
+	out := make([]telegraf.Metric, 0, len(order))
+	for _, cycle := range order {
+		parts := cycles[cycle]
+		sort.SliceStable(parts, func(i, j int) bool {
+			return t.joinLess(parts[i].aggregate.Name(), parts[j].aggregate.Name())
+		})
+
+		first := parts[0].aggregate
+		wide := metric.New(t.JoinName, first.Tags(), nil, first.Time(), first.Type())
+		ms := make([]telegraf.Metric, 0)
+		for _, part := range parts {
+			for _, tag := range part.aggregate.TagList() {
+				if !wide.HasTag(tag.Key) {
+					wide.AddTag(tag.Key, tag.Value)
+				}
+			}
+			for _, field := range part.aggregate.FieldList() {
+				wide.AddField(part.aggregate.Name()+"_"+field.Key, field.Value)
+			}
+			if part.aggregate.Time().Before(wide.Time()) {
+				wide.SetTime(part.aggregate.Time())
+			}
+			ms = append(ms, part.ms...)
+		}
+		// Computed fields may combine the fields of the joined measurements
+		t.computeFields(wide)
+		out = append(out, t.finish(wide, ms, parts[0].groupkey)...)
+	}
+	return out
+}
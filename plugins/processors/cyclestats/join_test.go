@@ -0,0 +1,105 @@
+package cyclestats
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *CycleStats)
+		// want holds the fields of the emitted metrics by name
+		want map[string][]string
+	}{
+		{
+			name:      "per measurement",
+			configure: func(*CycleStats) {},
+			want: map[string][]string{
+				"steam_params": {"control_temp", "cook_temp"},
+				"steam_stats":  {"flows"},
+				"grinder":      {"reversals"},
+			},
+		},
+		{
+			name:      "join",
+			configure: func(p *CycleStats) { p.JoinMeasurements = []string{"steam_stats", "steam_params"} },
+			want: map[string][]string{
+				"cycle":   {"steam_stats_flows", "steam_params_cook_temp", "steam_params_control_temp"},
+				"grinder": {"reversals"},
+			},
+		},
+		{
+			name:      "merged",
+			configure: func(p *CycleStats) { p.Output = "merged" },
+			want: map[string][]string{
+				"cycle": {"grinder_reversals", "steam_params_control_temp", "steam_params_cook_temp", "steam_stats_flows"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Fields = map[string][]string{
+					"steam_params": {"cook_temp", "control_temp"},
+					"steam_stats":  {"flows", "pd_timeouts"},
+					"grinder":      {"reversals", "jack_status"},
+				}
+				p.DropOriginal = true
+				tt.configure(p)
+			})
+
+			// The completed steam_params group flushes the other groups of
+			// the device along with it
+			ts := time.Unix(1600000000, 0)
+			out := applyAll(p,
+				metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"cook_temp": 121.3}, ts),
+				metric.New("grinder", map[string]string{"id": "1"}, map[string]interface{}{"reversals": int64(2)}, ts),
+				metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(10)}, ts),
+				metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"control_temp": 120.9}, ts),
+			)
+
+			got := make(map[string][]string)
+			for _, m := range out {
+				if _, ok := got[m.Name()]; ok {
+					t.Errorf("%s emitted twice", m.Name())
+				}
+				fields := make([]string, 0)
+				for _, field := range m.FieldList() {
+					fields = append(fields, field.Key)
+				}
+				got[m.Name()] = fields
+			}
+			// Measurements not listed in join are ordered by name, their
+			// fields are not
+			for name, fields := range got {
+				if name != "cycle" || len(p.JoinMeasurements) == 0 {
+					sort.Strings(fields)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJoin(t *testing.T) {
+	tests := []struct {
+		join []string
+		ok   bool
+	}{
+		{join: []string{"steam_params", "steam_stats"}, ok: true},
+		{join: []string{"steam_params", ""}},
+		{join: []string{"steam_params", "steam_params"}},
+	}
+	for _, tt := range tests {
+		if err := validateJoin(tt.join); (err == nil) != tt.ok {
+			t.Errorf("join %v: got error %v, want ok %v", tt.join, err, tt.ok)
+		}
+	}
+}
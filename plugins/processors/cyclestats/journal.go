@@ -0,0 +1,200 @@
+package cyclestats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// compactAfter is the number of completed records after which the journal
+// is rewritten with the pending records only.
+const compactAfter = 1000
+
+// journal is an append-only log of emitted aggregates. Each aggregate is
+// written as "+<seq> <line protocol>" before it is emitted and marked as
+// delivered with "-<seq>", so aggregates pending on a crash are replayed on
+// the next start.
+type journal struct {
+	path      string
+	file      *os.File
+	seq       uint64
+	pending   map[uint64]telegraf.Metric
+	completed int
+
+	serializer *serializer.Serializer
+	// mu guards the journal, which is shared between shards
+	mu sync.Mutex
+}
+
+// openJournal reads the pending aggregates from the journal at path and
+// compacts it.
+func openJournal(path string) (*journal, error) {
+	j := &journal{
+		path:       path,
+		pending:    make(map[uint64]telegraf.Metric),
+		serializer: serializer.NewSerializer(),
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+
+		parser := influx.NewParser(influx.NewMetricHandler())
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if len(line) < 2 {
+				continue
+			}
+			parts := strings.SplitN(line[1:], " ", 2)
+			seq, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				// A torn write from a crash, skip it
+				continue
+			}
+			if seq > j.seq {
+				j.seq = seq
+			}
+
+			switch line[0] {
+			case '+':
+				if len(parts) < 2 {
+					continue
+				}
+				m, err := parser.ParseLine(parts[1])
+				if err != nil {
+					continue
+				}
+				j.pending[seq] = m
+			case '-':
+				delete(j.pending, seq)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// compact rewrites the journal with the pending records only. The caller
+// must hold the lock unless the journal is not shared yet.
+func (j *journal) compact() error {
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, seq := range j.sequences() {
+		b, err := j.serializer.Serialize(j.pending[seq])
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "+%d %s", seq, b)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	j.completed = 0
+	return err
+}
+
+func (j *journal) sequences() []uint64 {
+	seqs := make([]uint64, 0, len(j.pending))
+	for seq := range j.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, k int) bool { return seqs[i] < seqs[k] })
+	return seqs
+}
+
+// append durably records an aggregate about to be emitted and returns its
+// sequence number.
+func (j *journal) append(m telegraf.Metric) (uint64, error) {
+	// The serializer reuses its buffer, so it is only used under the lock
+	// like the file
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	b, err := j.serializer.Serialize(m)
+	if err != nil {
+		return 0, err
+	}
+
+	j.seq++
+	if _, err := fmt.Fprintf(j.file, "+%d %s", j.seq, b); err != nil {
+		return 0, err
+	}
+	if err := j.file.Sync(); err != nil {
+		return 0, err
+	}
+	j.pending[j.seq] = m.Copy()
+	return j.seq, nil
+}
+
+// complete marks an aggregate as delivered.
+func (j *journal) complete(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.pending[seq]; !ok {
+		return nil
+	}
+	delete(j.pending, seq)
+
+	if _, err := fmt.Fprintf(j.file, "-%d\n", seq); err != nil {
+		return err
+	}
+	j.completed++
+	if j.completed >= compactAfter {
+		return j.compact()
+	}
+	return nil
+}
+
+// replay returns copies of the pending aggregates in the order they were
+// emitted.
+func (j *journal) replay() []*pendingAggregate {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	replay := make([]*pendingAggregate, 0, len(j.pending))
+	for _, seq := range j.sequences() {
+		replay = append(replay, &pendingAggregate{aggregate: j.pending[seq].Copy(), seq: seq})
+	}
+	return replay
+}
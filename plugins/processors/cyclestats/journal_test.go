@@ -0,0 +1,124 @@
+package cyclestats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestOpenJournal(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		pending []uint64
+		seq     uint64
+	}{
+		{
+			name: "missing",
+		},
+		{
+			name:    "pending",
+			content: "+1 steam cook_temp=120.5 1600000000000000000\n+2 steam cook_temp=121.5 1600000001000000000\n-1\n",
+			pending: []uint64{2},
+			seq:     2,
+		},
+		{
+			name:    "all delivered",
+			content: "+1 steam cook_temp=120.5 1600000000000000000\n-1\n",
+			seq:     1,
+		},
+		{
+			// A crash while writing the last record
+			name:    "torn write",
+			content: "+1 steam cook_temp=120.5 1600000000000000000\n+2 steam cook_te",
+			pending: []uint64{1},
+			seq:     2,
+		},
+		{
+			name:    "garbage",
+			content: "x\n+a steam cook_temp=1\n+3\n+4 steam cook_temp=122.5 1600000002000000000\n",
+			pending: []uint64{4},
+			seq:     4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			j, err := openJournal(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.file.Close()
+
+			got := make([]uint64, 0)
+			for _, p := range j.replay() {
+				got = append(got, p.seq)
+			}
+			if len(got) != len(tt.pending) || len(got) > 0 && !reflect.DeepEqual(got, tt.pending) {
+				t.Errorf("pending %v, want %v", got, tt.pending)
+			}
+			if j.seq != tt.seq {
+				t.Errorf("sequence %d, want %d", j.seq, tt.seq)
+			}
+		})
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1600000000, 0)
+	for i, temp := range []float64{120.5, 121.5, 122.5} {
+		m := metric.New("steam", map[string]string{"id": "1"}, map[string]interface{}{"cook_temp": temp}, start.Add(time.Duration(i)*time.Second))
+		if _, err := j.append(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.complete(2); err != nil {
+		t.Fatal(err)
+	}
+	j.file.Close()
+
+	// The aggregates not delivered before the restart are replayed in order
+	j, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.file.Close()
+
+	replay := j.replay()
+	if len(replay) != 2 {
+		t.Fatalf("replayed %d aggregates, want 2", len(replay))
+	}
+	for i, want := range []float64{120.5, 122.5} {
+		if temp, _ := replay[i].aggregate.GetField("cook_temp"); temp != want {
+			t.Errorf("replayed cook_temp %v, want %v", temp, want)
+		}
+		if device, _ := replay[i].aggregate.GetTag("id"); device != "1" {
+			t.Errorf("replayed device %q, want 1", device)
+		}
+	}
+
+	// Sequence numbers keep increasing across restarts
+	seq, err := j.append(replay[0].aggregate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 4 {
+		t.Errorf("sequence %d after restart, want 4", seq)
+	}
+}
@@ -0,0 +1,129 @@
+package cyclestats
+
+import (
+	"math"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// ServiceItem describes a component that needs service after a given amount
+// of usage. Field holds the usage of a cycle, or the running total of the
+// usage if Counter is set. DutyField holds the seconds the component was
+// active in a cycle.
+type ServiceItem struct {
+	Name        string  `toml:"name"`
+	Measurement string  `toml:"measurement"`
+	Field       string  `toml:"field"`
+	Counter     bool    `toml:"counter"`
+	DutyField   string  `toml:"duty_field"`
+	Interval    float64 `toml:"interval"`
+}
+
+type serviceUsage struct {
+	Usage  float64   `json:"usage"`
+	Cycles int64     `json:"cycles"`
+	Since  time.Time `json:"since"`
+
+	// Active is the number of seconds the component was active
+	Active float64 `json:"active,omitempty"`
+	// Counter is the last value of a counter field
+	Counter *float64 `json:"counter,omitempty"`
+}
+
+// estimateMaintenance adds the usage of a flushed aggregate to the lifetime
+// usage of the matching service items and returns the estimated remaining
+// cycles and days until each of them is due for service.
+func (t *CycleStats) estimateMaintenance(aggregate telegraf.Metric) []telegraf.Metric {
+	if len(t.Service) == 0 {
+		return nil
+	}
+
+	device := t.deviceID(aggregate)
+	estimates := make([]telegraf.Metric, 0)
+	for _, item := range t.Service {
+		if item.Measurement != aggregate.Name() {
+			continue
+		}
+
+		// Without a field every cycle counts as one unit of usage
+		amount := 1.0
+		if item.Field != "" {
+			value, ok := aggregate.GetField(item.Field)
+			if !ok {
+				continue
+			}
+			if amount, ok = toFloat(value); !ok {
+				continue
+			}
+		}
+		var active float64
+		if item.DutyField != "" {
+			if value, ok := aggregate.GetField(item.DutyField); ok {
+				active, _ = toFloat(value)
+			}
+		}
+
+		t.state.mu.Lock()
+		if _, ok := t.state.Usage[device]; !ok {
+			t.state.Usage[device] = make(map[string]*serviceUsage)
+		}
+		usage, ok := t.state.Usage[device][item.Name]
+		if !ok {
+			usage = &serviceUsage{Since: aggregate.Time()}
+			t.state.Usage[device][item.Name] = usage
+		}
+		if item.Counter {
+			amount = usage.increase(amount)
+		}
+		usage.Usage += amount
+		usage.Active += active
+		usage.Cycles++
+		t.state.dirty = true
+		current := *usage
+		t.state.mu.Unlock()
+
+		// Services are assumed to happen on schedule, so usage wraps around
+		// every interval
+		remaining := item.Interval - math.Mod(current.Usage, item.Interval)
+		fields := map[string]interface{}{
+			"usage":           current.Usage,
+			"usage_remaining": remaining,
+		}
+		if current.Usage > 0 {
+			fields["cycles_until_service"] = remaining * float64(current.Cycles) / current.Usage
+		}
+		elapsed := aggregate.Time().Sub(current.Since)
+		if days := elapsed.Hours() / 24; days > 0 && current.Usage > 0 {
+			fields["days_until_service"] = remaining / (current.Usage / days)
+		}
+		if item.DutyField != "" && elapsed > 0 {
+			fields["duty_cycle"] = current.Active / elapsed.Seconds()
+		}
+
+		tags := map[string]string{"service": item.Name}
+		if device != "" {
+			tags[t.DeviceTag] = device
+		}
+		estimates = append(estimates, metric.New("cyclestats_maintenance", tags, fields, aggregate.Time()))
+	}
+
+	return estimates
+}
+
+// increase returns the increase of a counter since its last value, taking a
+// decreasing value as a reset after which the counter increased from zero.
+// The first value only sets the baseline of the counter.
+func (u *serviceUsage) increase(value float64) float64 {
+	last := u.Counter
+	u.Counter = &value
+	switch {
+	case last == nil:
+		return 0
+	case value < *last:
+		return value
+	default:
+		return value - *last
+	}
+}
@@ -0,0 +1,117 @@
+package cyclestats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+)
+
+func TestEstimateMaintenance(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	tests := []struct {
+		name   string
+		item   ServiceItem
+		values []float64
+		// usage after each cycle
+		want []float64
+	}{
+		{
+			name:   "cycles",
+			item:   ServiceItem{},
+			values: []float64{7, 7, 7},
+			want:   []float64{1, 2, 3},
+		},
+		{
+			name:   "gauge",
+			item:   ServiceItem{Field: "reversals"},
+			values: []float64{3, 4, 5},
+			want:   []float64{3, 7, 12},
+		},
+		{
+			name:   "counter",
+			item:   ServiceItem{Field: "reversals", Counter: true},
+			values: []float64{100, 103, 110, 110},
+			want:   []float64{0, 3, 10, 10},
+		},
+		{
+			name:   "counter reset",
+			item:   ServiceItem{Field: "reversals", Counter: true},
+			values: []float64{100, 104, 2, 5},
+			want:   []float64{0, 4, 6, 9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			item.Name = "grinder_blades"
+			item.Measurement = "grinder"
+			item.Interval = 50
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Service = []*ServiceItem{&item}
+			})
+
+			for i, value := range tt.values {
+				aggregate := metric.New("grinder", map[string]string{"id": "1"},
+					map[string]interface{}{"reversals": value}, start.Add(time.Duration(i)*time.Hour))
+				estimates := p.estimateMaintenance(aggregate)
+				if len(estimates) != 1 {
+					t.Fatalf("got %d estimates, want 1", len(estimates))
+				}
+				usage, _ := estimates[0].GetField("usage")
+				if usage != tt.want[i] {
+					t.Errorf("usage after cycle %d is %v, want %v", i, usage, tt.want[i])
+				}
+				remaining, _ := estimates[0].GetField("usage_remaining")
+				if want := 50 - math.Mod(tt.want[i], 50); remaining != want {
+					t.Errorf("usage remaining after cycle %d is %v, want %v", i, remaining, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEstimateMaintenanceDutyCycle(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Service = []*ServiceItem{{
+			Name:        "drain_valve",
+			Measurement: "steam_params",
+			DutyField:   "drain_open_duration",
+			Interval:    100,
+		}}
+	})
+
+	start := time.Unix(1600000000, 0)
+	for i, open := range []float64{60, 120, 180} {
+		aggregate := metric.New("steam_params", map[string]string{"id": "1"},
+			map[string]interface{}{"drain_open_duration": open}, start.Add(time.Duration(i)*time.Hour))
+		estimates := p.estimateMaintenance(aggregate)
+		if len(estimates) != 1 {
+			t.Fatalf("got %d estimates, want 1", len(estimates))
+		}
+
+		// The first cycle only starts the usage
+		duty, ok := estimates[0].GetField("duty_cycle")
+		if i == 0 {
+			if ok {
+				t.Errorf("duty cycle %v of the first cycle", duty)
+			}
+			continue
+		}
+		// Open three minutes per hour on average
+		if duty != 0.05 {
+			t.Errorf("duty cycle after cycle %d is %v, want 0.05", i, duty)
+		}
+	}
+}
+
+func TestServiceItemValidation(t *testing.T) {
+	p := New()
+	p.Log = models.NewLogger("processors", "cyclestats", "")
+	p.Service = []*ServiceItem{{Name: "blades", Measurement: "grinder", Counter: true, Interval: 10}}
+	if err := p.Init(); err == nil {
+		t.Error("no error for a counter service item without a field")
+	}
+}
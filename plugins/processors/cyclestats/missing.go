@@ -0,0 +1,64 @@
+package cyclestats
+
+import (
+	"strings"
+
+	"github.com/influxdata/telegraf"
+)
+
+// missingFields returns the configured fields of the measurement of a group
+// that none of its metrics carries, and the number of fields expected. Glob
+// patterns cannot go missing, only exact field names are expected.
+func (t *CycleStats) missingFields(ms ...telegraf.Metric) ([]string, int) {
+	var missing []string
+	expected := 0
+	for _, field := range t.fieldsOf(ms[0]).fields[ms[0].Name()] {
+		if strings.ContainsAny(field, "*?[") {
+			continue
+		}
+		expected++
+		observed := false
+		for _, m := range ms {
+			if m.HasField(field) {
+				observed = true
+				break
+			}
+		}
+		if !observed {
+			missing = append(missing, field)
+		}
+	}
+	return missing, expected
+}
+
+// reportMissingFields adds the number of configured fields of the
+// aggregate's measurement that were never observed in its group as the
+// missing_fields field, and lists them in MissingFieldsTag if set.
+func (t *CycleStats) reportMissingFields(aggregate telegraf.Metric) {
+	if !t.ReportMissingFields {
+		return
+	}
+
+	missing, _ := t.missingFields(aggregate)
+	aggregate.AddField("missing_fields", int64(len(missing)))
+	if t.MissingFieldsTag != "" && len(missing) > 0 {
+		aggregate.AddTag(t.MissingFieldsTag, strings.Join(missing, ","))
+	}
+}
+
+// addCompleteness adds the share of the configured fields of the aggregate's
+// measurement observed in its group as the completeness_pct field, so
+// partially reported cycles are easy to filter. Measurements configured
+// with glob patterns only are complete.
+func (t *CycleStats) addCompleteness(aggregate telegraf.Metric) {
+	if !t.Completeness {
+		return
+	}
+
+	missing, expected := t.missingFields(aggregate)
+	pct := 100.0
+	if expected > 0 {
+		pct = 100 * float64(expected-len(missing)) / float64(expected)
+	}
+	aggregate.AddField("completeness_pct", pct)
+}
@@ -0,0 +1,95 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestReportMissingFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]interface{}
+		missing int64
+		tag     string
+	}{
+		{
+			name:   "complete",
+			fields: map[string]interface{}{"cook_temp": 121.3, "control_temp": 120.9, "drain_to_sec1": int64(3)},
+		},
+		{
+			name:    "missing",
+			fields:  map[string]interface{}{"control_temp": 120.9},
+			missing: 1,
+			tag:     "cook_temp",
+		},
+		{
+			name:    "all missing",
+			fields:  map[string]interface{}{"unknown": 1.0},
+			missing: 2,
+			tag:     "cook_temp,control_temp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				// Glob patterns cannot go missing
+				p.Fields = map[string][]string{"steam_params": {"cook_temp", "control_temp", "drain_*"}}
+				p.ReportMissingFields = true
+				p.MissingFieldsTag = "missing"
+			})
+
+			aggregate := metric.New("steam_params", nil, tt.fields, time.Unix(1600000000, 0))
+			p.reportMissingFields(aggregate)
+			if missing, _ := aggregate.GetField("missing_fields"); missing != tt.missing {
+				t.Errorf("missing_fields %v, want %d", missing, tt.missing)
+			}
+			if tag, _ := aggregate.GetTag("missing"); tag != tt.tag {
+				t.Errorf("missing tag %q, want %q", tag, tt.tag)
+			}
+		})
+	}
+}
+
+func TestCompleteness(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string][]string
+		values map[string]interface{}
+		want   float64
+	}{
+		{
+			name:   "complete",
+			fields: map[string][]string{"steam_params": {"cook_temp", "control_temp"}},
+			values: map[string]interface{}{"cook_temp": 121.3, "control_temp": 120.9},
+			want:   100,
+		},
+		{
+			name:   "partial",
+			fields: map[string][]string{"steam_params": {"cook_temp", "control_temp", "drain_to_sec1", "drain_to_sec2"}},
+			values: map[string]interface{}{"cook_temp": 121.3},
+			want:   25,
+		},
+		{
+			name:   "patterns only",
+			fields: map[string][]string{"steam_params": {"*_temp"}},
+			values: map[string]interface{}{"flows": int64(1)},
+			want:   100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Fields = tt.fields
+				p.Completeness = true
+			})
+
+			aggregate := metric.New("steam_params", nil, tt.values, time.Unix(1600000000, 0))
+			p.addCompleteness(aggregate)
+			if pct, _ := aggregate.GetField("completeness_pct"); pct != tt.want {
+				t.Errorf("completeness_pct %v, want %v", pct, tt.want)
+			}
+		})
+	}
+}
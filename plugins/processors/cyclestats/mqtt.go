@@ -0,0 +1,151 @@
+package cyclestats
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/tls"
+
+	summary "github.com/TylerHorn/cyclestats/plugins/serializers/cyclestats"
+)
+
+// mqttTimeout bounds the wait for the acknowledgement of a published
+// summary.
+const mqttTimeout = 10 * time.Second
+
+// topicPlaceholder matches the {tag} placeholders of the topic template.
+var topicPlaceholder = regexp.MustCompile(`\{([^{}/+#]+)\}`)
+
+// topicEscaper replaces the level separator and wildcards of MQTT topics in
+// tag values, so a tag cannot add topic levels or make a topic invalid.
+var topicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// publisher publishes the emitted cycle summaries as JSON documents to an
+// MQTT broker.
+type publisher struct {
+	client     mqtt.Client
+	topic      string
+	qos        byte
+	retain     bool
+	serializer *summary.Serializer
+}
+
+func (t *CycleStats) newPublisher() (*publisher, error) {
+	if t.MQTTQoS < 0 || t.MQTTQoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt_qos %d", t.MQTTQoS)
+	}
+	if t.MQTTTopic == "" {
+		return nil, fmt.Errorf("mqtt_topic must not be empty")
+	}
+
+	// Brokers disconnect a client when another connects with its ID, and
+	// the persistent session is resumed by ID, so it is unique per host
+	// and stable across restarts
+	clientID := t.MQTTClientID
+	if clientID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not default mqtt_client_id: %v", err)
+		}
+		clientID = "cyclestats-" + host
+	}
+
+	tlsCfg := tls.ClientConfig{
+		TLSCA:              t.MQTTTLSCA,
+		TLSCert:            t.MQTTTLSCert,
+		TLSKey:             t.MQTTTLSKey,
+		InsecureSkipVerify: t.MQTTInsecureSkipVerify,
+	}
+	tlsConfig, err := tlsCfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := mqtt.NewClientOptions()
+	for _, server := range t.MQTTServers {
+		opts.AddBroker(server)
+	}
+	opts.SetClientID(clientID)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetUsername(t.MQTTUsername)
+	opts.SetPassword(t.MQTTPassword)
+	// Summaries published while the broker is unreachable are queued and
+	// sent once the connection is back
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetCleanSession(false)
+
+	serializer, err := summary.NewSerializer(nil, []string{t.DeviceTag, t.CycleIDTag}, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &publisher{
+		client:     mqtt.NewClient(opts),
+		topic:      t.MQTTTopic,
+		qos:        byte(t.MQTTQoS),
+		retain:     t.MQTTRetain,
+		serializer: serializer,
+	}, nil
+}
+
+// topicOf fills the placeholders of the topic template with the tags of the
+// aggregate. Tags it lacks are filled with "unknown".
+func (p *publisher) topicOf(aggregate telegraf.Metric) string {
+	return topicPlaceholder.ReplaceAllStringFunc(p.topic, func(placeholder string) string {
+		if value, ok := aggregate.GetTag(placeholder[1 : len(placeholder)-1]); ok {
+			return topicEscaper.Replace(value)
+		}
+		return "unknown"
+	})
+}
+
+// startPublisher connects to the broker, retrying in the background.
+func (t *CycleStats) startPublisher() {
+	if t.publisher == nil {
+		return
+	}
+	t.publisher.client.Connect()
+}
+
+func (t *CycleStats) stopPublisher() {
+	if t.publisher == nil {
+		return
+	}
+	t.publisher.client.Disconnect(uint(mqttTimeout / time.Millisecond))
+}
+
+// publishSummary publishes an emitted aggregate as a cycle summary document.
+// The acknowledgement is awaited in the background, so a slow broker does
+// not hold up the processing.
+func (t *CycleStats) publishSummary(aggregate telegraf.Metric) {
+	p := t.publisher
+	if p == nil {
+		return
+	}
+
+	payload, err := p.serializer.Serialize(aggregate)
+	if err != nil {
+		t.Log.Errorf("Could not encode cycle summary: %v", err)
+		return
+	}
+	topic := p.topicOf(aggregate)
+	token := p.client.Publish(topic, p.qos, p.retain, payload)
+	go func() {
+		if !token.WaitTimeout(mqttTimeout) {
+			t.Log.Errorf("Publishing cycle summary to %q timed out", topic)
+			t.reportProblem(problemDelivery)
+			return
+		}
+		if err := token.Error(); err != nil {
+			t.Log.Errorf("Could not publish cycle summary to %q: %v", topic, err)
+			t.reportProblem(problemDelivery)
+		}
+	}()
+}
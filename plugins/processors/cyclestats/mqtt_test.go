@@ -0,0 +1,64 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestTopicOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		topic string
+		tags  map[string]string
+		want  string
+	}{
+		{
+			name:  "tags",
+			topic: "plants/{site}/devices/{id}/cycles",
+			tags:  map[string]string{"site": "hamburg", "id": "7"},
+			want:  "plants/hamburg/devices/7/cycles",
+		},
+		{
+			name:  "missing tag",
+			topic: "plants/{site}/devices/{id}/cycles",
+			tags:  map[string]string{"id": "7"},
+			want:  "plants/unknown/devices/7/cycles",
+		},
+		{
+			name:  "separators and wildcards",
+			topic: "plants/{site}/devices/{id}/cycles",
+			tags:  map[string]string{"site": "a/b", "id": "+#"},
+			want:  "plants/a_b/devices/__/cycles",
+		},
+		{
+			name:  "repeated placeholder",
+			topic: "{id}/{id}",
+			tags:  map[string]string{"id": "7"},
+			want:  "7/7",
+		},
+		{
+			name:  "no placeholders",
+			topic: "cycles",
+			tags:  map[string]string{"id": "7"},
+			want:  "cycles",
+		},
+		{
+			// Not a placeholder, as tag names cannot span levels
+			name:  "braces across levels",
+			topic: "{site/id}",
+			tags:  map[string]string{"site/id": "7"},
+			want:  "{site/id}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &publisher{topic: tt.topic}
+			aggregate := metric.New("steam_stats", tt.tags, map[string]interface{}{"flows": int64(1)}, time.Unix(1600000000, 0))
+			if got := p.topicOf(aggregate); got != tt.want {
+				t.Errorf("topic %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// OEE configures the overall equipment effectiveness computed from the
+// cycles of a measurement.
+type OEE struct {
+	Measurement    string          `toml:"measurement"`
+	DurationField  string          `toml:"duration_field"`
+	FailureField   string          `toml:"failure_field"`
+	IdealCycleTime config.Duration `toml:"ideal_cycle_time"`
+	Period         config.Duration `toml:"period"`
+}
+
+func (o *OEE) init() error {
+	if o.Measurement == "" || o.DurationField == "" {
+		return fmt.Errorf("oee requires a measurement and a duration_field")
+	}
+	if o.IdealCycleTime <= 0 {
+		return fmt.Errorf("oee requires a positive ideal_cycle_time")
+	}
+	if o.FailureField == "" {
+		o.FailureField = "error"
+	}
+	if o.Period == 0 {
+		o.Period = config.Duration(time.Hour)
+	}
+	if o.Period < 0 {
+		return fmt.Errorf("oee period must be positive")
+	}
+	return nil
+}
+
+// oeePeriod accumulates the cycles of a device within a period.
+type oeePeriod struct {
+	start   time.Time
+	cycles  int64
+	good    int64
+	runTime float64
+
+	// last is the time of the latest cycle and seen when it was flushed
+	last time.Time
+	seen time.Time
+}
+
+// computeOEE adds a flushed cycle to the current period of its device and
+// returns the OEE of the previous period once a cycle of a later period
+// arrives. Periods without such a cycle are ended by endOEE.
+func (t *CycleStats) computeOEE(aggregate telegraf.Metric) []telegraf.Metric {
+	if t.OEE == nil || aggregate.Name() != t.OEE.Measurement {
+		return nil
+	}
+
+	value, ok := aggregate.GetField(t.OEE.DurationField)
+	if !ok {
+		return nil
+	}
+	duration, ok := toFloat(value)
+	if !ok {
+		return nil
+	}
+
+	device := t.deviceID(aggregate)
+	start := aggregate.Time().Truncate(time.Duration(t.OEE.Period))
+
+	out := make([]telegraf.Metric, 0, 1)
+	p, ok := t.oee[device]
+	if ok && start.After(p.start) {
+		out = append(out, t.oeeMetric(device, p))
+	}
+	if !ok || start.After(p.start) {
+		p = &oeePeriod{start: start}
+		t.oee[device] = p
+	}
+
+	if aggregate.Time().After(p.last) {
+		p.last = aggregate.Time()
+	}
+	p.seen = time.Now()
+	p.cycles++
+	p.runTime += duration
+	failure := false
+	if value, ok := aggregate.GetField(t.OEE.FailureField); ok {
+		v, numeric := toFloat(value)
+		failure = numeric && v != 0
+	}
+	if !failure {
+		p.good++
+	}
+
+	return out
+}
+
+// endOEE returns the OEE of the periods that ended by now on the clock of
+// their device.
+func (t *CycleStats) endOEE(now time.Time) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0)
+	for device, p := range t.oee {
+		end := p.start.Add(time.Duration(t.OEE.Period))
+		if deviceClock(p.last, p.seen, now).Before(end) {
+			continue
+		}
+		out = append(out, t.oeeMetric(device, p))
+		delete(t.oee, device)
+	}
+	return out
+}
+
+// flushOEE returns the OEE of all open periods on shutdown, tagged as
+// incomplete.
+func (t *CycleStats) flushOEE() []telegraf.Metric {
+	out := make([]telegraf.Metric, 0, len(t.oee))
+	for device, p := range t.oee {
+		m := t.oeeMetric(device, p)
+		m.AddTag("incomplete", "true")
+		out = append(out, m)
+	}
+	t.oee = make(map[string]*oeePeriod)
+	return out
+}
+
+// oeeMetric returns the availability, performance and quality of a period
+// and their product.
+func (t *CycleStats) oeeMetric(device string, p *oeePeriod) telegraf.Metric {
+	planned := time.Duration(t.OEE.Period).Seconds()
+	ideal := time.Duration(t.OEE.IdealCycleTime).Seconds()
+
+	availability := p.runTime / planned
+	var performance, quality float64
+	if p.runTime > 0 {
+		performance = ideal * float64(p.cycles) / p.runTime
+	}
+	if p.cycles > 0 {
+		quality = float64(p.good) / float64(p.cycles)
+	}
+
+	tags := map[string]string{}
+	if device != "" {
+		tags[t.DeviceTag] = device
+	}
+	return metric.New("cyclestats_oee", tags, map[string]interface{}{
+		"availability":     availability,
+		"performance":      performance,
+		"quality":          quality,
+		"oee":              availability * performance * quality,
+		"cycles":           p.cycles,
+		"good_cycles":      p.good,
+		"run_time_seconds": p.runTime,
+	}, p.start)
+}
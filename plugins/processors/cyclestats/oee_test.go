@@ -0,0 +1,104 @@
+package cyclestats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestComputeOEE(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.OEE = &OEE{
+			Measurement:    "steam_stats",
+			DurationField:  "cycle_seconds",
+			IdealCycleTime: config.Duration(10 * time.Minute),
+		}
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	cycle := func(offset time.Duration, seconds float64, errors int64) telegraf.Metric {
+		return metric.New("steam_stats", map[string]string{"id": "1"},
+			map[string]interface{}{"cycle_seconds": seconds, "error": errors}, start.Add(offset))
+	}
+	steps := []struct {
+		cycle telegraf.Metric
+		// oee of the period ended by the cycle, if any
+		oee map[string]interface{}
+	}{
+		{cycle: cycle(5*time.Minute, 900, 0)},
+		{cycle: cycle(25*time.Minute, 1200, 1)},
+		{cycle: metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"cycle_seconds": 600.0}, start)},
+		{cycle: cycle(40*time.Minute, 600, 0)},
+		{
+			cycle: cycle(70*time.Minute, 600, 0),
+			oee: map[string]interface{}{
+				"availability":     0.75,
+				"performance":      1800.0 / 2700,
+				"quality":          2.0 / 3,
+				"oee":              0.75 * 1800 / 2700 * 2 / 3,
+				"cycles":           int64(3),
+				"good_cycles":      int64(2),
+				"run_time_seconds": 2700.0,
+			},
+		},
+	}
+	for i, step := range steps {
+		out := p.computeOEE(step.cycle)
+		if (len(out) > 0) != (step.oee != nil) {
+			t.Fatalf("step %d: got %v, want oee %v", i, out, step.oee)
+		}
+		if step.oee == nil {
+			continue
+		}
+		if !out[0].Time().Equal(start) {
+			t.Errorf("step %d: period starting at %v, want %v", i, out[0].Time(), start)
+		}
+		for field, want := range step.oee {
+			got, _ := out[0].GetField(field)
+			if f, ok := want.(float64); ok {
+				if math.Abs(got.(float64)-f) > 1e-9 {
+					t.Errorf("step %d: %s = %v, want %v", i, field, got, want)
+				}
+				continue
+			}
+			if got != want {
+				t.Errorf("step %d: %s = %v, want %v", i, field, got, want)
+			}
+		}
+	}
+
+	// The period of the last cycle is ended by the clock of the device
+	now := time.Now()
+	if out := p.endOEE(now); len(out) != 0 {
+		t.Errorf("period ended early: %v", out)
+	}
+	if out := p.endOEE(now.Add(time.Hour)); len(out) != 1 || out[0].Fields()["cycles"] != int64(1) {
+		t.Errorf("got %v when the period ended, want its oee", out)
+	}
+	if len(p.oee) != 0 {
+		t.Errorf("ended periods kept: %v", p.oee)
+	}
+}
+
+func TestOEEInit(t *testing.T) {
+	tests := []struct {
+		name string
+		oee  OEE
+		ok   bool
+	}{
+		{name: "valid", oee: OEE{Measurement: "m", DurationField: "d", IdealCycleTime: config.Duration(time.Minute)}, ok: true},
+		{name: "no measurement", oee: OEE{DurationField: "d", IdealCycleTime: config.Duration(time.Minute)}},
+		{name: "no duration field", oee: OEE{Measurement: "m", IdealCycleTime: config.Duration(time.Minute)}},
+		{name: "no ideal cycle time", oee: OEE{Measurement: "m", DurationField: "d"}},
+		{name: "negative period", oee: OEE{Measurement: "m", DurationField: "d", IdealCycleTime: config.Duration(time.Minute), Period: -1}},
+	}
+	for _, tt := range tests {
+		if err := tt.oee.init(); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
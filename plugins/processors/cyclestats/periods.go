@@ -0,0 +1,91 @@
+package cyclestats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// periodCheckInterval is how often ended periods are emitted, unless a
+// period is shorter.
+const periodCheckInterval = time.Minute
+
+// periodTicker emits the per-device periods that ended without a cycle of
+// the next period closing them.
+type periodTicker struct {
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// startPeriods starts emitting ended periods if any are configured. It
+// must be called once the shards are started, as their processors hold the
+// periods.
+func (t *CycleStats) startPeriods(acc telegraf.Accumulator) {
+	if t.OEE == nil && t.TopErrors == nil {
+		return
+	}
+	interval := periodCheckInterval
+	if t.OEE != nil && time.Duration(t.OEE.Period) < interval {
+		interval = time.Duration(t.OEE.Period)
+	}
+	if t.TopErrors != nil && time.Duration(t.TopErrors.Period) < interval {
+		interval = time.Duration(t.TopErrors.Period)
+	}
+
+	processors := []*CycleStats{t}
+	if len(t.workers) > 0 {
+		processors = make([]*CycleStats, 0, len(t.workers))
+		for _, w := range t.workers {
+			processors = append(processors, w.processor)
+		}
+	}
+
+	t.periods.stop = make(chan struct{})
+	t.periods.done.Add(1)
+	go t.watchPeriods(acc, processors, interval)
+}
+
+// watchPeriods emits the ended periods of the processors every interval
+// until Stop is called.
+func (t *CycleStats) watchPeriods(acc telegraf.Accumulator, processors []*CycleStats, interval time.Duration) {
+	defer t.periods.done.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.periods.stop:
+			return
+		case now := <-ticker.C:
+			for _, p := range processors {
+				for _, m := range p.endPeriods(now) {
+					acc.AddMetric(m)
+				}
+			}
+		}
+	}
+}
+
+// endPeriods returns the metrics of the periods ended by now.
+func (t *CycleStats) endPeriods(now time.Time) []telegraf.Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]telegraf.Metric, 0)
+	if t.OEE != nil {
+		out = append(out, t.endOEE(now)...)
+	}
+	if t.TopErrors != nil {
+		out = append(out, t.endTopErrors(now)...)
+	}
+	return out
+}
+
+// deviceClock returns the time of a device's clock at the wall-clock time
+// now, from the timestamp of its last cycle and when that cycle was seen.
+// Periods are compared to the device's clock, so skewed device clocks and
+// replayed data do not end them early.
+func deviceClock(last, seen, now time.Time) time.Time {
+	return last.Add(now.Sub(seen))
+}
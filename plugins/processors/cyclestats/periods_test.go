@@ -0,0 +1,56 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestDeviceClock(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		last time.Time
+		seen time.Time
+		want time.Time
+	}{
+		{name: "in sync", last: now.Add(-time.Minute), seen: now.Add(-time.Minute), want: now},
+		{name: "behind", last: now.Add(-time.Hour - time.Minute), seen: now.Add(-time.Minute), want: now.Add(-time.Hour)},
+		{name: "ahead", last: now.Add(time.Hour), seen: now.Add(-time.Minute), want: now.Add(time.Hour + time.Minute)},
+		{name: "replayed", last: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), seen: now, want: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := deviceClock(tt.last, tt.seen, now); !got.Equal(tt.want) {
+			t.Errorf("%s: device clock %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWatchPeriods(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.TopErrors = &TopErrors{Period: config.Duration(20 * time.Millisecond)}
+	})
+	p.trackErrors(metric.New("steam_stats", map[string]string{"id": "1"},
+		map[string]interface{}{"error": "E42"}, time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)))
+
+	acc := &collect{}
+	p.startPeriods(acc)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		acc.mu.Lock()
+		n := len(acc.metrics)
+		acc.mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(p.periods.stop)
+	p.periods.done.Wait()
+
+	if len(acc.metrics) != 1 || acc.metrics[0].Fields()["error_top1"] != "E42" {
+		t.Errorf("got %v, want the top errors of the ended period", acc.metrics)
+	}
+}
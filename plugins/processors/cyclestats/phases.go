@@ -0,0 +1,194 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Phases of a steam cycle.
+const (
+	phaseFill  = "fill"
+	phaseHeat  = "heat"
+	phaseHold  = "hold"
+	phaseDrain = "drain"
+	phaseVent  = "vent"
+)
+
+var phaseOrder = []string{phaseFill, phaseHeat, phaseHold, phaseDrain, phaseVent}
+
+// PhaseDetection configures how the phase of a steam cycle is detected from
+// the fields a device reports.
+type PhaseDetection struct {
+	Tag           string  `toml:"tag"`
+	StartField    string  `toml:"start_field"`
+	TempField     string  `toml:"temp_field"`
+	PressureField string  `toml:"pressure_field"`
+	DrainField    string  `toml:"drain_field"`
+	HoldTemp      float64 `toml:"hold_temp"`
+}
+
+func (p *PhaseDetection) init() error {
+	if p.HoldTemp <= 0 {
+		return fmt.Errorf("phases requires a positive hold_temp")
+	}
+	if p.Tag == "" {
+		p.Tag = "phase"
+	}
+	if p.StartField == "" {
+		p.StartField = "steam_type"
+	}
+	if p.TempField == "" {
+		p.TempField = "cook_temp"
+	}
+	if p.PressureField == "" {
+		p.PressureField = "vessel_pressure"
+	}
+	if p.DrainField == "" {
+		p.DrainField = "drain_open_duration"
+	}
+	return nil
+}
+
+// phaseState is the detected phase of a device and the last values it is
+// detected from.
+type phaseState struct {
+	phase string
+	since time.Time
+	last  time.Time
+
+	// durations holds the time spent in each phase of the current cycle,
+	// started at started, and previous those of the last ended cycle,
+	// started at previousStarted
+	durations       map[string]time.Duration
+	started         time.Time
+	previous        map[string]time.Duration
+	previousStarted time.Time
+
+	temp        float64
+	hasTemp     bool
+	pressure    float64
+	hasPressure bool
+}
+
+// next returns the phase following the current one given a metric's fields.
+// A reported start field starts a cycle by filling the vessel, which is then
+// heated to the hold temperature, held, drained, and vented as the pressure
+// drops.
+func (s *phaseState) next(p *PhaseDetection, m telegraf.Metric) string {
+	phase := s.phase
+	if m.HasField(p.StartField) {
+		phase = phaseFill
+	}
+
+	if v, ok := fieldFloat(m, p.TempField); ok {
+		switch {
+		case v >= p.HoldTemp:
+			phase = phaseHold
+		case s.hasTemp && v > s.temp && phase != phaseDrain && phase != phaseVent:
+			phase = phaseHeat
+		}
+		s.temp, s.hasTemp = v, true
+	}
+
+	if v, ok := fieldFloat(m, p.DrainField); ok && v > 0 && phase != phaseVent {
+		phase = phaseDrain
+	}
+
+	if v, ok := fieldFloat(m, p.PressureField); ok {
+		if s.hasPressure && v < s.pressure && (phase == phaseHold || phase == phaseDrain) {
+			phase = phaseVent
+		}
+		s.pressure, s.hasPressure = v, true
+	}
+
+	return phase
+}
+
+func fieldFloat(m telegraf.Metric, field string) (float64, bool) {
+	value, ok := m.GetField(field)
+	if !ok {
+		return 0, false
+	}
+	return toFloat(value)
+}
+
+// detectPhase updates the phase of the metric's device and tags the metric
+// with it, once a phase was detected.
+func (t *CycleStats) detectPhase(m telegraf.Metric) {
+	if t.Phases == nil {
+		return
+	}
+
+	device := t.deviceID(m)
+	s, ok := t.phases[device]
+	if !ok {
+		s = &phaseState{durations: make(map[string]time.Duration)}
+		t.phases[device] = s
+	}
+
+	// A reported start field ends the cycle in progress
+	if m.HasField(t.Phases.StartField) {
+		s.endCycle(m.Time())
+	}
+	if phase := s.next(t.Phases, m); phase != s.phase {
+		s.close(m.Time())
+		s.phase = phase
+	}
+	if m.Time().After(s.last) {
+		s.last = m.Time()
+	}
+	if s.phase != "" {
+		m.AddTag(t.Phases.Tag, s.phase)
+	}
+}
+
+// close adds the time spent in the current phase up to ts to its duration.
+func (s *phaseState) close(ts time.Time) {
+	if s.phase != "" && ts.After(s.since) {
+		s.durations[s.phase] += ts.Sub(s.since)
+	}
+	s.since = ts
+}
+
+// endCycle ends the cycle in progress at ts, keeping its phase durations as
+// those of the previous cycle, and starts counting the next cycle.
+func (s *phaseState) endCycle(ts time.Time) {
+	if s.phase != "" {
+		s.close(ts)
+		s.previous = s.durations
+		s.previousStarted = s.started
+		s.durations = make(map[string]time.Duration)
+		s.phase = ""
+	}
+	s.started = ts
+}
+
+// addPhaseDurations adds the seconds the device spent in each phase of its
+// previous cycle to the cycle summary, the aggregate holding the start
+// field. The phases of a cycle are only known once the next cycle starts,
+// after its summary was flushed, so a summary carries the phases of the
+// cycle before it, as <phase>_phase_seconds_prev.
+func (t *CycleStats) addPhaseDurations(aggregate telegraf.Metric, ms []telegraf.Metric) {
+	if t.Phases == nil || !aggregate.HasField(t.Phases.StartField) {
+		return
+	}
+
+	s, ok := t.phases[t.deviceID(aggregate)]
+	if !ok || s.previous == nil {
+		return
+	}
+
+	// The summary of a cycle flushed after the next cycle started must not
+	// take its own phases as those of the previous cycle
+	for _, m := range ms {
+		if m.HasField(t.Phases.StartField) && !s.previousStarted.Before(m.Time()) {
+			return
+		}
+	}
+
+	for _, phase := range phaseOrder {
+		aggregate.AddField(phase+"_phase_seconds_prev", s.previous[phase].Seconds())
+	}
+}
@@ -0,0 +1,123 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// cycleMetrics returns a steam_params metric per field set of a cycle of
+// device "1", a minute apart.
+func cycleMetrics(start time.Time, fields ...map[string]interface{}) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0, len(fields))
+	for i, f := range fields {
+		out = append(out, metric.New("steam_params", map[string]string{"id": "1"}, f, start.Add(time.Duration(i)*time.Minute)))
+	}
+	return out
+}
+
+func TestDetectPhase(t *testing.T) {
+	steps := []struct {
+		fields map[string]interface{}
+		phase  string
+	}{
+		{fields: map[string]interface{}{"cook_temp": 20.0}, phase: ""},
+		{fields: map[string]interface{}{"steam_type": int64(1)}, phase: phaseFill},
+		{fields: map[string]interface{}{"cook_temp": 20.0, "vessel_pressure": 0.0}, phase: phaseFill},
+		{fields: map[string]interface{}{"cook_temp": 80.0, "vessel_pressure": 100.0}, phase: phaseHeat},
+		{fields: map[string]interface{}{"cook_temp": 121.5, "vessel_pressure": 200.0}, phase: phaseHold},
+		{fields: map[string]interface{}{"cook_temp": 120.0}, phase: phaseHold},
+		{fields: map[string]interface{}{"drain_open_duration": 3.0}, phase: phaseDrain},
+		// A rising temperature while draining is no new heating
+		{fields: map[string]interface{}{"cook_temp": 120.5}, phase: phaseDrain},
+		{fields: map[string]interface{}{"vessel_pressure": 50.0}, phase: phaseVent},
+		{fields: map[string]interface{}{"drain_open_duration": 1.0, "vessel_pressure": 10.0}, phase: phaseVent},
+		{fields: map[string]interface{}{"steam_type": int64(2)}, phase: phaseFill},
+	}
+
+	p := newTestProcessor(t, func(p *CycleStats) { p.Phases = &PhaseDetection{HoldTemp: 121} })
+	fields := make([]map[string]interface{}, 0, len(steps))
+	for _, step := range steps {
+		fields = append(fields, step.fields)
+	}
+	for i, m := range cycleMetrics(time.Unix(1600000000, 0), fields...) {
+		p.detectPhase(m)
+		if phase, _ := m.GetTag("phase"); phase != steps[i].phase {
+			t.Errorf("step %d %v: phase %q, want %q", i, steps[i].fields, phase, steps[i].phase)
+		}
+	}
+}
+
+func TestPhaseDetectionInit(t *testing.T) {
+	tests := []struct {
+		phases PhaseDetection
+		ok     bool
+	}{
+		{phases: PhaseDetection{HoldTemp: 121}, ok: true},
+		{phases: PhaseDetection{}},
+		{phases: PhaseDetection{HoldTemp: -1}},
+	}
+	for _, tt := range tests {
+		if err := tt.phases.init(); (err == nil) != tt.ok {
+			t.Errorf("phases %+v: got error %v, want ok %v", tt.phases, err, tt.ok)
+		}
+	}
+}
+
+func TestPhaseDurations(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	cycle := cycleMetrics(start,
+		map[string]interface{}{"steam_type": int64(1)},
+		map[string]interface{}{"cook_temp": 80.0},
+		map[string]interface{}{"cook_temp": 100.0},
+		map[string]interface{}{"cook_temp": 121.5, "vessel_pressure": 200.0},
+		map[string]interface{}{"drain_open_duration": 3.0},
+		map[string]interface{}{"vessel_pressure": 100.0},
+		map[string]interface{}{"steam_type": int64(1)},
+	)
+	first, next := cycle[0], cycle[len(cycle)-1]
+
+	tests := []struct {
+		name string
+		// sources are the metrics the summary is built from
+		sources []telegraf.Metric
+		want    map[string]interface{}
+	}{
+		{
+			name:    "summary of the next cycle",
+			sources: []telegraf.Metric{next},
+			want: map[string]interface{}{
+				"fill_phase_seconds_prev":  120.0,
+				"heat_phase_seconds_prev":  60.0,
+				"hold_phase_seconds_prev":  60.0,
+				"drain_phase_seconds_prev": 60.0,
+				"vent_phase_seconds_prev":  60.0,
+			},
+		},
+		{
+			// Flushed late, after the next cycle started
+			name:    "summary of the cycle itself",
+			sources: []telegraf.Metric{first},
+			want:    map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) { p.Phases = &PhaseDetection{HoldTemp: 121} })
+			for _, m := range cycle {
+				p.detectPhase(m.Copy())
+			}
+
+			aggregate := metric.New("steam_params", map[string]string{"id": "1"},
+				map[string]interface{}{"steam_type": int64(1)}, tt.sources[0].Time())
+			p.addPhaseDurations(aggregate, tt.sources)
+			aggregate.RemoveField("steam_type")
+			if got := aggregate.Fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
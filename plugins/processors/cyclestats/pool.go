@@ -0,0 +1,69 @@
+package cyclestats
+
+import (
+	"sync"
+
+	"github.com/influxdata/telegraf"
+)
+
+// groupPool holds the metric slices of flushed groups for reuse by new
+// groups, so a steady stream of cycles does not allocate a slice per group.
+var groupPool = sync.Pool{
+	New: func() interface{} {
+		return new([]telegraf.Metric)
+	},
+}
+
+// columnsPool holds the buffers groups are gathered into while their
+// aggregates are built, shared between shards.
+var columnsPool = sync.Pool{
+	New: func() interface{} {
+		return &columns{}
+	},
+}
+
+// releaseColumns returns the buffers of gathered columns to the pool. The
+// columns must not be used afterwards.
+func releaseColumns(c *columns) {
+	// The pool must not keep the values of the group alive
+	for i := range c.last {
+		c.last[i] = nil
+	}
+	for field := range c.values {
+		delete(c.values, field)
+	}
+	columnsPool.Put(c)
+}
+
+// statsPool holds the maps statistics are computed into before they are
+// added to an aggregate.
+var statsPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]interface{})
+	},
+}
+
+// newGroup returns an empty metric slice for a group, with room for at
+// least size metrics.
+func newGroup(size int) []telegraf.Metric {
+	ms := *groupPool.Get().(*[]telegraf.Metric)
+	if cap(ms) < size {
+		return make([]telegraf.Metric, 0, size)
+	}
+	return ms[:0]
+}
+
+// recycleGroup returns the slice of a flushed group to the pool unless the
+// source metrics are still held, for delivery tracking, the journal or the
+// shared cache.
+func (t *CycleStats) recycleGroup(ms []telegraf.Metric) {
+	if t.AckFlush || t.journal != nil || t.shared != nil {
+		return
+	}
+	// The pool must not keep the metrics alive
+	for i := range ms {
+		ms[i] = nil
+	}
+	ms = ms[:0]
+	groupPool.Put(&ms)
+}
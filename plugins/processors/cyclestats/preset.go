@@ -0,0 +1,85 @@
+package cyclestats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+func validatePreset(preset, level string) error {
+	switch preset {
+	case "", "flux_rollup":
+	default:
+		return fmt.Errorf("invalid schema_preset %q", preset)
+	}
+	if preset != "" && level == "" {
+		return fmt.Errorf("rollup_level must not be empty")
+	}
+	return nil
+}
+
+// applyPreset reshapes an aggregate into the schema expected by downstream
+// Flux tasks and TICKscripts. The "flux_rollup" preset names rollups
+// "<measurement>_<level>" and tags them with "_level", so raw and rolled up
+// series of the same measurement stay apart.
+func (t *CycleStats) applyPreset(aggregate telegraf.Metric) {
+	switch t.SchemaPreset {
+	case "flux_rollup":
+		aggregate.SetName(aggregate.Name() + "_" + t.RollupLevel)
+		aggregate.AddTag("_level", t.RollupLevel)
+	}
+}
+
+// applyNaming renames an aggregate according to output_name or
+// name_override, name_prefix and name_suffix, in that order, so raw and
+// aggregated series can share a bucket.
+func (t *CycleStats) applyNaming(aggregate telegraf.Metric) {
+	if name, ok := t.OutputName[aggregate.Name()]; ok {
+		aggregate.SetName(name)
+	} else if t.NameOverride != "" {
+		aggregate.SetName(t.NameOverride)
+	}
+	if t.NamePrefix != "" {
+		aggregate.AddPrefix(t.NamePrefix)
+	}
+	if t.NameSuffix != "" {
+		aggregate.AddSuffix(t.NameSuffix)
+	}
+}
+
+func validateAggregateTimestamp(timestamp string) error {
+	switch timestamp {
+	case "start", "end", "middle", "now":
+		return nil
+	}
+	return fmt.Errorf("invalid aggregate_timestamp %q", timestamp)
+}
+
+// applyTimestamp sets the time of an aggregate to the start, end or middle of
+// the times of its metrics, or to the time it is emitted at.
+func (t *CycleStats) applyTimestamp(aggregate telegraf.Metric, ms []telegraf.Metric) {
+	if t.AggregateTimestamp == "now" {
+		aggregate.SetTime(time.Now())
+		return
+	}
+
+	start, end := ms[0].Time(), ms[0].Time()
+	for _, m := range ms[1:] {
+		if m.Time().Before(start) {
+			start = m.Time()
+		}
+		if m.Time().After(end) {
+			end = m.Time()
+		}
+	}
+
+	switch t.AggregateTimestamp {
+	case "start":
+		aggregate.SetTime(start)
+	case "end":
+		aggregate.SetTime(end)
+	case "middle":
+		aggregate.SetTime(start.Add(end.Sub(start) / 2))
+	}
+}
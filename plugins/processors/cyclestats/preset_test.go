@@ -0,0 +1,128 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestValidatePreset(t *testing.T) {
+	tests := []struct {
+		preset string
+		level  string
+		ok     bool
+	}{
+		{preset: "", level: "", ok: true},
+		{preset: "flux_rollup", level: "cycle", ok: true},
+		{preset: "flux_rollup", level: "", ok: false},
+		{preset: "kapacitor", level: "cycle", ok: false},
+	}
+	for _, tt := range tests {
+		err := validatePreset(tt.preset, tt.level)
+		if (err == nil) != tt.ok {
+			t.Errorf("schema_preset %q with rollup_level %q: got error %v, want ok %v", tt.preset, tt.level, err, tt.ok)
+		}
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset string
+		level  string
+		want   string
+		tags   map[string]string
+	}{
+		{name: "none", want: "steam_stats", tags: map[string]string{"id": "1"}},
+		{name: "flux rollup", preset: "flux_rollup", level: "cycle", want: "steam_stats_cycle", tags: map[string]string{"id": "1", "_level": "cycle"}},
+		{name: "flux rollup per hour", preset: "flux_rollup", level: "1h", want: "steam_stats_1h", tags: map[string]string{"id": "1", "_level": "1h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &CycleStats{SchemaPreset: tt.preset, RollupLevel: tt.level}
+			aggregate := metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(1)}, time.Unix(1600000000, 0))
+			p.applyPreset(aggregate)
+			if aggregate.Name() != tt.want {
+				t.Errorf("name %q, want %q", aggregate.Name(), tt.want)
+			}
+			if len(aggregate.Tags()) != len(tt.tags) {
+				t.Errorf("tags %v, want %v", aggregate.Tags(), tt.tags)
+			}
+			for k, v := range tt.tags {
+				if got, _ := aggregate.GetTag(k); got != v {
+					t.Errorf("tag %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyNaming(t *testing.T) {
+	tests := []struct {
+		name       string
+		outputName map[string]string
+		override   string
+		prefix     string
+		suffix     string
+		want       string
+	}{
+		{name: "unchanged", want: "steam_stats"},
+		{name: "override", override: "cycles", want: "cycles"},
+		{name: "prefix and suffix", prefix: "agg_", suffix: "_cycle", want: "agg_steam_stats_cycle"},
+		{name: "override with prefix", override: "cycles", prefix: "agg_", want: "agg_cycles"},
+		{name: "output name", outputName: map[string]string{"steam_stats": "steam"}, want: "steam"},
+		{name: "output name before override", outputName: map[string]string{"steam_stats": "steam"}, override: "cycles", suffix: "_1m", want: "steam_1m"},
+		{name: "output name of other measurement", outputName: map[string]string{"grinder": "grind"}, override: "cycles", want: "cycles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &CycleStats{OutputName: tt.outputName, NameOverride: tt.override, NamePrefix: tt.prefix, NameSuffix: tt.suffix}
+			aggregate := metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(1)}, time.Unix(1600000000, 0))
+			p.applyNaming(aggregate)
+			if aggregate.Name() != tt.want {
+				t.Errorf("name %q, want %q", aggregate.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTimestamp(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	// Metrics out of order, spanning 10 seconds
+	ms := []telegraf.Metric{
+		steamStats(nil, "flows", int64(1), start.Add(4*time.Second)),
+		steamStats(nil, "flows", int64(2), start.Add(10*time.Second)),
+		steamStats(nil, "flows", int64(3), start),
+	}
+
+	tests := []struct {
+		timestamp string
+		want      time.Time
+	}{
+		{timestamp: "start", want: start},
+		{timestamp: "end", want: start.Add(10 * time.Second)},
+		{timestamp: "middle", want: start.Add(5 * time.Second)},
+	}
+	for _, tt := range tests {
+		p := &CycleStats{AggregateTimestamp: tt.timestamp}
+		aggregate := metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(6)}, time.Time{})
+		p.applyTimestamp(aggregate, ms)
+		if !aggregate.Time().Equal(tt.want) {
+			t.Errorf("aggregate_timestamp %q: time %v, want %v", tt.timestamp, aggregate.Time(), tt.want)
+		}
+	}
+
+	p := &CycleStats{AggregateTimestamp: "now"}
+	aggregate := metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(6)}, time.Time{})
+	before := time.Now()
+	p.applyTimestamp(aggregate, ms)
+	if aggregate.Time().Before(before) || aggregate.Time().After(time.Now()) {
+		t.Errorf("aggregate_timestamp \"now\": time %v, want the time of emitting", aggregate.Time())
+	}
+
+	if err := validateAggregateTimestamp("first"); err == nil {
+		t.Errorf("invalid aggregate_timestamp \"first\" accepted")
+	}
+}
@@ -0,0 +1,96 @@
+package cyclestats
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf"
+)
+
+// allMeasurements is the measurement of per-measurement tables such as
+// rename_fields and exclude_fields applying to all measurements.
+const allMeasurements = "*"
+
+// validateRenames checks that no field is renamed to an empty name and that
+// the renames of a measurement, including those for all measurements, do
+// not rename two fields to the same name or a field to the name of another
+// configured field, which would overwrite it.
+func validateRenames(renames map[string]map[string]string, fields map[string][]string) error {
+	for measurement, scoped := range renames {
+		for from, to := range scoped {
+			if to == "" {
+				return fmt.Errorf("rename_fields for %q of %q must not be empty", from, measurement)
+			}
+		}
+	}
+
+	measurements := make(map[string]bool, len(renames)+len(fields))
+	for measurement := range renames {
+		measurements[measurement] = true
+	}
+	for measurement := range fields {
+		measurements[measurement] = true
+	}
+	for measurement := range measurements {
+		if measurement == allMeasurements {
+			continue
+		}
+		effective := make(map[string]string)
+		for from, to := range renames[allMeasurements] {
+			effective[from] = to
+		}
+		for from, to := range renames[measurement] {
+			effective[from] = to
+		}
+
+		targets := make(map[string]string, len(effective))
+		for from, to := range effective {
+			if other, ok := targets[to]; ok {
+				return fmt.Errorf("rename_fields of %q rename both %q and %q to %q", measurement, other, from, to)
+			}
+			targets[to] = from
+		}
+		for _, field := range fields[measurement] {
+			if from, ok := targets[field]; ok && from != field {
+				if _, renamed := effective[field]; !renamed {
+					return fmt.Errorf("rename_fields of %q rename %q to the configured field %q", measurement, from, field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyRenames renames the fields of an aggregate from their wire names
+// according to rename_fields. Renames scoped to the aggregate's measurement
+// take precedence over those for all measurements.
+func (t *CycleStats) applyRenames(aggregate telegraf.Metric) {
+	if len(t.RenameFields) == 0 {
+		return
+	}
+
+	scoped := t.RenameFields[aggregate.Name()]
+	all := t.RenameFields[allMeasurements]
+
+	// Removing fields shifts the field list, so the renames are collected
+	// before any field is touched
+	var from []string
+	var renamed []*telegraf.Field
+	for _, field := range aggregate.FieldList() {
+		to, ok := scoped[field.Key]
+		if !ok {
+			to, ok = all[field.Key]
+		}
+		if !ok || to == field.Key {
+			continue
+		}
+		from = append(from, field.Key)
+		renamed = append(renamed, &telegraf.Field{Key: to, Value: field.Value})
+	}
+
+	for _, key := range from {
+		aggregate.RemoveField(key)
+	}
+	for _, field := range renamed {
+		aggregate.AddField(field.Key, field.Value)
+	}
+}
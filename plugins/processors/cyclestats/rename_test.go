@@ -0,0 +1,96 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestApplyRenames(t *testing.T) {
+	renames := map[string]map[string]string{
+		"*":            {"pd_timeouts": "timeouts", "flows": "flows_total"},
+		"steam_params": {"cook_temp": "temperature", "flows": "steam_flows"},
+	}
+	tests := []struct {
+		name        string
+		measurement string
+		fields      map[string]interface{}
+		want        map[string]interface{}
+	}{
+		{
+			name:        "scoped before all",
+			measurement: "steam_params",
+			fields:      map[string]interface{}{"cook_temp": 121.3, "flows": int64(3), "pd_timeouts": int64(1)},
+			want:        map[string]interface{}{"temperature": 121.3, "steam_flows": int64(3), "timeouts": int64(1)},
+		},
+		{
+			name:        "all measurements",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"cook_temp": 121.3, "flows": int64(3)},
+			want:        map[string]interface{}{"cook_temp": 121.3, "flows_total": int64(3)},
+		},
+		{
+			name:        "no renamed fields",
+			measurement: "grinder",
+			fields:      map[string]interface{}{"reversals": int64(2)},
+			want:        map[string]interface{}{"reversals": int64(2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) { p.RenameFields = renames })
+			aggregate := metric.New(tt.measurement, nil, tt.fields, time.Unix(1600000000, 0))
+			p.applyRenames(aggregate)
+			if got := aggregate.Fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		renames map[string]map[string]string
+		fields  map[string][]string
+		ok      bool
+	}{
+		{
+			name:    "valid",
+			renames: map[string]map[string]string{"steam": {"cook_temp": "temperature"}},
+			fields:  map[string][]string{"steam": {"cook_temp", "control_temp"}},
+			ok:      true,
+		},
+		{
+			name:    "swapped names",
+			renames: map[string]map[string]string{"steam": {"a": "b", "b": "a"}},
+			fields:  map[string][]string{"steam": {"a", "b"}},
+			ok:      true,
+		},
+		{
+			name:    "empty name",
+			renames: map[string]map[string]string{"steam": {"cook_temp": ""}},
+		},
+		{
+			name:    "two fields to one name",
+			renames: map[string]map[string]string{"steam": {"a": "c", "b": "c"}},
+		},
+		{
+			name:    "collision with all measurements",
+			renames: map[string]map[string]string{"*": {"a": "c"}, "steam": {"b": "c"}},
+		},
+		{
+			name:    "overwrites a configured field",
+			renames: map[string]map[string]string{"steam": {"cook_temp": "control_temp"}},
+			fields:  map[string][]string{"steam": {"cook_temp", "control_temp"}},
+		},
+	}
+	for _, tt := range tests {
+		err := validateRenames(tt.renames, tt.fields)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cyclestats
+
+import (
+	"fmt"
+
+	"github.com/influxdata/telegraf"
+)
+
+// cycleResultTag is the tag holding the classification of a cycle.
+const cycleResultTag = "cycle_result"
+
+// CycleResultRule classifies a cycle with Result if any of the fields is
+// reported with a positive value.
+type CycleResultRule struct {
+	Result      string   `toml:"result"`
+	Measurement string   `toml:"measurement"`
+	Fields      []string `toml:"fields"`
+}
+
+func (r *CycleResultRule) appliesTo(aggregate telegraf.Metric) bool {
+	if r.Measurement != "" && r.Measurement != aggregate.Name() {
+		return false
+	}
+	for _, field := range r.Fields {
+		if aggregate.HasField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CycleResultRule) matches(aggregate telegraf.Metric) bool {
+	for _, field := range r.Fields {
+		value, ok := aggregate.GetField(field)
+		if !ok {
+			continue
+		}
+		if v, ok := toFloat(value); ok && v > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCycleResults(rules []*CycleResultRule) error {
+	for _, rule := range rules {
+		if rule.Result == "" || len(rule.Fields) == 0 {
+			return fmt.Errorf("cycle_result rules require a result and fields")
+		}
+	}
+	return nil
+}
+
+// classifyCycle tags the aggregate with the result of the first matching
+// rule, or with SuccessResult if rules apply to it but none matches.
+func (t *CycleStats) classifyCycle(aggregate telegraf.Metric) {
+	applies := false
+	for _, rule := range t.CycleResults {
+		if !rule.appliesTo(aggregate) {
+			continue
+		}
+		applies = true
+		if rule.matches(aggregate) {
+			aggregate.AddTag(cycleResultTag, rule.Result)
+			return
+		}
+	}
+	if applies {
+		aggregate.AddTag(cycleResultTag, t.SuccessResult)
+	}
+}
@@ -0,0 +1,86 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestClassifyCycle(t *testing.T) {
+	rules := []*CycleResultRule{
+		{Result: "lid_failure", Measurement: "vessel_lid_failure", Fields: []string{"lid_errors"}},
+		{Result: "aborted", Fields: []string{"stop_cook_count", "error"}},
+		{Result: "timeout", Fields: []string{"pd_timeouts"}},
+	}
+	tests := []struct {
+		name        string
+		measurement string
+		fields      map[string]interface{}
+		result      string
+	}{
+		{
+			name:        "first matching rule",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"error": int64(3), "pd_timeouts": int64(1)},
+			result:      "aborted",
+		},
+		{
+			name:        "later rule",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"error": int64(0), "pd_timeouts": 2.0},
+			result:      "timeout",
+		},
+		{
+			name:        "success",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"stop_cook_count": int64(0), "pd_timeouts": false},
+			result:      "success",
+		},
+		{
+			name:        "rule of another measurement",
+			measurement: "steam_stats",
+			fields:      map[string]interface{}{"lid_errors": int64(1)},
+			result:      "",
+		},
+		{
+			name:        "rule of the measurement",
+			measurement: "vessel_lid_failure",
+			fields:      map[string]interface{}{"lid_errors": int64(1)},
+			result:      "lid_failure",
+		},
+		{
+			name:        "no rule applies",
+			measurement: "grinder",
+			fields:      map[string]interface{}{"reversals": int64(2)},
+			result:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) { p.CycleResults = rules })
+
+			aggregate := metric.New(tt.measurement, nil, tt.fields, time.Unix(1600000000, 0))
+			p.classifyCycle(aggregate)
+			if result, _ := aggregate.GetTag(cycleResultTag); result != tt.result {
+				t.Errorf("result %q, want %q", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestValidateCycleResults(t *testing.T) {
+	tests := []struct {
+		rule *CycleResultRule
+		ok   bool
+	}{
+		{rule: &CycleResultRule{Result: "aborted", Fields: []string{"error"}}, ok: true},
+		{rule: &CycleResultRule{Fields: []string{"error"}}},
+		{rule: &CycleResultRule{Result: "aborted"}},
+	}
+	for _, tt := range tests {
+		if err := validateCycleResults([]*CycleResultRule{tt.rule}); (err == nil) != tt.ok {
+			t.Errorf("rule %+v: got error %v, want ok %v", tt.rule, err, tt.ok)
+		}
+	}
+}
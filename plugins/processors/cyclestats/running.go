@@ -0,0 +1,103 @@
+package cyclestats
+
+import (
+	"math"
+
+	"github.com/influxdata/telegraf"
+)
+
+// runningStats accumulates the values of a field as they are added to a
+// group using Welford's algorithm, which needs no buffered samples and does
+// not lose precision to large sums.
+type runningStats struct {
+	n    float64
+	mean float64
+	m2   float64
+}
+
+func (r *runningStats) add(v float64) {
+	r.n++
+	delta := v - r.mean
+	r.mean += delta / r.n
+	r.m2 += delta * (v - r.mean)
+}
+
+// runningStatistic adds the fields it computes from the running statistics
+// of a field to out.
+type runningStatistic func(field string, r *runningStats, out map[string]interface{})
+
+// runningStatistics are the statistics computed from running statistics
+// rather than the samples of a group.
+var runningStatistics = map[string]runningStatistic{
+	"variance": runningVariance,
+	"stddev":   runningStddev,
+}
+
+// runningVariance emits the sample variance of the values.
+func runningVariance(field string, r *runningStats, out map[string]interface{}) {
+	if r.n < 2 {
+		return
+	}
+	out[field+"_variance"] = r.m2 / (r.n - 1)
+}
+
+// runningStddev emits the sample standard deviation of the values.
+func runningStddev(field string, r *runningStats, out map[string]interface{}) {
+	if r.n < 2 {
+		return
+	}
+	out[field+"_stddev"] = math.Sqrt(r.m2 / (r.n - 1))
+}
+
+// compileRunning decides the fields to keep running statistics for and the
+// fields still to be sampled for their statistics and histograms. Groups
+// built from the samples of a sliding window or of other agents are not
+// covered by running statistics, so all their statistics are sampled.
+func (t *CycleStats) compileRunning() {
+	t.runningFields = make(map[string]bool)
+	t.sampledFields = make(map[string]bool)
+	for field := range t.Histogram {
+		t.sampledFields[field] = true
+	}
+
+	running := t.SlidingWindow == 0 && t.SharedCache == ""
+	for field, names := range t.Stats {
+		for _, name := range names {
+			if _, ok := runningStatistics[name]; ok && running {
+				t.runningFields[field] = true
+				continue
+			}
+			t.sampledFields[field] = true
+		}
+	}
+}
+
+// accumulate adds the values of a metric added to a group to the running
+// statistics of the group.
+func (t *CycleStats) accumulate(groupkey string, m telegraf.Metric) {
+	if len(t.runningFields) == 0 {
+		return
+	}
+
+	group, ok := t.running[groupkey]
+	for _, field := range m.FieldList() {
+		if !t.runningFields[field.Key] {
+			continue
+		}
+		v, numeric := toFloat(field.Value)
+		if !numeric {
+			continue
+		}
+		if !ok {
+			group = make(map[string]*runningStats)
+			t.running[groupkey] = group
+			ok = true
+		}
+		r, found := group[field.Key]
+		if !found {
+			r = &runningStats{}
+			group[field.Key] = r
+		}
+		r.add(v)
+	}
+}
@@ -0,0 +1,110 @@
+package cyclestats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestCompileRunning(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *CycleStats)
+		running   map[string]bool
+		sampled   map[string]bool
+	}{
+		{
+			// The variance of flows is running, its delta sampled
+			name:    "running",
+			running: map[string]bool{"cook_temp": true, "flows": true},
+			sampled: map[string]bool{"flows": true},
+		},
+		{
+			name:      "histogram is sampled",
+			configure: func(p *CycleStats) { p.Histogram = map[string][]float64{"cook_temp": {120}} },
+			running:   map[string]bool{"cook_temp": true, "flows": true},
+			sampled:   map[string]bool{"cook_temp": true, "flows": true},
+		},
+		{
+			name:      "sliding window",
+			configure: func(p *CycleStats) { p.SlidingWindow = 5 },
+			running:   map[string]bool{},
+			sampled:   map[string]bool{"cook_temp": true, "flows": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			p.Stats = map[string][]string{
+				"cook_temp": {"variance", "stddev"},
+				"flows":     {"delta", "variance"},
+			}
+			if tt.configure != nil {
+				tt.configure(p)
+			}
+			p.compileRunning()
+			if !reflect.DeepEqual(p.runningFields, tt.running) {
+				t.Errorf("running %v, want %v", p.runningFields, tt.running)
+			}
+			if !reflect.DeepEqual(p.sampledFields, tt.sampled) {
+				t.Errorf("sampled %v, want %v", p.sampledFields, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestRunningStatsPerGroup(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Stats = map[string][]string{"cook_temp": {"variance", "stddev"}}
+		p.DropOriginal = true
+	})
+
+	// The groups of the two devices are filled in turns
+	start := time.Unix(1600000000, 0)
+	temps := map[string][]float64{
+		"1": {120.5, 121.5, 122.0, 121.0},
+		"2": {100, 110},
+	}
+	var in []telegraf.Metric
+	for i := 0; i < 4; i++ {
+		for _, device := range []string{"1", "2"} {
+			if i >= len(temps[device]) {
+				continue
+			}
+			in = append(in, metric.New("steam_params", map[string]string{"id": device},
+				map[string]interface{}{"cook_temp": temps[device][i]}, start))
+		}
+	}
+	out := append(applyAll(p, in...), p.flushIncomplete()...)
+	if len(out) != 2 {
+		t.Fatalf("got %d aggregates, want 2: %v", len(out), out)
+	}
+
+	for _, aggregate := range out {
+		device, _ := aggregate.GetTag("id")
+		want := make(map[string]interface{})
+		statVariance("cook_temp", samplesOf(floats(temps[device])...), want)
+		statStddev("cook_temp", samplesOf(floats(temps[device])...), want)
+		for field, value := range want {
+			got, _ := aggregate.GetField(field)
+			if math.Abs(got.(float64)-value.(float64)) > 1e-9 {
+				t.Errorf("device %s: %s = %v, want %v", device, field, got, value)
+			}
+		}
+	}
+	if len(p.running) != 0 {
+		t.Errorf("running statistics of flushed groups kept: %v", p.running)
+	}
+}
+
+func floats(values []float64) []interface{} {
+	out := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/influxdata/telegraf"
+)
+
+// fieldSpec optionally declares the type and unit of a field in the schema.
+type fieldSpec struct {
+	Type string `json:"type" toml:"type"`
+	Unit string `json:"unit" toml:"unit"`
+}
+
+// schema maps measurements to their fields, e.g. in TOML
+//
+//	[steam_params]
+//	  cook_temp = { type = "float", unit = "degC" }
+//	  pv_unsafe = {}
+type schema map[string]map[string]fieldSpec
+
+func loadSchema(path string) (schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(schema)
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(b, &s)
+	case ".toml":
+		err = toml.Unmarshal(b, &s)
+	default:
+		return nil, fmt.Errorf("unsupported schema format %q, expected .json or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s) == 0 {
+		return nil, fmt.Errorf("schema defines no measurements")
+	}
+	for measurement, fields := range s {
+		if measurement == "" {
+			return nil, fmt.Errorf("schema contains an empty measurement name")
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("measurement %q defines no fields", measurement)
+		}
+		for field, spec := range fields {
+			if field == "" {
+				return nil, fmt.Errorf("measurement %q contains an empty field name", measurement)
+			}
+			switch spec.Type {
+			case "", "float", "integer", "unsigned", "boolean", "string":
+			default:
+				return nil, fmt.Errorf("invalid type %q for field %q of measurement %q", spec.Type, field, measurement)
+			}
+			if _, ok := units[spec.Unit]; spec.Unit != "" && !ok {
+				return nil, fmt.Errorf("unknown unit %q for field %q of measurement %q", spec.Unit, field, measurement)
+			}
+		}
+	}
+	return s, nil
+}
+
+// fields returns the sorted field names per measurement.
+func (s schema) fields() map[string][]string {
+	fields := make(map[string][]string, len(s))
+	for measurement, specs := range s {
+		names := make([]string, 0, len(specs))
+		for name := range specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields[measurement] = names
+	}
+	return fields
+}
+
+// convertTypes converts the fields of m to the types declared in the schema.
+// Fields that cannot be converted are removed.
+func (t *CycleStats) convertTypes(m telegraf.Metric) {
+	specs, ok := t.schema[m.Name()]
+	if !ok {
+		return
+	}
+
+	// Removing fields shifts the field list, so the fields are collected
+	// before any is removed
+	var unconvertible []string
+	for _, field := range m.FieldList() {
+		spec, ok := specs[field.Key]
+		if !ok || spec.Type == "" {
+			continue
+		}
+		value, ok := convertType(field.Value, spec.Type)
+		if !ok {
+			t.Log.Debugf("Removing field %q of %q, cannot convert %v to %s", field.Key, m.Name(), field.Value, spec.Type)
+			unconvertible = append(unconvertible, field.Key)
+			continue
+		}
+		m.AddField(field.Key, value)
+	}
+	for _, key := range unconvertible {
+		m.RemoveField(key)
+	}
+}
+
+func convertType(v interface{}, typ string) (interface{}, bool) {
+	switch typ {
+	case "float":
+		return toFloat(v)
+	case "integer":
+		if f, ok := toFloat(v); ok {
+			return int64(f), true
+		}
+	case "unsigned":
+		if f, ok := toFloat(v); ok && f >= 0 {
+			return uint64(f), true
+		}
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, true
+		}
+		if f, ok := toFloat(v); ok {
+			return f != 0, true
+		}
+	case "string":
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+		return fmt.Sprint(v), true
+	}
+	return nil, false
+}
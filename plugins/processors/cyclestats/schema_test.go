@@ -0,0 +1,66 @@
+package cyclestats
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+const steamSchema = `
+[steam_stats]
+  error = { type = "integer" }
+  flows = { type = "float" }
+  pd_timeouts = { type = "unsigned" }
+  stop_cook_count = {}
+`
+
+func TestConvertTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.toml")
+	if err := os.WriteFile(path, []byte(steamSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.SchemaFile = path
+	})
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "converted",
+			fields: map[string]interface{}{"error": 3.0, "flows": int64(10), "pd_timeouts": int64(2)},
+			want:   map[string]interface{}{"error": int64(3), "flows": 10.0, "pd_timeouts": uint64(2)},
+		},
+		{
+			name:   "unconvertible before others",
+			fields: map[string]interface{}{"error": "E12", "flows": int64(10), "stop_cook_count": int64(1)},
+			want:   map[string]interface{}{"flows": 10.0, "stop_cook_count": int64(1)},
+		},
+		{
+			name:   "several unconvertible",
+			fields: map[string]interface{}{"error": "E12", "flows": "high", "pd_timeouts": int64(-1), "stop_cook_count": int64(1)},
+			want:   map[string]interface{}{"stop_cook_count": int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metric.New("steam_stats", map[string]string{"id": "1"}, tt.fields, time.Unix(1600000000, 0))
+			// The fields are sorted, so the unconvertible error field comes
+			// before the others
+			p.convertTypes(m)
+			if !reflect.DeepEqual(m.Fields(), tt.want) {
+				t.Errorf("got fields %v, want %v", m.Fields(), tt.want)
+			}
+		})
+	}
+
+	// Converting happens on every metric applied
+	m := metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"error": "E12", "flows": int64(10)}, time.Unix(1600000000, 0))
+	p.Apply(m)
+}
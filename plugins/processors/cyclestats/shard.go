@@ -0,0 +1,191 @@
+package cyclestats
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// shardQueueSize is the number of metrics buffered per shard before Add
+// blocks.
+const shardQueueSize = 1024
+
+// worker runs an independent copy of the processor over the devices hashed
+// to its shard.
+type worker struct {
+	processor *CycleStats
+	in        chan telegraf.Metric
+	done      sync.WaitGroup
+}
+
+func (w *worker) run(acc telegraf.Accumulator) {
+	defer w.done.Done()
+	for m := range w.in {
+		for _, out := range w.processor.Apply(m) {
+			acc.AddMetric(out)
+		}
+	}
+	for _, out := range w.processor.flushIncomplete() {
+		acc.AddMetric(out)
+	}
+}
+
+// clone returns a processor with the configuration and fleet-wide state of t
+// but its own group cache and per-device state.
+func (t *CycleStats) clone() *CycleStats {
+	c := *t
+	c.levels = make(map[string]*deviceLevels)
+	c.crossed = make(map[string]map[*threshold]bool)
+	c.oee = make(map[string]*oeePeriod)
+	c.topErrors = make(map[string]*errorPeriod)
+	c.phases = make(map[string]*phaseState)
+	c.sliding = make(map[string]*slidingWindow)
+	c.ewma = make(map[string]*ewmaSeries)
+	c.prevCycles = make(map[string]*prevCycle)
+	c.openCycles = make(map[string]bool)
+	c.sessions = make(map[string]string)
+	c.endingCycles = make(map[string]telegraf.Metric)
+	c.joined = nil
+	c.skipped = make(map[string]selfstat.Stat)
+	c.incomplete = make(map[string]selfstat.Stat)
+	c.acks = newAckTracker(t.journal)
+	c.workers = nil
+	c.keyBuf = nil
+	c.carry = nil
+	c.mu = &sync.Mutex{}
+	c.Reset()
+	return &c
+}
+
+func (t *CycleStats) Start(acc telegraf.Accumulator) error {
+	t.acc = acc
+	t.startPublisher()
+	if t.IdleTimeout > 0 {
+		t.downtime.stop = make(chan struct{})
+		t.downtime.done.Add(1)
+		go t.watchIdle(acc)
+	}
+	if t.HealthInterval > 0 {
+		t.health.stop = make(chan struct{})
+		t.health.done.Add(1)
+		go t.watchHealth(acc)
+	}
+	if t.BaselineExport != "" && t.BaselineExportInterval > 0 {
+		t.model.stop = make(chan struct{})
+		t.model.done.Add(1)
+		go t.watchBaselines()
+	}
+
+	if t.Shards <= 1 {
+		if t.journal != nil {
+			t.replayJournal(acc)
+		}
+		t.startPeriods(acc)
+		t.startShared(acc)
+		return t.startDebugListener()
+	}
+
+	t.workers = make([]*worker, t.Shards)
+	for i := range t.workers {
+		w := &worker{
+			processor: t.clone(),
+			in:        make(chan telegraf.Metric, shardQueueSize),
+		}
+		w.done.Add(1)
+		go w.run(acc)
+		t.workers[i] = w
+	}
+
+	// Replayed aggregates are tracked by a worker, which resends them if
+	// they are not delivered again
+	if t.journal != nil {
+		t.workers[0].processor.replayJournal(acc)
+	}
+	t.startPeriods(acc)
+	t.startShared(acc)
+	return t.startDebugListener()
+}
+
+func (t *CycleStats) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
+	if len(t.workers) == 0 {
+		for _, out := range t.Apply(m) {
+			acc.AddMetric(out)
+		}
+		return nil
+	}
+
+	// All metrics of a device go to the same shard so its groups and
+	// per-device state never span shards
+	h := fnv.New32a()
+	h.Write([]byte(t.deviceID(m)))
+	t.workers[h.Sum32()%uint32(len(t.workers))].in <- m
+	return nil
+}
+
+func (t *CycleStats) Stop() error {
+	if t.downtime.stop != nil {
+		close(t.downtime.stop)
+		t.downtime.done.Wait()
+		t.downtime.stop = nil
+	}
+	if t.health.stop != nil {
+		close(t.health.stop)
+		t.health.done.Wait()
+		t.health.stop = nil
+	}
+	if t.periods.stop != nil {
+		close(t.periods.stop)
+		t.periods.done.Wait()
+		t.periods.stop = nil
+	}
+	if t.model.stop != nil {
+		close(t.model.stop)
+		t.model.done.Wait()
+		t.model.stop = nil
+	}
+
+	t.stopDebug()
+	t.stopShared()
+
+	// Workers flush their remaining groups once their queue is drained
+	for _, w := range t.workers {
+		close(w.in)
+	}
+	for _, w := range t.workers {
+		w.done.Wait()
+	}
+	if len(t.workers) == 0 && t.acc != nil {
+		for _, out := range t.flushIncomplete() {
+			t.acc.AddMetric(out)
+		}
+	}
+	// The last agent leaving the shared cache flushes the groups the other
+	// agents left
+	if t.shared != nil && t.shared.last && t.acc != nil {
+		t.mu.Lock()
+		t.adoptShared()
+		t.mu.Unlock()
+		for _, out := range t.flushIncomplete() {
+			t.acc.AddMetric(out)
+		}
+	}
+	t.workers = nil
+	t.stopPublisher()
+
+	// Export the cycles learned since the last tick
+	if t.BaselineExport != "" {
+		t.exportBaselines()
+	}
+
+	if t.history != nil {
+		if err := t.history.close(); err != nil {
+			return err
+		}
+	}
+	if t.shared != nil {
+		return t.shared.close()
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package cyclestats
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// sharedSyncInterval is how often the groups are synchronized with the
+// shared cache.
+const sharedSyncInterval = 100 * time.Millisecond
+
+// sharedCache holds the metrics of the groups in Redis, so agents receiving
+// parts of the same stream aggregate into the same cycles. Each group is a
+// list of metrics in line protocol, taken atomically by the agent flushing
+// it. The agents sharing the cache are registered with the time they last
+// synchronized, so the last one leaving knows to flush the groups left.
+type sharedCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+	agent  string
+	// last is set if the agent was the last one leaving the cache
+	last bool
+
+	mu         sync.Mutex
+	parser     *influx.Parser
+	serializer *serializer.Serializer
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+func newSharedCache(url, prefix string, ttl time.Duration) (*sharedCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &sharedCache{
+		client:     redis.NewClient(opts),
+		prefix:     prefix,
+		ttl:        ttl,
+		agent:      host + ":" + strconv.Itoa(os.Getpid()),
+		parser:     influx.NewParser(influx.NewMetricHandler()),
+		serializer: serializer.NewSerializer(),
+	}, nil
+}
+
+func (c *sharedCache) groupKey(groupkey string) string {
+	return c.prefix + "group:" + groupkey
+}
+
+func (c *sharedCache) agentsKey() string {
+	return c.prefix + "agents"
+}
+
+// sharedGroup is the state of a group in the shared cache as of a sync.
+type sharedGroup struct {
+	// fetched are the metrics added since the last sync, by all agents
+	fetched []string
+	// reset is set if the group was taken by another agent since the last
+	// sync, in which case fetched holds all metrics of the group
+	reset bool
+}
+
+// sync appends the metrics added to the groups since the last sync and
+// fetches the metrics added by all agents in a single round trip. synced
+// holds the number of metrics of each group known from the last sync.
+func (c *sharedCache) sync(added map[string][]telegraf.Metric, synced map[string]int) (map[string]*sharedGroup, error) {
+	lines := make(map[string][]interface{}, len(added))
+	for groupkey, ms := range added {
+		lines[groupkey] = c.serialize(ms)
+	}
+
+	lengths := make(map[string]*redis.IntCmd, len(synced))
+	fetched := make(map[string]*redis.StringSliceCmd, len(synced))
+	_, err := c.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		for groupkey, n := range synced {
+			key := c.groupKey(groupkey)
+			if len(lines[groupkey]) > 0 {
+				pipe.RPush(key, lines[groupkey]...)
+				pipe.PExpire(key, c.ttl)
+			}
+			lengths[groupkey] = pipe.LLen(key)
+			fetched[groupkey] = pipe.LRange(key, int64(n), -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*sharedGroup, len(synced))
+	for groupkey, n := range synced {
+		group := &sharedGroup{fetched: fetched[groupkey].Val()}
+		// Other agents only ever grow a group, a shorter one was taken and
+		// started over
+		if lengths[groupkey].Val() < int64(n+len(lines[groupkey])) {
+			group.reset = true
+			if group.fetched, err = c.client.LRange(c.groupKey(groupkey), 0, -1).Result(); err != nil {
+				return nil, err
+			}
+		}
+		groups[groupkey] = group
+	}
+	return groups, nil
+}
+
+// serialize returns the metrics in line protocol, skipping those that
+// cannot be serialized.
+func (c *sharedCache) serialize(ms []telegraf.Metric) []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lines := make([]interface{}, 0, len(ms))
+	for _, m := range ms {
+		line, err := c.serializer.Serialize(m)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, bytes.TrimSuffix(line, []byte("\n")))
+	}
+	return lines
+}
+
+// take appends the metrics added to a group since the last sync, then
+// removes the group and returns its metrics.
+func (c *sharedCache) take(groupkey string, added []telegraf.Metric) ([]telegraf.Metric, error) {
+	lines := c.serialize(added)
+
+	key := c.groupKey(groupkey)
+	var values *redis.StringSliceCmd
+	_, err := c.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		if len(lines) > 0 {
+			pipe.RPush(key, lines...)
+		}
+		values = pipe.LRange(key, 0, -1)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.parse(values.Val())
+}
+
+// register registers the agent as sharing the cache as of now.
+func (c *sharedCache) register() error {
+	return c.client.ZAdd(c.agentsKey(), redis.Z{Score: float64(time.Now().Unix()), Member: c.agent}).Err()
+}
+
+// leave unregisters the agent and reports whether any other agent is left.
+// Agents that did not sync within the TTL are considered gone.
+func (c *sharedCache) leave() (bool, error) {
+	stale := strconv.FormatInt(time.Now().Add(-c.ttl).Unix(), 10)
+	var left *redis.IntCmd
+	_, err := c.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZRem(c.agentsKey(), c.agent)
+		pipe.ZRemRangeByScore(c.agentsKey(), "-inf", "("+stale)
+		left = pipe.ZCard(c.agentsKey())
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return left.Val() > 0, nil
+}
+
+// groups returns the keys and metrics of all groups in the shared cache.
+func (c *sharedCache) groups() (map[string][]telegraf.Metric, error) {
+	groups := make(map[string][]telegraf.Metric)
+	prefix := c.groupKey("")
+	iter := c.client.Scan(0, prefix+"*", 0).Iterator()
+	for iter.Next() {
+		lines, err := c.client.LRange(iter.Val(), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		ms, err := c.parse(lines)
+		if err != nil {
+			return nil, err
+		}
+		if len(ms) > 0 {
+			groups[strings.TrimPrefix(iter.Val(), prefix)] = ms
+		}
+	}
+	return groups, iter.Err()
+}
+
+func (c *sharedCache) parse(lines []string) ([]telegraf.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ms := make([]telegraf.Metric, 0, len(lines))
+	for _, line := range lines {
+		m, err := c.parser.ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse shared metric: %v", err)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func (c *sharedCache) close() error {
+	return c.client.Close()
+}
+
+// startShared starts synchronizing the groups of the processors with the
+// shared cache if one is configured. It must be called once the shards are
+// started, as their processors hold the groups.
+func (t *CycleStats) startShared(acc telegraf.Accumulator) {
+	if t.shared == nil {
+		return
+	}
+
+	processors := []*CycleStats{t}
+	if len(t.workers) > 0 {
+		processors = make([]*CycleStats, 0, len(t.workers))
+		for _, w := range t.workers {
+			processors = append(processors, w.processor)
+		}
+	}
+
+	if err := t.shared.register(); err != nil {
+		t.Log.Errorf("Could not register with shared cache: %v", err)
+		t.reportProblem(problemStatePersistence)
+	}
+	t.shared.stop = make(chan struct{})
+	t.shared.done.Add(1)
+	go t.watchShared(acc, processors)
+}
+
+// watchShared keeps the agent registered, synchronizes the groups of the
+// processors with the shared cache and flushes the groups completed by the
+// metrics of other agents until Stop is called.
+func (t *CycleStats) watchShared(acc telegraf.Accumulator, processors []*CycleStats) {
+	defer t.shared.done.Done()
+
+	ticker := time.NewTicker(sharedSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.shared.stop:
+			return
+		case <-ticker.C:
+			if err := t.shared.register(); err != nil {
+				t.Log.Errorf("Could not register with shared cache: %v", err)
+				t.reportProblem(problemStatePersistence)
+			}
+			for _, p := range processors {
+				for _, m := range p.syncSharedGroups() {
+					acc.AddMetric(m)
+				}
+			}
+		}
+	}
+}
+
+// stopShared stops synchronizing the groups and unregisters the agent from
+// the shared cache, noting whether it was the last agent.
+func (t *CycleStats) stopShared() {
+	if t.shared == nil || t.shared.stop == nil {
+		return
+	}
+	close(t.shared.stop)
+	t.shared.done.Wait()
+	t.shared.stop = nil
+
+	others, err := t.shared.leave()
+	if err != nil {
+		t.Log.Errorf("Could not leave shared cache: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return
+	}
+	t.shared.last = !others
+}
+
+// syncSharedGroups synchronizes the groups with the shared cache and
+// flushes the devices whose groups completed.
+func (t *CycleStats) syncSharedGroups() []telegraf.Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed, err := t.syncShared()
+	if err != nil {
+		t.Log.Errorf("Could not sync shared groups: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return nil
+	}
+
+	var completed map[string]bool
+	for _, groupkey := range changed {
+		if !t.isComplete(groupkey) {
+			continue
+		}
+		if completed == nil {
+			completed = make(map[string]bool)
+		}
+		completed[t.deviceID(t.cache[groupkey][0])] = true
+	}
+	if len(completed) == 0 {
+		return nil
+	}
+	return t.push(completed)
+}
+
+// syncShared appends the metrics added to the cached groups since the last
+// sync to the shared cache and adds the metrics added by other agents to
+// the cached groups, whose metrics are then those of the shared cache. It
+// returns the groups that changed. The caller must hold the lock.
+func (t *CycleStats) syncShared() ([]string, error) {
+	if len(t.cache) == 0 {
+		return nil, nil
+	}
+
+	synced := make(map[string]int, len(t.cache))
+	added := make(map[string][]telegraf.Metric)
+	for groupkey, ms := range t.cache {
+		n := t.sharedSynced[groupkey]
+		synced[groupkey] = n
+		if len(ms) > n {
+			added[groupkey] = ms[n:]
+		}
+	}
+
+	groups, err := t.shared.sync(added, synced)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for groupkey, group := range groups {
+		fetched, err := t.shared.parse(group.fetched)
+		if err != nil {
+			return nil, err
+		}
+
+		ms := t.cache[groupkey]
+		n := synced[groupkey]
+		// The metrics added here are replaced by their shared copies
+		t.releaseSources(ms[n:], true)
+		if group.reset {
+			// Another agent flushed the metrics known before
+			t.releaseSources(ms[:n], true)
+			n = 0
+		}
+		if len(fetched) == 0 && len(ms) == n {
+			continue
+		}
+		if n+len(fetched) == 0 {
+			// Taken by another agent since
+			delete(t.cache, groupkey)
+			delete(t.keys, groupkey)
+			delete(t.updated, groupkey)
+			delete(t.sharedSynced, groupkey)
+			continue
+		}
+
+		t.cache[groupkey] = append(ms[:n:n], fetched...)
+		t.sharedSynced[groupkey] = n + len(fetched)
+		changed = append(changed, groupkey)
+	}
+	return changed, nil
+}
+
+// takeShared takes a group from the shared cache for flushing it, along
+// with the metrics added to it since the last sync. It returns false if
+// another agent flushed the group already.
+func (t *CycleStats) takeShared(groupkey string, ms []telegraf.Metric, synced int) ([]telegraf.Metric, bool) {
+	if t.shared == nil {
+		return ms, true
+	}
+
+	shared, err := t.shared.take(groupkey, ms[synced:])
+	if err != nil {
+		t.Log.Errorf("Could not take shared group, flushing the local copy: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return ms, true
+	}
+	t.releaseSources(ms, true)
+	if len(shared) == 0 {
+		return nil, false
+	}
+	// Groups flushed incomplete are tagged on their first metric
+	if incomplete, ok := ms[0].GetTag("incomplete"); ok {
+		shared[0].AddTag("incomplete", incomplete)
+	}
+	return shared, true
+}
+
+// adoptShared adds the groups left in the shared cache by the agents gone
+// to the cache, so the last agent leaving flushes them. The caller must
+// hold the lock.
+func (t *CycleStats) adoptShared() {
+	groups, err := t.shared.groups()
+	if err != nil {
+		t.Log.Errorf("Could not read shared groups left: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return
+	}
+	for groupkey, ms := range groups {
+		t.cache[groupkey] = ms
+		t.sharedSynced[groupkey] = len(ms)
+	}
+}
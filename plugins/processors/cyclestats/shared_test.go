@@ -0,0 +1,460 @@
+package cyclestats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+	serializer "github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// fakeRedis serves the Redis commands used by the shared cache from memory.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	lists map[string][]string
+	zsets map[string]map[string]float64
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{
+		listener: l,
+		lists:    make(map[string][]string),
+		zsets:    make(map[string]map[string]float64),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return r
+}
+
+func (r *fakeRedis) url() string {
+	return "redis://" + r.listener.Addr().String()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+	var queued [][]string
+	for {
+		cmd, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		switch name := strings.ToUpper(cmd[0]); {
+		case name == "MULTI":
+			queued = make([][]string, 0)
+			io.WriteString(conn, "+OK\r\n")
+		case name == "EXEC":
+			replies := make([]interface{}, 0, len(queued))
+			r.mu.Lock()
+			for _, cmd := range queued {
+				replies = append(replies, r.run(cmd))
+			}
+			r.mu.Unlock()
+			queued = nil
+			io.WriteString(conn, encodeReply(replies))
+		case queued != nil:
+			queued = append(queued, cmd)
+			io.WriteString(conn, "+QUEUED\r\n")
+		default:
+			r.mu.Lock()
+			reply := r.run(cmd)
+			r.mu.Unlock()
+			io.WriteString(conn, encodeReply(reply))
+		}
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		cmd = append(cmd, string(b[:size]))
+	}
+	return cmd, nil
+}
+
+func encodeReply(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return ":" + strconv.Itoa(v) + "\r\n"
+	case string:
+		return "+" + v + "\r\n"
+	case []string:
+		items := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			items = append(items, []byte(s))
+		}
+		return encodeReply(items)
+	case []byte:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		out := fmt.Sprintf("*%d\r\n", len(v))
+		for _, item := range v {
+			out += encodeReply(item)
+		}
+		return out
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// run runs a command, the caller must hold the lock.
+func (r *fakeRedis) run(cmd []string) interface{} {
+	args := cmd[1:]
+	switch strings.ToUpper(cmd[0]) {
+	case "PING":
+		return "PONG"
+	case "RPUSH":
+		r.lists[args[0]] = append(r.lists[args[0]], args[1:]...)
+		return len(r.lists[args[0]])
+	case "PEXPIRE":
+		return 1
+	case "LLEN":
+		return len(r.lists[args[0]])
+	case "LRANGE":
+		l := r.lists[args[0]]
+		start, _ := strconv.Atoi(args[1])
+		stop, _ := strconv.Atoi(args[2])
+		if stop < 0 || stop >= len(l) {
+			stop = len(l) - 1
+		}
+		if start > stop {
+			return []string{}
+		}
+		return append([]string{}, l[start:stop+1]...)
+	case "DEL":
+		if _, ok := r.lists[args[0]]; !ok {
+			return 0
+		}
+		delete(r.lists, args[0])
+		return 1
+	case "ZADD":
+		if r.zsets[args[0]] == nil {
+			r.zsets[args[0]] = make(map[string]float64)
+		}
+		score, _ := strconv.ParseFloat(args[1], 64)
+		r.zsets[args[0]][args[2]] = score
+		return 1
+	case "ZREM":
+		delete(r.zsets[args[0]], args[1])
+		return 1
+	case "ZREMRANGEBYSCORE":
+		// Only the "-inf" to "(<max>" range used by the cache
+		max, _ := strconv.ParseFloat(strings.TrimPrefix(args[2], "("), 64)
+		for member, score := range r.zsets[args[0]] {
+			if score < max {
+				delete(r.zsets[args[0]], member)
+			}
+		}
+		return 1
+	case "ZCARD":
+		return len(r.zsets[args[0]])
+	case "SCAN":
+		pattern := "*"
+		for i := 1; i < len(args)-1; i++ {
+			if strings.EqualFold(args[i], "match") {
+				pattern = args[i+1]
+			}
+		}
+		keys := make([]string, 0)
+		for key := range r.lists {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		return []interface{}{[]byte("0"), keys}
+	}
+	return nil
+}
+
+// newTestSharedCache returns a cache of the agent in the fake Redis.
+func newTestSharedCache(t *testing.T, r *fakeRedis, agent string) *sharedCache {
+	t.Helper()
+
+	opts, err := redis.ParseURL(r.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &sharedCache{
+		client:     redis.NewClient(opts),
+		prefix:     "cyclestats:",
+		ttl:        time.Minute,
+		agent:      agent,
+		parser:     influx.NewParser(influx.NewMetricHandler()),
+		serializer: serializer.NewSerializer(),
+	}
+	t.Cleanup(func() { c.close() })
+	return c
+}
+
+func flows(values ...int64) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0, len(values))
+	for i, v := range values {
+		out = append(out, metric.New("steam_stats", map[string]string{"id": "1"},
+			map[string]interface{}{"flows": v}, time.Unix(1600000000+int64(i), 0)))
+	}
+	return out
+}
+
+func flowsOf(t *testing.T, c *sharedCache, lines []string) []int64 {
+	t.Helper()
+
+	ms, err := c.parse(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]int64, 0, len(ms))
+	for _, m := range ms {
+		v, _ := m.GetField("flows")
+		out = append(out, v.(int64))
+	}
+	return out
+}
+
+func TestSharedSync(t *testing.T) {
+	tests := []struct {
+		name string
+		// other is run by another agent before the sync
+		other  func(t *testing.T, c *sharedCache)
+		added  []int64
+		synced int
+		want   []int64
+		reset  bool
+	}{
+		{
+			name:  "new group",
+			added: []int64{1, 2},
+			want:  []int64{1, 2},
+		},
+		{
+			name: "added by another agent",
+			other: func(t *testing.T, c *sharedCache) {
+				if _, err := c.sync(map[string][]telegraf.Metric{"g": flows(7)}, map[string]int{"g": 0}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			added: []int64{1},
+			want:  []int64{7, 1},
+		},
+		{
+			name: "taken by another agent",
+			other: func(t *testing.T, c *sharedCache) {
+				if _, err := c.sync(map[string][]telegraf.Metric{"g": flows(7, 8)}, map[string]int{"g": 0}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.take("g", flows(9)); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.sync(map[string][]telegraf.Metric{"g": flows(10)}, map[string]int{"g": 0}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			synced: 2,
+			want:   []int64{10},
+			reset:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeRedis(t)
+			local := newTestSharedCache(t, r, "local")
+			if tt.other != nil {
+				tt.other(t, newTestSharedCache(t, r, "other"))
+			}
+
+			added := map[string][]telegraf.Metric{}
+			if len(tt.added) > 0 {
+				added["g"] = flows(tt.added...)
+			}
+			groups, err := local.sync(added, map[string]int{"g": tt.synced})
+			if err != nil {
+				t.Fatal(err)
+			}
+			group := groups["g"]
+			if got := flowsOf(t, local, group.fetched); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("fetched %v, want %v", got, tt.want)
+			}
+			if group.reset != tt.reset {
+				t.Errorf("reset %v, want %v", group.reset, tt.reset)
+			}
+		})
+	}
+}
+
+func TestSharedTake(t *testing.T) {
+	r := newFakeRedis(t)
+	local := newTestSharedCache(t, r, "local")
+	other := newTestSharedCache(t, r, "other")
+
+	if _, err := other.sync(map[string][]telegraf.Metric{"g": flows(1, 2)}, map[string]int{"g": 0}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := local.take("g", flows(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 3 {
+		t.Errorf("took %d metrics, want 3", len(ms))
+	}
+
+	// A group is taken only once
+	if ms, err := other.take("g", nil); err != nil || len(ms) != 0 {
+		t.Errorf("took %v again, error %v", ms, err)
+	}
+	if groups, err := other.groups(); err != nil || len(groups) != 0 {
+		t.Errorf("groups %v left, error %v", groups, err)
+	}
+}
+
+func TestSharedLeave(t *testing.T) {
+	r := newFakeRedis(t)
+	local := newTestSharedCache(t, r, "local")
+	other := newTestSharedCache(t, r, "other")
+	for _, c := range []*sharedCache{local, other} {
+		if err := c.register(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if others, err := local.leave(); err != nil || !others {
+		t.Errorf("leaving first: others %v, error %v", others, err)
+	}
+	if others, err := other.leave(); err != nil || others {
+		t.Errorf("leaving last: others %v, error %v", others, err)
+	}
+
+	// Agents gone without leaving do not count after the TTL
+	r.mu.Lock()
+	r.zsets[local.agentsKey()] = map[string]float64{"crashed": float64(time.Now().Add(-time.Hour).Unix())}
+	r.mu.Unlock()
+	if err := local.register(); err != nil {
+		t.Fatal(err)
+	}
+	if others, err := local.leave(); err != nil || others {
+		t.Errorf("leaving after a crashed agent: others %v, error %v", others, err)
+	}
+}
+
+func TestSharedGroupsLeft(t *testing.T) {
+	r := newFakeRedis(t)
+	c := newTestSharedCache(t, r, "local")
+	added := map[string][]telegraf.Metric{"g1": flows(1), "g2": flows(2, 3)}
+	if _, err := c.sync(added, map[string]int{"g1": 0, "g2": 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := c.groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || len(groups["g1"]) != 1 || len(groups["g2"]) != 2 {
+		t.Errorf("got groups %v", groups)
+	}
+}
+
+func TestSharedCycle(t *testing.T) {
+	r := newFakeRedis(t)
+	agents := make([]*CycleStats, 0, 2)
+	accs := make([]*collect, 0, 2)
+	for _, agent := range []string{"a", "b"} {
+		p := newTestProcessor(t, func(p *CycleStats) {
+			p.Fields = map[string][]string{"steam_stats": {"flows", "pd_timeouts"}}
+			p.SharedCache = r.url()
+			p.DropOriginal = true
+			p.SampleCounts = true
+		})
+		// Both agents run in this process
+		p.shared.agent = agent
+		acc := &collect{}
+		if err := p.Start(acc); err != nil {
+			t.Fatal(err)
+		}
+		agents = append(agents, p)
+		accs = append(accs, acc)
+	}
+
+	// Each agent receives half of the cycle
+	ts := time.Unix(1600000000, 0)
+	if err := agents[0].Add(metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"flows": int64(10)}, ts), accs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := agents[1].Add(metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"pd_timeouts": int64(1)}, ts), accs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	emitted := func() []telegraf.Metric {
+		var out []telegraf.Metric
+		for _, acc := range accs {
+			acc.mu.Lock()
+			out = append(out, acc.metrics...)
+			acc.mu.Unlock()
+		}
+		return out
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(emitted()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, p := range agents {
+		if err := p.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := emitted()
+	if len(out) != 1 {
+		t.Fatalf("got %d aggregates, want 1: %v", len(out), out)
+	}
+	if !out[0].HasField("flows") || !out[0].HasField("pd_timeouts") {
+		t.Errorf("aggregate %v misses the fields of an agent", out[0])
+	}
+	if samples, _ := out[0].GetField("samples"); samples != int64(2) {
+		t.Errorf("aggregate built from %v metrics, want 2", samples)
+	}
+}
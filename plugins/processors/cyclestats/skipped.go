@@ -0,0 +1,32 @@
+package cyclestats
+
+import (
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// recordSkipped counts a metric skipped for having none of the configured
+// fields per measurement and logs every LogSkippedEvery-th of them, starting
+// with the first.
+func (t *CycleStats) recordSkipped(m telegraf.Metric) {
+	stat, ok := t.skipped[m.Name()]
+	if !ok {
+		stat = selfstat.Register("cyclestats", "skipped_metrics", map[string]string{"measurement": m.Name()})
+		t.skipped[m.Name()] = stat
+	}
+	stat.Incr(1)
+
+	if t.LogSkippedEvery <= 0 {
+		return
+	}
+	if count := stat.Get(); (count-1)%int64(t.LogSkippedEvery) == 0 {
+		keys := make([]string, 0, len(m.FieldList()))
+		for _, field := range m.FieldList() {
+			keys = append(keys, field.Key)
+		}
+		t.Log.Warnf("Skipped %d metrics of %q without matching fields, latest with fields %s",
+			count, m.Name(), strings.Join(keys, ","))
+	}
+}
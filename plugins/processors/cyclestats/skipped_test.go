@@ -0,0 +1,89 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// warnings is a logger keeping the warnings logged.
+type warnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *warnings) Warnf(format string, args ...interface{}) {
+	w.Warn(fmt.Sprintf(format, args...))
+}
+
+func (w *warnings) Warn(args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, fmt.Sprint(args...))
+}
+
+func (w *warnings) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.messages)
+}
+
+func (*warnings) Errorf(string, ...interface{}) {}
+func (*warnings) Error(...interface{})          {}
+func (*warnings) Debugf(string, ...interface{}) {}
+func (*warnings) Debug(...interface{})          {}
+func (*warnings) Infof(string, ...interface{})  {}
+func (*warnings) Info(...interface{})           {}
+
+func TestRecordSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		every   int
+		skipped int
+	}{
+		{name: "not logged", every: 0, skipped: 5},
+		{name: "every metric", every: 1, skipped: 3},
+		{name: "every third", every: 3, skipped: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &warnings{}
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.LogSkippedEvery = tt.every
+				p.DropOriginal = true
+			})
+			p.Log = log
+
+			// Counters are shared between processors, so are the metrics
+			// they are logged for
+			stat := selfstat.Register("cyclestats", "skipped_metrics", map[string]string{"measurement": "steam_stats"})
+			before := stat.Get()
+			want := 0
+			for count := before + 1; tt.every > 0 && count <= before+int64(tt.skipped); count++ {
+				if (count-1)%int64(tt.every) == 0 {
+					want++
+				}
+			}
+
+			start := time.Unix(1600000000, 0)
+			for i := 0; i < tt.skipped; i++ {
+				if out := applyAll(p, steamStats(nil, "firmware", "1.2", start)); len(out) != 0 {
+					t.Fatalf("skipped metric emitted: %v", out)
+				}
+			}
+			if out := applyAll(p, steamStats(nil, "flows", int64(10), start)); len(out) != 0 {
+				t.Fatalf("open cycle flushed: %v", out)
+			}
+
+			if got := stat.Get() - before; got != int64(tt.skipped) {
+				t.Errorf("counted %d skipped metrics, want %d", got, tt.skipped)
+			}
+			if log.count() != want {
+				t.Errorf("logged %d warnings, want %d: %v", log.count(), want, log.messages)
+			}
+		})
+	}
+}
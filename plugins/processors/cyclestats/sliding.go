@@ -0,0 +1,85 @@
+package cyclestats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// slidingWindow holds the samples of a series within the sliding window per
+// field, and when samples were last added.
+type slidingWindow struct {
+	samples map[string][]sample
+	updated time.Time
+}
+
+// slidingKey identifies the series of a measurement of a device whose
+// samples are kept for the sliding window.
+func (t *CycleStats) slidingKey(m telegraf.Metric) string {
+	return string(appendKeyPart(appendKeyPart(nil, m.Name()), t.deviceID(m)))
+}
+
+// slide adds the samples of a flushed group to the sliding window of its
+// series and replaces the group's samples with those of the window ending at
+// the group's latest sample, so statistics are computed over the window
+// rather than the group alone. Groups may be flushed out of order, so the
+// window keeps the samples within the window before the latest one seen.
+func (t *CycleStats) slide(aggregate telegraf.Metric, cols *columns) {
+	if t.SlidingWindow <= 0 || len(cols.values) == 0 {
+		return
+	}
+	length := time.Duration(t.SlidingWindow)
+	now := time.Now()
+	t.expireSliding(now)
+
+	key := t.slidingKey(aggregate)
+	window, ok := t.sliding[key]
+	if !ok {
+		window = &slidingWindow{samples: make(map[string][]sample)}
+		t.sliding[key] = window
+	}
+	window.updated = now
+
+	for field, values := range cols.values {
+		end := values[0].time
+		for _, v := range values[1:] {
+			if v.time.After(end) {
+				end = v.time
+			}
+		}
+
+		s := append(window.samples[field], values...)
+		sort.SliceStable(s, func(i, j int) bool { return s[i].time.Before(s[j].time) })
+		s = append([]sample(nil), s[firstAfter(s, s[len(s)-1].time.Add(-length)):]...)
+		window.samples[field] = s
+
+		from := firstAfter(s, end.Add(-length))
+		to := firstAfter(s, end)
+		cols.values[field] = append([]sample(nil), s[from:to]...)
+	}
+}
+
+// expireSliding drops the windows of series without samples added within
+// the sliding window, such as those of devices that disappeared, whose
+// samples would all be outside of their next window. They are checked at
+// most twice per sliding window.
+func (t *CycleStats) expireSliding(now time.Time) {
+	length := time.Duration(t.SlidingWindow)
+	if now.Sub(t.lastSlidingExpiry) < length/2 {
+		return
+	}
+	t.lastSlidingExpiry = now
+
+	for key, window := range t.sliding {
+		if now.Sub(window.updated) > length {
+			delete(t.sliding, key)
+		}
+	}
+}
+
+// firstAfter returns the index of the first of the time ordered samples
+// later than ts.
+func firstAfter(s []sample, ts time.Time) int {
+	return sort.Search(len(s), func(i int) bool { return s[i].time.After(ts) })
+}
@@ -0,0 +1,80 @@
+package cyclestats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// samplesAt returns samples at the given seconds from Unix 1600000000,
+// valued by their second.
+func samplesAt(seconds ...int) []sample {
+	start := time.Unix(1600000000, 0)
+	out := make([]sample, 0, len(seconds))
+	for _, s := range seconds {
+		out = append(out, sample{raw: int64(s), value: float64(s), numeric: true, time: start.Add(time.Duration(s) * time.Second)})
+	}
+	return out
+}
+
+func TestSlide(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.SlidingWindow = config.Duration(5 * time.Second)
+	})
+
+	tests := []struct {
+		name    string
+		device  string
+		seconds []int
+		want    string
+	}{
+		{name: "first group", device: "1", seconds: []int{0, 1, 2}, want: "[0 1 2]"},
+		{name: "within window", device: "1", seconds: []int{3, 4}, want: "[0 1 2 3 4]"},
+		{name: "slid", device: "1", seconds: []int{7, 8}, want: "[4 7 8]"},
+		{name: "out of order", device: "1", seconds: []int{5}, want: "[4 5]"},
+		{name: "other device", device: "2", seconds: []int{2}, want: "[2]"},
+	}
+	for _, tt := range tests {
+		aggregate := metric.New("steam_stats", map[string]string{"id": tt.device}, map[string]interface{}{}, time.Unix(1600000000, 0))
+		cols := &columns{values: map[string][]sample{"flows": samplesAt(tt.seconds...)}}
+		p.slide(aggregate, cols)
+
+		got := make([]float64, 0, len(cols.values["flows"]))
+		for _, s := range cols.values["flows"] {
+			got = append(got, s.value)
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s: samples %v, want %s", tt.name, got, tt.want)
+		}
+	}
+	if len(p.sliding) != 2 {
+		t.Errorf("got %d sliding windows, want 2", len(p.sliding))
+	}
+}
+
+func TestExpireSliding(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.SlidingWindow = config.Duration(time.Minute)
+	})
+
+	now := time.Now()
+	p.sliding["active"] = &slidingWindow{updated: now.Add(-30 * time.Second)}
+	p.sliding["gone"] = &slidingWindow{updated: now.Add(-2 * time.Minute)}
+	p.expireSliding(now)
+	if _, ok := p.sliding["gone"]; ok {
+		t.Errorf("window without samples within the sliding window kept")
+	}
+	if _, ok := p.sliding["active"]; !ok {
+		t.Errorf("active window dropped")
+	}
+
+	// Checked at most twice per sliding window
+	p.sliding["gone"] = &slidingWindow{updated: now.Add(-2 * time.Minute)}
+	p.expireSliding(now.Add(10 * time.Second))
+	if _, ok := p.sliding["gone"]; !ok {
+		t.Errorf("windows checked again within half the sliding window")
+	}
+}
@@ -0,0 +1,95 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// persistentState is the part of the processor state that survives restarts.
+type persistentState struct {
+	// Usage holds the lifetime usage of service items per device
+	Usage map[string]map[string]*serviceUsage `json:"usage"`
+
+	dirty bool
+	// mu guards the state shared between shards
+	mu sync.Mutex
+}
+
+func newPersistentState() *persistentState {
+	return &persistentState{
+		Usage: make(map[string]map[string]*serviceUsage),
+	}
+}
+
+func (s *persistentState) load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded := newPersistentState()
+	if err := json.Unmarshal(b, loaded); err != nil {
+		return err
+	}
+	s.Usage = loaded.Usage
+	return nil
+}
+
+// save writes the state to path, never leaving a truncated state file
+// behind.
+func (s *persistentState) save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0600)
+}
+
+// writeFileAtomic writes to a temporary file first and renames it over the
+// target, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveState persists the state if it changed since it was last written.
+func (t *CycleStats) saveState() {
+	if t.StateFile == "" {
+		return
+	}
+
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	if !t.state.dirty {
+		return
+	}
+
+	if err := t.state.save(t.StateFile); err != nil {
+		t.Log.Errorf("Could not save state file: %v", err)
+		t.reportProblem(problemStatePersistence)
+		return
+	}
+	t.state.dirty = false
+}
@@ -0,0 +1,83 @@
+package cyclestats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistentState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// A missing state file is a fresh start
+	s := newPersistentState()
+	if err := s.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Usage) != 0 {
+		t.Errorf("usage of a fresh start %v", s.Usage)
+	}
+
+	since := time.Unix(1600000000, 0).UTC()
+	s.Usage["1"] = map[string]*serviceUsage{"descale": {Usage: 12.5, Cycles: 3, Since: since}}
+	if err := s.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newPersistentState()
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	u, ok := loaded.Usage["1"]["descale"]
+	if !ok {
+		t.Fatalf("usage not loaded: %v", loaded.Usage)
+	}
+	if u.Usage != 12.5 || u.Cycles != 3 || !u.Since.Equal(since) {
+		t.Errorf("loaded usage %+v, want %+v", u, s.Usage["1"]["descale"])
+	}
+
+	if err := os.WriteFile(path, []byte(`{"usage": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := newPersistentState().load(path); err == nil {
+		t.Errorf("truncated state file loaded")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("file holds %q, want %q", b, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode %v, want 0600", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "state.json"), []byte("x"), 0o600); err == nil {
+		t.Errorf("wrote to a missing directory")
+	}
+}
@@ -0,0 +1,431 @@
+package cyclestats
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// sample is a single value of a field within a group.
+type sample struct {
+	raw     interface{}
+	value   float64
+	numeric bool
+	time    time.Time
+}
+
+// statistic adds the fields it computes from the time ordered samples of a
+// field to out.
+type statistic func(field string, samples []sample, out map[string]interface{})
+
+var statistics = map[string]statistic{
+	"delta":          statDelta,
+	"rate":           statRate,
+	"counter_resets": statCounterResets,
+	"first":          statFirst,
+	"last":           statLast,
+	"mean":           statMean,
+	"min":            statMin,
+	"max":            statMax,
+	"count_distinct": statCountDistinct,
+	"variance":       statVariance,
+	"stddev":         statStddev,
+	"median":         statMedian,
+	"time_weighted":  statTimeWeighted,
+}
+
+func validateStats(stats map[string][]string) error {
+	for field, names := range stats {
+		for _, name := range names {
+			if _, ok := statistics[name]; !ok {
+				return fmt.Errorf("unknown statistic %q for field %q", name, field)
+			}
+		}
+	}
+	return nil
+}
+
+func validateHistogram(histogram map[string][]float64) error {
+	for field, buckets := range histogram {
+		if len(buckets) == 0 {
+			return fmt.Errorf("histogram for field %q has no buckets", field)
+		}
+		for i, le := range buckets {
+			if math.IsNaN(le) || math.IsInf(le, 0) {
+				return fmt.Errorf("invalid histogram bucket %v for field %q", le, field)
+			}
+			if i > 0 && le <= buckets[i-1] {
+				return fmt.Errorf("histogram buckets for field %q must be in increasing order", field)
+			}
+		}
+	}
+	return nil
+}
+
+// hasStats returns true if statistics or a histogram are computed from the
+// samples of the field.
+func (t *CycleStats) hasStats(field string) bool {
+	return t.sampledFields[field]
+}
+
+// numericSamples returns only the samples with a numeric value.
+func numericSamples(samples []sample) []sample {
+	out := make([]sample, 0, len(samples))
+	for _, s := range samples {
+		if s.numeric {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// typed returns the value of one of the samples in the type the field was
+// reported in if all its values share that type, so integer counters stay
+// int64 and booleans stay bool. Values of mixed types are float64.
+func typed(samples []sample, i int) interface{} {
+	if commonType(samples) == nil {
+		return samples[i].value
+	}
+	return samples[i].raw
+}
+
+// less orders two samples by value, comparing integers as integers so
+// values beyond the 2^53 a float64 holds exactly are told apart.
+func less(a, b sample) bool {
+	switch x := a.raw.(type) {
+	case int64:
+		if y, ok := b.raw.(int64); ok {
+			return x < y
+		}
+	case uint64:
+		if y, ok := b.raw.(uint64); ok {
+			return x < y
+		}
+	}
+	return a.value < b.value
+}
+
+// commonType returns the first value of the samples if all of them are of
+// its type, or nil.
+func commonType(samples []sample) interface{} {
+	if len(samples) == 0 {
+		return nil
+	}
+	first := samples[0].raw
+	for _, s := range samples[1:] {
+		if reflect.TypeOf(s.raw) != reflect.TypeOf(first) {
+			return nil
+		}
+	}
+	return first
+}
+
+// computeStats adds the configured statistics over the metrics of a group to
+// its aggregate as "<field>_<statistic>" fields, from the running statistics
+// of the group where kept.
+func (t *CycleStats) computeStats(aggregate telegraf.Metric, cols *columns, running map[string]*runningStats) {
+	if len(t.Stats) == 0 && len(t.Histogram) == 0 {
+		return
+	}
+
+	out := statsPool.Get().(map[string]interface{})
+	defer func() {
+		for key := range out {
+			delete(out, key)
+		}
+		statsPool.Put(out)
+	}()
+
+	for field, names := range t.Stats {
+		s := cols.samples(field)
+		r := running[field]
+		for _, name := range names {
+			if stat, ok := runningStatistics[name]; ok && r != nil {
+				stat(field, r, out)
+				continue
+			}
+			if len(s) > 0 {
+				statistics[name](field, s, out)
+			}
+		}
+	}
+
+	for field, buckets := range t.Histogram {
+		s := cols.samples(field)
+		if len(s) == 0 {
+			continue
+		}
+		histogram(field, buckets, s, out)
+	}
+
+	for key, value := range out {
+		aggregate.AddField(key, value)
+	}
+}
+
+// counterDelta returns the increase of a counter over the samples and the
+// number of times it was reset. A decreasing value is taken as a reset, after
+// which the counter increased from zero to the value.
+func counterDelta(samples []sample) (float64, int64) {
+	var delta float64
+	var resets int64
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1].value, samples[i].value
+		if cur < prev {
+			resets++
+			delta += cur
+			continue
+		}
+		delta += cur - prev
+	}
+	return delta, resets
+}
+
+// integerDelta is counterDelta of integer counters, computed as integers
+// so that large counters keep their precision. It returns nil for other
+// fields.
+func integerDelta(samples []sample) interface{} {
+	switch commonType(samples).(type) {
+	case int64:
+		var delta int64
+		for i := 1; i < len(samples); i++ {
+			prev, cur := samples[i-1].raw.(int64), samples[i].raw.(int64)
+			if cur < prev {
+				delta += cur
+				continue
+			}
+			delta += cur - prev
+		}
+		return delta
+	case uint64:
+		var delta uint64
+		for i := 1; i < len(samples); i++ {
+			prev, cur := samples[i-1].raw.(uint64), samples[i].raw.(uint64)
+			if cur < prev {
+				delta += cur
+				continue
+			}
+			delta += cur - prev
+		}
+		return delta
+	}
+	return nil
+}
+
+// statDelta emits the increase of a counter from the first to the last
+// value, accounting for resets, in the type of the counter.
+func statDelta(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	if delta := integerDelta(s); delta != nil {
+		out[field+"_delta"] = delta
+		return
+	}
+	delta, _ := counterDelta(s)
+	// The delta of a boolean counts its rises
+	if _, ok := commonType(s).(bool); ok {
+		out[field+"_delta"] = int64(delta)
+		return
+	}
+	out[field+"_delta"] = delta
+}
+
+// statRate emits the delta normalized per second.
+func statRate(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) < 2 {
+		return
+	}
+	elapsed := s[len(s)-1].time.Sub(s[0].time).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	delta, _ := counterDelta(s)
+	out[field+"_rate"] = delta / elapsed
+}
+
+// statCounterResets emits the number of times a counter was reset.
+func statCounterResets(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	_, resets := counterDelta(s)
+	out[field+"_counter_resets"] = resets
+}
+
+// statFirst emits the earliest value of the field, of any type, and its time
+// in unix nanoseconds.
+func statFirst(field string, samples []sample, out map[string]interface{}) {
+	if len(samples) == 0 {
+		return
+	}
+	out[field+"_first"] = samples[0].raw
+	out[field+"_first_time"] = samples[0].time.UnixNano()
+}
+
+// statLast emits the latest value of the field, of any type, and its time in
+// unix nanoseconds.
+func statLast(field string, samples []sample, out map[string]interface{}) {
+	if len(samples) == 0 {
+		return
+	}
+	out[field+"_last"] = samples[len(samples)-1].raw
+	out[field+"_last_time"] = samples[len(samples)-1].time.UnixNano()
+}
+
+// statMean emits the arithmetic mean of the values.
+func statMean(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	out[field+"_mean"] = mean(s)
+}
+
+func mean(samples []sample) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s.value
+	}
+	return sum / float64(len(samples))
+}
+
+// statMin emits the smallest value in the type of the field.
+func statMin(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	min := 0
+	for i := range s[1:] {
+		if less(s[i+1], s[min]) {
+			min = i + 1
+		}
+	}
+	out[field+"_min"] = typed(s, min)
+}
+
+// statMax emits the largest value in the type of the field.
+func statMax(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	max := 0
+	for i := range s[1:] {
+		if less(s[max], s[i+1]) {
+			max = i + 1
+		}
+	}
+	out[field+"_max"] = typed(s, max)
+}
+
+// statCountDistinct emits the number of unique values of any type, such as
+// the different error codes seen.
+func statCountDistinct(field string, samples []sample, out map[string]interface{}) {
+	if len(samples) == 0 {
+		return
+	}
+	seen := make(map[interface{}]bool, len(samples))
+	for _, s := range samples {
+		seen[s.raw] = true
+	}
+	out[field+"_count_distinct"] = int64(len(seen))
+}
+
+// statVariance emits the sample variance of the values.
+func statVariance(field string, samples []sample, out map[string]interface{}) {
+	runningVariance(field, runningOf(samples), out)
+}
+
+// statStddev emits the sample standard deviation of the values.
+func statStddev(field string, samples []sample, out map[string]interface{}) {
+	runningStddev(field, runningOf(samples), out)
+}
+
+// runningOf returns the running statistics of the numeric samples, for
+// groups without running statistics.
+func runningOf(samples []sample) *runningStats {
+	r := &runningStats{}
+	for _, s := range samples {
+		if s.numeric {
+			r.add(s.value)
+		}
+	}
+	return r
+}
+
+// statMedian emits the middle of the sorted values, or the mean of the two
+// middle ones, which unlike min is not skewed by single glitched readings.
+// The middle value keeps the type of the field, the mean of two is a float.
+func statMedian(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+	sorted := make([]sample, len(s))
+	copy(sorted, s)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		out[field+"_median"] = typed(sorted, mid)
+		return
+	}
+	out[field+"_median"] = (sorted[mid-1].value + sorted[mid].value) / 2
+}
+
+// statTimeWeighted emits the mean of the values weighted by the time until
+// the next value, as each value holds until it is replaced. Bursts of values
+// then count no more than a single value over the same time. Without elapsed
+// time, such as for a single value, it falls back to the arithmetic mean.
+func statTimeWeighted(field string, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+
+	var sum, weights float64
+	for i := 0; i < len(s)-1; i++ {
+		w := s[i+1].time.Sub(s[i].time).Seconds()
+		sum += s[i].value * w
+		weights += w
+	}
+	if weights <= 0 {
+		out[field+"_time_weighted"] = mean(s)
+		return
+	}
+	out[field+"_time_weighted"] = sum / weights
+}
+
+// histogram emits the cumulative count of values less than or equal to each
+// bucket boundary as "<field>_bucket_le_<boundary>" fields, the way
+// Prometheus histograms are laid out, plus the count of all values as
+// "<field>_bucket_le_inf".
+func histogram(field string, buckets []float64, samples []sample, out map[string]interface{}) {
+	s := numericSamples(samples)
+	if len(s) == 0 {
+		return
+	}
+
+	for _, le := range buckets {
+		var count int64
+		for _, v := range s {
+			if v.value <= le {
+				count++
+			}
+		}
+		out[field+"_bucket_le_"+strconv.FormatFloat(le, 'f', -1, 64)] = count
+	}
+	out[field+"_bucket_le_inf"] = int64(len(s))
+}
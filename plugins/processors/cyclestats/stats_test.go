@@ -0,0 +1,225 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// samplesOf returns samples of the values a second apart.
+func samplesOf(values ...interface{}) []sample {
+	start := time.Unix(1600000000, 0)
+	out := make([]sample, 0, len(values))
+	for i, raw := range values {
+		v, numeric := toFloat(raw)
+		out = append(out, sample{raw: raw, value: v, numeric: numeric, time: start.Add(time.Duration(i) * time.Second)})
+	}
+	return out
+}
+
+func TestStatistics(t *testing.T) {
+	start := time.Unix(1600000000, 0).UnixNano()
+	tests := []struct {
+		name    string
+		stat    string
+		samples []sample
+		want    map[string]interface{}
+	}{
+		{
+			name:    "delta of integers",
+			stat:    "delta",
+			samples: samplesOf(int64(10), int64(15), int64(22)),
+			want:    map[string]interface{}{"f_delta": int64(12)},
+		},
+		{
+			name:    "delta across a reset",
+			stat:    "delta",
+			samples: samplesOf(int64(10), int64(15), int64(3), int64(5)),
+			want:    map[string]interface{}{"f_delta": int64(10)},
+		},
+		{
+			name:    "delta beyond float precision",
+			stat:    "delta",
+			samples: samplesOf(int64(1<<53+1), int64(1<<53+4)),
+			want:    map[string]interface{}{"f_delta": int64(3)},
+		},
+		{
+			name:    "delta of unsigned integers",
+			stat:    "delta",
+			samples: samplesOf(uint64(7), uint64(2), uint64(4)),
+			want:    map[string]interface{}{"f_delta": uint64(4)},
+		},
+		{
+			name:    "delta of floats",
+			stat:    "delta",
+			samples: samplesOf(1.5, 2.5, 4.0),
+			want:    map[string]interface{}{"f_delta": 2.5},
+		},
+		{
+			name:    "delta counts the rises of a boolean",
+			stat:    "delta",
+			samples: samplesOf(false, true, false, true, true),
+			want:    map[string]interface{}{"f_delta": int64(2)},
+		},
+		{
+			name:    "delta of mixed types",
+			stat:    "delta",
+			samples: samplesOf(int64(1), 2.5),
+			want:    map[string]interface{}{"f_delta": 1.5},
+		},
+		{
+			name:    "delta ignores strings",
+			stat:    "delta",
+			samples: samplesOf("closed", "open"),
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "rate",
+			stat:    "rate",
+			samples: samplesOf(int64(10), int64(14), int64(2)),
+			want:    map[string]interface{}{"f_rate": 3.0},
+		},
+		{
+			name:    "rate of a single value",
+			stat:    "rate",
+			samples: samplesOf(int64(10)),
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "counter resets",
+			stat:    "counter_resets",
+			samples: samplesOf(int64(10), int64(1), int64(5), int64(0)),
+			want:    map[string]interface{}{"f_counter_resets": int64(2)},
+		},
+		{
+			name:    "first",
+			stat:    "first",
+			samples: samplesOf("closed", "open"),
+			want:    map[string]interface{}{"f_first": "closed", "f_first_time": start},
+		},
+		{
+			name:    "last",
+			stat:    "last",
+			samples: samplesOf(int64(1), int64(2), int64(3)),
+			want:    map[string]interface{}{"f_last": int64(3), "f_last_time": start + 2*int64(time.Second)},
+		},
+		{
+			name:    "mean",
+			stat:    "mean",
+			samples: samplesOf(int64(1), 2.0, "x", int64(6)),
+			want:    map[string]interface{}{"f_mean": 3.0},
+		},
+		{
+			name:    "min keeps the type",
+			stat:    "min",
+			samples: samplesOf(int64(4), int64(-2), int64(3)),
+			want:    map[string]interface{}{"f_min": int64(-2)},
+		},
+		{
+			name:    "min beyond float precision",
+			stat:    "min",
+			samples: samplesOf(uint64(1<<53+1), uint64(1<<53)),
+			want:    map[string]interface{}{"f_min": uint64(1 << 53)},
+		},
+		{
+			name:    "max of mixed types",
+			stat:    "max",
+			samples: samplesOf(int64(4), 4.5),
+			want:    map[string]interface{}{"f_max": 4.5},
+		},
+		{
+			name:    "count distinct",
+			stat:    "count_distinct",
+			samples: samplesOf("E1", "E2", "E1", int64(1)),
+			want:    map[string]interface{}{"f_count_distinct": int64(3)},
+		},
+		{
+			name:    "variance",
+			stat:    "variance",
+			samples: samplesOf(2.0, 4.0, 4.0, 4.0, 5.0, 5.0, 7.0, 9.0),
+			want:    map[string]interface{}{"f_variance": 32.0 / 7},
+		},
+		{
+			name:    "variance of a single value",
+			stat:    "variance",
+			samples: samplesOf(2.0),
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "stddev",
+			stat:    "stddev",
+			samples: samplesOf(int64(1), int64(3)),
+			want:    map[string]interface{}{"f_stddev": 1.4142135623730951},
+		},
+		{
+			name:    "median of an odd count keeps the type",
+			stat:    "median",
+			samples: samplesOf(int64(9), int64(1), int64(5)),
+			want:    map[string]interface{}{"f_median": int64(5)},
+		},
+		{
+			name:    "median of an even count",
+			stat:    "median",
+			samples: samplesOf(int64(9), int64(1), int64(5), int64(2)),
+			want:    map[string]interface{}{"f_median": 3.5},
+		},
+		{
+			name: "time weighted",
+			stat: "time_weighted",
+			samples: []sample{
+				{raw: 10.0, value: 10, numeric: true, time: time.Unix(0, 0)},
+				{raw: 20.0, value: 20, numeric: true, time: time.Unix(3, 0)},
+				{raw: 0.0, value: 0, numeric: true, time: time.Unix(4, 0)},
+			},
+			want: map[string]interface{}{"f_time_weighted": 12.5},
+		},
+		{
+			name:    "time weighted without elapsed time",
+			stat:    "time_weighted",
+			samples: samplesOf(int64(4)),
+			want:    map[string]interface{}{"f_time_weighted": 4.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := make(map[string]interface{})
+			statistics[tt.stat]("f", tt.samples, out)
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Errorf("got %v, want %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	out := make(map[string]interface{})
+	histogram("f", []float64{0, 1.5, 10}, samplesOf(-1.0, int64(1), 1.5, "x", 12.0), out)
+
+	want := map[string]interface{}{
+		"f_bucket_le_0":   int64(1),
+		"f_bucket_le_1.5": int64(3),
+		"f_bucket_le_10":  int64(3),
+		"f_bucket_le_inf": int64(4),
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+func TestValidateHistogram(t *testing.T) {
+	tests := []struct {
+		buckets []float64
+		ok      bool
+	}{
+		{buckets: []float64{1, 2, 3}, ok: true},
+		{buckets: nil, ok: false},
+		{buckets: []float64{1, 1}, ok: false},
+		{buckets: []float64{2, 1}, ok: false},
+	}
+	for _, tt := range tests {
+		err := validateHistogram(map[string][]float64{"f": tt.buckets})
+		if (err == nil) != tt.ok {
+			t.Errorf("buckets %v: got error %v, want ok %v", tt.buckets, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package testutil generates realistic metric sequences of the steam, grind
+// and failure cycles aggregated by the cyclestats processor, for exercising
+// it deterministically in tests and benchmarks.
+//
+// Like the gateway, the generated cycles report every field as its own
+// metric, Interval apart, in the order the processor is configured with by
+// default.
+package testutil
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// field is a generated field and its value in a nominal cycle.
+type field struct {
+	name  string
+	value interface{}
+}
+
+var steamParams = []field{
+	{"steam_type", "autoclave"},
+	{"cook_temp", 134.2},
+	{"control_temp", 133.8},
+	{"hot_drain_temp", 92.5},
+	{"pv_unsafe", false},
+	{"pv_too_low", false},
+	{"drain_open_duration", int64(12)},
+	{"drain_to_sec1", int64(4)},
+	{"drain_to_sec2", int64(7)},
+	{"wait_pressure", 210.5},
+}
+
+var grinder = []field{
+	{"grinder_state", int64(3)},
+	{"jack_status", int64(1)},
+	{"switches_bottom", int64(0)},
+	{"switches_top", int64(1)},
+	{"reversals", int64(12)},
+}
+
+// LidFailures are the failures a failure cycle can report.
+var LidFailures = []string{
+	"top_lid_open_failed",
+	"top_lid_close_failed",
+	"bottom_lid_open_failed",
+	"bottom_lid_close_failed",
+	"inside_shroud_open_failed",
+	"inside_shroud_close_failed",
+	"accumulator_not_pressurized",
+	"seals_vacuum_failed",
+	"jack_up_failed",
+	"close_seals_failed",
+	"vent_seals_failed",
+	"compressor_throttled",
+	"pv_mismatch",
+}
+
+// CycleFunc generates the metrics of a cycle of a device starting at start.
+type CycleFunc func(device string, start time.Time) []telegraf.Metric
+
+// Generator generates cycles. The same seed and settings always generate
+// the same metrics.
+type Generator struct {
+	// DeviceTag is the tag holding the device, "id" by default
+	DeviceTag string
+	// Interval is the time between the metrics of a cycle, 50ms by default
+	Interval time.Duration
+	// Noise is the standard deviation of the float fields relative to their
+	// nominal value, 0 for none
+	Noise float64
+
+	rand *rand.Rand
+	// stopCooks counts the steam cycles per device for stop_cook_count
+	stopCooks map[string]int64
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		DeviceTag: "id",
+		Interval:  50 * time.Millisecond,
+		rand:      rand.New(rand.NewSource(seed)),
+		stopCooks: make(map[string]int64),
+	}
+}
+
+// SteamCycle generates the steam_params and steam_stats of a successful
+// steam cycle. stop_cook_count increments with every steam cycle of the
+// device.
+func (g *Generator) SteamCycle(device string, start time.Time) []telegraf.Metric {
+	g.stopCooks[device]++
+	stats := []field{
+		{"error", int64(0)},
+		{"flows", int64(3)},
+		{"pd_timeouts", int64(0)},
+		{"stag_recoveries", int64(0)},
+		{"stop_cook_count", g.stopCooks[device]},
+	}
+
+	out := g.metrics("steam_params", device, start, steamParams)
+	return append(out, g.metrics("steam_stats", device, start.Add(time.Duration(len(out))*g.Interval), stats)...)
+}
+
+// GrindCycle generates the grinder metrics of a grind cycle.
+func (g *Generator) GrindCycle(device string, start time.Time) []telegraf.Metric {
+	return g.metrics("grinder", device, start, grinder)
+}
+
+// FailureCycle generates the vessel_lid_failure metrics of a cycle failing
+// with one of the LidFailures and the error code.
+func (g *Generator) FailureCycle(device string, start time.Time, failure string, code int64) []telegraf.Metric {
+	fields := make([]field, 0, len(LidFailures)+1)
+	for _, name := range LidFailures {
+		fields = append(fields, field{name, name == failure})
+	}
+	fields = append(fields, field{"error", code})
+	return g.metrics("vessel_lid_failure", device, start, fields)
+}
+
+// Failure returns a CycleFunc generating failure cycles with the given
+// failure and error code.
+func (g *Generator) Failure(failure string, code int64) CycleFunc {
+	return func(device string, start time.Time) []telegraf.Metric {
+		return g.FailureCycle(device, start, failure, code)
+	}
+}
+
+// Cycles generates n cycles of a device, every apart, starting at start.
+func (g *Generator) Cycles(device string, start time.Time, n int, every time.Duration, cycle CycleFunc) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0)
+	for i := 0; i < n; i++ {
+		out = append(out, cycle(device, start.Add(time.Duration(i)*every))...)
+	}
+	return out
+}
+
+// metrics returns a metric per field, Interval apart.
+func (g *Generator) metrics(measurement, device string, start time.Time, fields []field) []telegraf.Metric {
+	tags := map[string]string{g.DeviceTag: device}
+	out := make([]telegraf.Metric, 0, len(fields))
+	for i, f := range fields {
+		ts := start.Add(time.Duration(i) * g.Interval)
+		out = append(out, metric.New(measurement, tags, map[string]interface{}{f.name: g.noisy(f.value)}, ts))
+	}
+	return out
+}
+
+// noisy adds noise to float values.
+func (g *Generator) noisy(value interface{}) interface{} {
+	v, ok := value.(float64)
+	if !ok || g.Noise == 0 {
+		return value
+	}
+	return v * (1 + g.Noise*g.rand.NormFloat64())
+}
@@ -0,0 +1,96 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// threshold is a limit on the value of a field, parsed from a condition like
+// "hot_drain_temp > 95".
+type threshold struct {
+	condition string
+	field     string
+	op        string
+	limit     float64
+}
+
+func parseThreshold(condition string) (*threshold, error) {
+	parts := strings.Fields(condition)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid threshold %q, expected \"<field> <operator> <value>\"", condition)
+	}
+
+	switch parts[1] {
+	case ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("invalid operator %q in threshold %q", parts[1], condition)
+	}
+
+	limit, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value in threshold %q: %v", condition, err)
+	}
+
+	return &threshold{condition: condition, field: parts[0], op: parts[1], limit: limit}, nil
+}
+
+func (th *threshold) exceeded(v float64) bool {
+	switch th.op {
+	case ">":
+		return v > th.limit
+	case ">=":
+		return v >= th.limit
+	case "<":
+		return v < th.limit
+	case "<=":
+		return v <= th.limit
+	}
+	return false
+}
+
+// checkThresholds returns an alert metric for every threshold the metric
+// crosses. A threshold alerts once when crossed and again only after the
+// field returned within the threshold.
+func (t *CycleStats) checkThresholds(m telegraf.Metric) []telegraf.Metric {
+	if len(t.thresholds) == 0 {
+		return nil
+	}
+
+	device := t.deviceID(m)
+	alerts := make([]telegraf.Metric, 0)
+	for _, th := range t.thresholds {
+		value, ok := m.GetField(th.field)
+		if !ok {
+			continue
+		}
+		v, ok := toFloat(value)
+		if !ok {
+			continue
+		}
+
+		if _, ok := t.crossed[device]; !ok {
+			t.crossed[device] = make(map[*threshold]bool)
+		}
+		exceeded := th.exceeded(v)
+		if !exceeded || t.crossed[device][th] {
+			t.crossed[device][th] = exceeded
+			continue
+		}
+		t.crossed[device][th] = true
+
+		tags := map[string]string{"alert": "threshold", "field": th.field, "condition": th.condition}
+		if device != "" {
+			tags[t.DeviceTag] = device
+		}
+		alerts = append(alerts, metric.New("cyclestats_alert", tags, map[string]interface{}{
+			"value":     v,
+			"threshold": th.limit,
+		}, m.Time()))
+	}
+
+	return alerts
+}
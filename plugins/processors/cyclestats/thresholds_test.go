@@ -0,0 +1,99 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		condition string
+		ok        bool
+	}{
+		{condition: "hot_drain_temp > 95", ok: true},
+		{condition: "wait_pressure <= -0.5", ok: true},
+		{condition: "hot_drain_temp>95", ok: false},
+		{condition: "hot_drain_temp == 95", ok: false},
+		{condition: "hot_drain_temp > hot", ok: false},
+		{condition: "hot_drain_temp > 95 and more", ok: false},
+	}
+	for _, tt := range tests {
+		_, err := parseThreshold(tt.condition)
+		if (err == nil) != tt.ok {
+			t.Errorf("threshold %q: got error %v, want ok %v", tt.condition, err, tt.ok)
+		}
+	}
+}
+
+func TestThresholdExceeded(t *testing.T) {
+	tests := []struct {
+		condition string
+		value     float64
+		want      bool
+	}{
+		{condition: "f > 95", value: 95, want: false},
+		{condition: "f > 95", value: 95.1, want: true},
+		{condition: "f >= 95", value: 95, want: true},
+		{condition: "f < 1", value: 1, want: false},
+		{condition: "f < 1", value: 0.5, want: true},
+		{condition: "f <= 1", value: 1, want: true},
+	}
+	for _, tt := range tests {
+		th, err := parseThreshold(tt.condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := th.exceeded(tt.value); got != tt.want {
+			t.Errorf("%v exceeds %q: %v, want %v", tt.value, tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.Thresholds = []string{"hot_drain_temp > 95"}
+	})
+
+	tests := []struct {
+		device string
+		value  interface{}
+		alert  bool
+	}{
+		{device: "1", value: 90.0},
+		{device: "1", value: 96.0, alert: true},
+		// Alerted only once while the threshold stays crossed
+		{device: "1", value: 97.0},
+		{device: "2", value: int64(99), alert: true},
+		{device: "1", value: 94.0},
+		{device: "1", value: 96.5, alert: true},
+		{device: "1", value: "n/a"},
+	}
+	start := time.Unix(1600000000, 0)
+	for i, tt := range tests {
+		m := metric.New("steam_params", map[string]string{"id": tt.device},
+			map[string]interface{}{"hot_drain_temp": tt.value}, start.Add(time.Duration(i)*time.Second))
+		alerts := p.checkThresholds(m)
+		if (len(alerts) > 0) != tt.alert {
+			t.Fatalf("step %d: got alerts %v, want alert %v", i, alerts, tt.alert)
+		}
+		if !tt.alert {
+			continue
+		}
+
+		alert := alerts[0]
+		if device, _ := alert.GetTag("id"); device != tt.device {
+			t.Errorf("step %d: alert of device %q, want %q", i, device, tt.device)
+		}
+		if condition, _ := alert.GetTag("condition"); condition != "hot_drain_temp > 95" {
+			t.Errorf("step %d: alert of condition %q", i, condition)
+		}
+		if v, _ := toFloat(tt.value); alert.Fields()["value"] != v {
+			t.Errorf("step %d: alert value %v, want %v", i, alert.Fields()["value"], v)
+		}
+		if !alert.Time().Equal(m.Time()) {
+			t.Errorf("step %d: alert at %v, want %v", i, alert.Time(), m.Time())
+		}
+	}
+}
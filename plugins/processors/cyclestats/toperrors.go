@@ -0,0 +1,175 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// TopErrors configures the tracking of the most frequent error values of
+// the cycles per device and period.
+type TopErrors struct {
+	Measurement string          `toml:"measurement"`
+	Field       string          `toml:"field"`
+	N           int             `toml:"n"`
+	Period      config.Duration `toml:"period"`
+}
+
+func (e *TopErrors) init() error {
+	if e.Field == "" {
+		e.Field = "error"
+	}
+	if e.N == 0 {
+		e.N = 3
+	}
+	if e.N < 0 {
+		return fmt.Errorf("top_errors n must be positive")
+	}
+	if e.Period == 0 {
+		e.Period = config.Duration(time.Hour)
+	}
+	if e.Period < 0 {
+		return fmt.Errorf("top_errors period must be positive")
+	}
+	return nil
+}
+
+// errorCount is the number of cycles of a period failing with an error
+// value.
+type errorCount struct {
+	value interface{}
+	count int64
+}
+
+// errorPeriod counts the error values of a device within a period.
+type errorPeriod struct {
+	start  time.Time
+	counts map[string]*errorCount
+
+	// last is the time of the latest cycle and seen when it was flushed
+	last time.Time
+	seen time.Time
+}
+
+// trackErrors counts the error value of a flushed cycle in the current
+// period of its device and returns the top errors of the previous period
+// once a cycle of a later period arrives. Periods without such a cycle are
+// ended by endTopErrors. Zero and empty values are no error, and only
+// devices with errors in a period are tracked.
+func (t *CycleStats) trackErrors(aggregate telegraf.Metric) []telegraf.Metric {
+	e := t.TopErrors
+	if e == nil || (e.Measurement != "" && aggregate.Name() != e.Measurement) {
+		return nil
+	}
+
+	device := t.deviceID(aggregate)
+	start := aggregate.Time().Truncate(time.Duration(e.Period))
+
+	out := make([]telegraf.Metric, 0, 1)
+	p, ok := t.topErrors[device]
+	if ok && start.After(p.start) {
+		out = append(out, t.topErrorsMetric(device, p))
+		delete(t.topErrors, device)
+		ok = false
+	}
+	if ok {
+		if aggregate.Time().After(p.last) {
+			p.last = aggregate.Time()
+		}
+		p.seen = time.Now()
+	}
+
+	value, found := aggregate.GetField(e.Field)
+	if !found {
+		return out
+	}
+	key, found := enumKey(value)
+	if !found || key == "" || key == "0" || key == "false" {
+		return out
+	}
+
+	if !ok {
+		p = &errorPeriod{
+			start:  start,
+			counts: make(map[string]*errorCount),
+			last:   aggregate.Time(),
+			seen:   time.Now(),
+		}
+		t.topErrors[device] = p
+	}
+
+	c, ok := p.counts[key]
+	if !ok {
+		c = &errorCount{value: value}
+		p.counts[key] = c
+	}
+	c.count++
+
+	return out
+}
+
+// endTopErrors returns the top errors of the periods that ended by now on
+// the clock of their device.
+func (t *CycleStats) endTopErrors(now time.Time) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0)
+	for device, p := range t.topErrors {
+		end := p.start.Add(time.Duration(t.TopErrors.Period))
+		if deviceClock(p.last, p.seen, now).Before(end) {
+			continue
+		}
+		out = append(out, t.topErrorsMetric(device, p))
+		delete(t.topErrors, device)
+	}
+	return out
+}
+
+// flushTopErrors returns the top errors of all open periods on shutdown,
+// tagged as incomplete.
+func (t *CycleStats) flushTopErrors() []telegraf.Metric {
+	out := make([]telegraf.Metric, 0, len(t.topErrors))
+	for device, p := range t.topErrors {
+		m := t.topErrorsMetric(device, p)
+		m.AddTag("incomplete", "true")
+		out = append(out, m)
+	}
+	t.topErrors = make(map[string]*errorPeriod)
+	return out
+}
+
+// topErrorsMetric returns the N most frequent errors of a period as the
+// fields <field>_top1, <field>_top1_count and so on. Errors as frequent are
+// ordered by value.
+func (t *CycleStats) topErrorsMetric(device string, p *errorPeriod) telegraf.Metric {
+	keys := make([]string, 0, len(p.counts))
+	for key := range p.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := p.counts[keys[i]], p.counts[keys[j]]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > t.TopErrors.N {
+		keys = keys[:t.TopErrors.N]
+	}
+
+	fields := make(map[string]interface{}, 2*len(keys))
+	for i, key := range keys {
+		name := t.TopErrors.Field + "_top" + strconv.Itoa(i+1)
+		fields[name] = p.counts[key].value
+		fields[name+"_count"] = p.counts[key].count
+	}
+
+	tags := map[string]string{}
+	if device != "" {
+		tags[t.DeviceTag] = device
+	}
+	return metric.New("cyclestats_top_errors", tags, fields, p.start)
+}
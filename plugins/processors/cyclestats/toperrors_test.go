@@ -0,0 +1,76 @@
+package cyclestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestTopErrors(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.TopErrors = &TopErrors{Measurement: "steam_stats", N: 2}
+	})
+
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	var out []telegraf.Metric
+	for i, code := range []interface{}{int64(7), int64(0), int64(3), int64(7), int64(5), int64(3), "", int64(7), int64(5)} {
+		out = append(out, p.trackErrors(metric.New("steam_stats", map[string]string{"id": "1"},
+			map[string]interface{}{"error": code}, start.Add(time.Duration(i)*time.Minute)))...)
+	}
+	// Other measurements are not counted
+	out = append(out, p.trackErrors(metric.New("grinder", map[string]string{"id": "1"},
+		map[string]interface{}{"error": int64(9)}, start.Add(10*time.Minute)))...)
+	if len(out) != 0 {
+		t.Fatalf("period ended early: %v", out)
+	}
+
+	// A cycle of the next period ends the period, even without an error
+	out = p.trackErrors(metric.New("steam_stats", map[string]string{"id": "1"},
+		map[string]interface{}{"error": int64(0)}, start.Add(time.Hour)))
+	if len(out) != 1 {
+		t.Fatalf("got %v when the period ended, want its top errors", out)
+	}
+	// Errors as frequent are ordered by value
+	want := map[string]interface{}{
+		"error_top1":       int64(7),
+		"error_top1_count": int64(3),
+		"error_top2":       int64(3),
+		"error_top2_count": int64(2),
+	}
+	if got := out[0].Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got top errors %v, want %v", got, want)
+	}
+	if !out[0].Time().Equal(start) {
+		t.Errorf("period starting at %v, want %v", out[0].Time(), start)
+	}
+	if len(p.topErrors) != 0 {
+		t.Errorf("device without errors in the period tracked: %v", p.topErrors)
+	}
+}
+
+func TestEndTopErrors(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.TopErrors = &TopErrors{}
+	})
+	p.trackErrors(metric.New("steam_stats", map[string]string{"id": "1"},
+		map[string]interface{}{"error": "E42"}, time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC)))
+
+	now := time.Now()
+	if out := p.endTopErrors(now); len(out) != 0 {
+		t.Errorf("period ended early: %v", out)
+	}
+	out := p.endTopErrors(now.Add(31 * time.Minute))
+	if len(out) != 1 || out[0].Fields()["error_top1"] != "E42" {
+		t.Errorf("got %v when the period ended, want its top errors", out)
+	}
+
+	p.trackErrors(metric.New("steam_stats", map[string]string{"id": "1"},
+		map[string]interface{}{"error": "E42"}, time.Date(2022, 3, 1, 11, 30, 0, 0, time.UTC)))
+	out = p.flushTopErrors()
+	if len(out) != 1 || !out[0].HasTag("incomplete") {
+		t.Errorf("got %v on shutdown, want the open period tagged incomplete", out)
+	}
+}
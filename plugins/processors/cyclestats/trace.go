@@ -0,0 +1,68 @@
+package cyclestats
+
+import (
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// tracing reports whether the handling of a metric, or of the group it
+// belongs to, is logged. Like tagpass, a metric passes debug_tagpass if any
+// of its tags matches.
+func (t *CycleStats) tracing(m telegraf.Metric) bool {
+	if !t.DebugMetrics {
+		return false
+	}
+	if len(t.debugTagpass) == 0 {
+		return true
+	}
+	return passes(t.debugTagpass, m)
+}
+
+// traceAssigned logs the group a metric was added to and its fields
+// aggregated over.
+func (t *CycleStats) traceAssigned(m telegraf.Metric, groupkey string) {
+	if !t.tracing(m) {
+		return
+	}
+	matched := make([]string, 0, len(m.FieldList()))
+	for _, f := range m.FieldList() {
+		if ok, _ := t.matchField(m, f.Key); ok {
+			matched = append(matched, f.Key)
+		}
+	}
+	t.Log.Debugf("Metric %q of device %q at %s assigned to group %q, matched fields %s",
+		m.Name(), t.deviceID(m), m.Time().UTC().Format(time.RFC3339Nano), groupkey, strings.Join(matched, ","))
+}
+
+// traceSkipped logs a metric without any of the fields of its measurement.
+func (t *CycleStats) traceSkipped(m telegraf.Metric) {
+	if !t.tracing(m) {
+		return
+	}
+	t.Log.Debugf("Metric %q of device %q at %s matched no fields, skipped",
+		m.Name(), t.deviceID(m), m.Time().UTC().Format(time.RFC3339Nano))
+}
+
+// traceComplete logs whether a group updated by the last metrics is
+// complete, and so flushes the groups of its device.
+func (t *CycleStats) traceComplete(groupkey string, complete bool) {
+	ms := t.cache[groupkey]
+	if len(ms) == 0 || !t.tracing(ms[0]) {
+		return
+	}
+	if complete {
+		t.Log.Debugf("Group %q complete, flushing the groups of device %q", groupkey, t.deviceID(ms[0]))
+		return
+	}
+	t.Log.Debugf("Group %q incomplete with %d metrics, waiting", groupkey, len(ms))
+}
+
+// traceFlush logs the flush of a group.
+func (t *CycleStats) traceFlush(groupkey string, ms []telegraf.Metric) {
+	if len(ms) == 0 || !t.tracing(ms[0]) {
+		return
+	}
+	t.Log.Debugf("Flushing group %q of device %q with %d metrics", groupkey, t.deviceID(ms[0]), len(ms))
+}
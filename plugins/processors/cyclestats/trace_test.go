@@ -0,0 +1,88 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// debugs is a logger keeping the debug messages logged.
+type debugs struct {
+	warnings
+}
+
+func (d *debugs) Debugf(format string, args ...interface{}) {
+	d.Warn(fmt.Sprintf(format, args...))
+}
+
+func TestTraceMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		tagpass map[string][]string
+		// traced holds the devices whose metrics are traced
+		traced string
+	}{
+		{name: "disabled", traced: ""},
+		{name: "all metrics", enabled: true, traced: "1,2"},
+		{name: "tagpass", enabled: true, tagpass: map[string][]string{"id": {"2"}}, traced: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &debugs{}
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.DebugMetrics = tt.enabled
+				p.DebugTagpass = tt.tagpass
+				p.DropOriginal = true
+			})
+			p.Log = log
+
+			start := time.Unix(1600000000, 0)
+			for _, device := range []string{"1", "2"} {
+				tags := map[string]string{"id": device}
+				applyAll(p,
+					steamStats(tags, "flows", int64(1), start),
+					steamStats(tags, "firmware", "1.2", start),
+				)
+				for _, field := range []string{"stop_cook_count", "error", "pd_timeouts", "stag_recoveries"} {
+					applyAll(p, steamStats(tags, field, int64(0), start))
+				}
+			}
+
+			// Waiting groups are logged by their key only
+			var traced []string
+			for _, device := range []string{"1", "2"} {
+				for _, message := range log.messages {
+					if strings.Contains(message, fmt.Sprintf("device %q", device)) {
+						traced = append(traced, device)
+						break
+					}
+				}
+			}
+			var assigned, skipped, waiting, complete, flushed int
+			for _, message := range log.messages {
+				switch {
+				case strings.Contains(message, "assigned to group"):
+					assigned++
+				case strings.Contains(message, "matched no fields"):
+					skipped++
+				case strings.Contains(message, "waiting"):
+					waiting++
+				case strings.Contains(message, "complete, flushing"):
+					complete++
+				case strings.HasPrefix(message, "Flushing group"):
+					flushed++
+				}
+			}
+			n := len(traced)
+			if assigned != 5*n || skipped != n || waiting != 4*n || complete != n || flushed != n {
+				t.Errorf("traced %d assigned, %d skipped, %d waiting, %d complete and %d flushed, want %d, %d, %d, %d and %d",
+					assigned, skipped, waiting, complete, flushed, 5*n, n, 4*n, n, n)
+			}
+			if got := strings.Join(traced, ","); got != tt.traced {
+				t.Errorf("traced the metrics of devices %q, want %q", got, tt.traced)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+// trimmedField is the field listing the fields removed by trimming.
+const trimmedField = "trimmed_fields"
+
+// baseSize approximates the line protocol bytes of a metric without its
+// fields.
+func baseSize(m telegraf.Metric) int {
+	size := len(m.Name()) + lineOverhead
+	for _, tag := range m.TagList() {
+		size += len(tag.Key) + len(tag.Value) + 2
+	}
+	return size
+}
+
+// fieldSize approximates the line protocol bytes of a field.
+func fieldSize(field *telegraf.Field) int {
+	return len(field.Key) + len(fmt.Sprint(field.Value)) + 3
+}
+
+// FieldGroup assigns a priority to the fields matching its patterns, across
+// all measurements.
+type FieldGroup struct {
+	Name     string   `toml:"name"`
+	Priority int      `toml:"priority"`
+	Fields   []string `toml:"fields"`
+
+	filter filter.Filter
+}
+
+// groupPriority returns the highest priority of the field groups a field
+// belongs to, 0 if it belongs to none.
+func (t *CycleStats) groupPriority(field string) int {
+	priority := 0
+	grouped := false
+	for _, g := range t.FieldGroups {
+		if g.filter.Match(field) && (!grouped || g.Priority > priority) {
+			priority = g.Priority
+			grouped = true
+		}
+	}
+	return priority
+}
+
+// metricsPriority returns the highest group priority of the fields of the
+// metrics, the priority of retaining them as a whole when not all metrics
+// can be kept. Metrics without fields have priority 0.
+func (t *CycleStats) metricsPriority(ms []telegraf.Metric) int {
+	priority := 0
+	first := true
+	for _, m := range ms {
+		for _, field := range m.FieldList() {
+			if p := t.groupPriority(field.Key); first || p > priority {
+				priority = p
+				first = false
+			}
+		}
+	}
+	return priority
+}
+
+// fieldPriority ranks the fields of an aggregate for trimming; fields with
+// a lower priority are removed first. The priority of the field groups a
+// field belongs to comes first. Within the same group priority, fields
+// configured by name rank above fields matching a pattern, which rank above
+// fields that merely came along with them.
+func (t *CycleStats) fieldPriority(m telegraf.Metric, field string) int {
+	group := t.groupPriority(field)
+
+	rank := 0
+	switch matched, exact := t.matchField(m, field); {
+	case exact:
+		rank = 2
+	case matched:
+		rank = 1
+	}
+	return group*3 + rank
+}
+
+// trim enforces max_fields and max_bytes on an aggregate. It returns false
+// if the aggregate is to be dropped instead.
+func (t *CycleStats) trim(aggregate telegraf.Metric) bool {
+	if t.MaxFields <= 0 && t.MaxBytes <= 0 {
+		return true
+	}
+
+	fields := aggregate.FieldList()
+	size := baseSize(aggregate)
+	for _, field := range fields {
+		size += fieldSize(field)
+	}
+	if (t.MaxFields <= 0 || len(fields) <= t.MaxFields) && (t.MaxBytes <= 0 || size <= t.MaxBytes) {
+		return true
+	}
+
+	if t.TrimPolicy == "drop" {
+		t.Log.Warnf("Dropping aggregate %q with %d fields and about %d bytes exceeding the limits", aggregate.Name(), len(fields), size)
+		t.reportProblem(problemEviction)
+		return false
+	}
+
+	// Keep the highest priority fields, in their original order within a
+	// priority, and room for the note on what was trimmed
+	ranked := make([]*telegraf.Field, len(fields))
+	copy(ranked, fields)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return t.fieldPriority(aggregate, ranked[i].Key) > t.fieldPriority(aggregate, ranked[j].Key)
+	})
+
+	// Trim the lowest ranked field until the remaining fields and the note
+	// listing the trimmed ones fit
+	kept := len(ranked)
+	for ; kept > 0; kept-- {
+		size := baseSize(aggregate) + len(trimmedField) + 5
+		for _, field := range ranked[:kept] {
+			size += fieldSize(field)
+		}
+		for _, field := range ranked[kept:] {
+			size += len(field.Key) + 1
+		}
+		if (t.MaxFields <= 0 || kept+1 <= t.MaxFields) && (t.MaxBytes <= 0 || size <= t.MaxBytes) {
+			break
+		}
+	}
+
+	trimmed := make([]string, 0, len(ranked)-kept)
+	for _, field := range ranked[kept:] {
+		trimmed = append(trimmed, field.Key)
+	}
+	for _, key := range trimmed {
+		aggregate.RemoveField(key)
+	}
+	sort.Strings(trimmed)
+	aggregate.AddField(trimmedField, strings.Join(trimmed, ","))
+	t.Log.Debugf("Trimmed %d fields from aggregate %q", len(trimmed), aggregate.Name())
+
+	return true
+}
@@ -0,0 +1,240 @@
+package cyclestats
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// priorityGroups rank temperatures above all other fields and the
+// diagnostic counters below them.
+func priorityGroups() []*FieldGroup {
+	return []*FieldGroup{
+		{Name: "compliance", Priority: 100, Fields: []string{"*_temp"}},
+		{Name: "diagnostics", Priority: -10, Fields: []string{"pd_timeouts", "stag_recoveries"}},
+	}
+}
+
+func TestTrimPriority(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxFields int
+		groups    []*FieldGroup
+		want      []string
+		trimmed   string
+	}{
+		{
+			name:      "fits",
+			maxFields: 7,
+			want:      []string{"cook_temp", "control_temp", "flows", "pd_timeouts", "stag_recoveries", "unknown", "extra"},
+		},
+		{
+			// Fields not configured go first
+			name:      "without groups",
+			maxFields: 6,
+			want:      []string{"cook_temp", "control_temp", "flows", "pd_timeouts", "stag_recoveries", trimmedField},
+			trimmed:   "extra,unknown",
+		},
+		{
+			name:      "diagnostics first",
+			maxFields: 6,
+			groups:    priorityGroups(),
+			want:      []string{"cook_temp", "control_temp", "flows", "unknown", "extra", trimmedField},
+			trimmed:   "pd_timeouts,stag_recoveries",
+		},
+		{
+			name:      "compliance last",
+			maxFields: 3,
+			groups:    priorityGroups(),
+			want:      []string{"cook_temp", "control_temp", trimmedField},
+			trimmed:   "extra,flows,pd_timeouts,stag_recoveries,unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Fields = map[string][]string{"steam": {"cook_temp", "control_temp", "flows", "pd_timeouts", "stag_recoveries"}}
+				p.MaxFields = tt.maxFields
+				p.FieldGroups = tt.groups
+			})
+
+			aggregate := metric.New("steam", nil, map[string]interface{}{
+				"cook_temp":       121.3,
+				"control_temp":    120.9,
+				"flows":           int64(10),
+				"pd_timeouts":     int64(1),
+				"stag_recoveries": int64(0),
+				"unknown":         int64(3),
+				"extra":           "x",
+			}, time.Unix(1600000000, 0))
+			if !p.trim(aggregate) {
+				t.Fatal("aggregate dropped")
+			}
+
+			got := make([]string, 0)
+			for _, field := range aggregate.FieldList() {
+				got = append(got, field.Key)
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("kept %v, want %v", got, want)
+			}
+			if trimmed, _ := aggregate.GetField(trimmedField); tt.trimmed != "" && trimmed != tt.trimmed {
+				t.Errorf("trimmed %v, want %v", trimmed, tt.trimmed)
+			}
+		})
+	}
+}
+
+func TestEvictionPriority(t *testing.T) {
+	for _, policy := range []string{fullDropOldest, fullFlushOldest} {
+		t.Run(policy, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.Fields = map[string][]string{
+					"steam_params": {"cook_temp", "control_temp"},
+					"steam_stats":  {"flows", "pd_timeouts"},
+					"grinder":      {"reversals", "jack_status"},
+				}
+				p.FieldGroups = priorityGroups()
+				p.MaxGroups = 2
+				p.FullPolicy = policy
+			})
+
+			start := time.Unix(1600000000, 0)
+			// The compliance group is the oldest
+			out := applyAll(p,
+				metric.New("steam_params", map[string]string{"id": "1"}, map[string]interface{}{"cook_temp": 121.3}, start),
+				metric.New("steam_stats", map[string]string{"id": "1"}, map[string]interface{}{"pd_timeouts": int64(1)}, start.Add(time.Second)),
+				metric.New("grinder", map[string]string{"id": "1"}, map[string]interface{}{"reversals": int64(2)}, start.Add(2*time.Second)),
+			)
+			out = append(out, p.flushIncomplete()...)
+
+			flushed := make(map[string]bool)
+			for _, m := range out {
+				flushed[m.Name()] = true
+			}
+			if !flushed["steam_params"] {
+				t.Errorf("compliance group evicted: %v", out)
+			}
+			if flushed["steam_stats"] != (policy == fullFlushOldest) {
+				t.Errorf("diagnostics group not evicted by %s: %v", policy, out)
+			}
+		})
+	}
+}
+
+func TestLimitBatchPriority(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.FieldGroups = priorityGroups()
+		p.MaxPushBatch = 2
+	})
+
+	aggregate := func(name, field string) telegraf.Metric {
+		return metric.New(name, nil, map[string]interface{}{field: 1.0}, time.Unix(1600000000, 0))
+	}
+	batch := p.limitBatch([]telegraf.Metric{
+		aggregate("diagnostics", "pd_timeouts"),
+		aggregate("other", "flows"),
+		aggregate("compliance", "cook_temp"),
+	})
+
+	names := func(ms []telegraf.Metric) []string {
+		out := make([]string, 0, len(ms))
+		for _, m := range ms {
+			out = append(out, m.Name())
+		}
+		return out
+	}
+	if got := names(batch); !reflect.DeepEqual(got, []string{"compliance", "other"}) {
+		t.Errorf("emitted %v first, want compliance and other", got)
+	}
+	if got := names(p.limitBatch(nil)); !reflect.DeepEqual(got, []string{"diagnostics"}) {
+		t.Errorf("carried %v over, want diagnostics", got)
+	}
+}
+
+func TestTrimLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *CycleStats)
+		kept      bool
+		trimmed   bool
+	}{
+		{
+			name:      "no limits",
+			configure: func(*CycleStats) {},
+			kept:      true,
+		},
+		{
+			name:      "within max_bytes",
+			configure: func(p *CycleStats) { p.MaxBytes = 400 },
+			kept:      true,
+		},
+		{
+			name:      "over max_bytes",
+			configure: func(p *CycleStats) { p.MaxBytes = 150 },
+			kept:      true,
+			trimmed:   true,
+		},
+		{
+			name: "dropped over max_fields",
+			configure: func(p *CycleStats) {
+				p.MaxFields = 3
+				p.TrimPolicy = "drop"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, tt.configure)
+
+			fields := map[string]interface{}{
+				"cook_temp":       121.3,
+				"control_temp":    120.9,
+				"flows":           int64(10),
+				"pd_timeouts":     int64(1),
+				"stag_recoveries": int64(0),
+				"firmware_log":    strings.Repeat("x", 200),
+			}
+			aggregate := metric.New("steam", map[string]string{"id": "1"}, fields, time.Unix(1600000000, 0))
+			if kept := p.trim(aggregate); kept != tt.kept {
+				t.Fatalf("kept %v, want %v", kept, tt.kept)
+			}
+			if !tt.kept {
+				return
+			}
+
+			trimmed, ok := aggregate.GetField(trimmedField)
+			if ok != tt.trimmed {
+				t.Fatalf("trimmed %v, want trimming %v", trimmed, tt.trimmed)
+			}
+			size := baseSize(aggregate)
+			for _, field := range aggregate.FieldList() {
+				size += fieldSize(field)
+			}
+			if p.MaxBytes > 0 && size > p.MaxBytes {
+				t.Errorf("trimmed to %d bytes, over max_bytes %d", size, p.MaxBytes)
+			}
+
+			// Every field is either kept or listed as trimmed
+			listed := make(map[string]bool)
+			if ok {
+				for _, key := range strings.Split(trimmed.(string), ",") {
+					listed[key] = true
+				}
+			}
+			for key := range fields {
+				if aggregate.HasField(key) == listed[key] {
+					t.Errorf("field %s kept %v and listed as trimmed %v", key, aggregate.HasField(key), listed[key])
+				}
+			}
+		})
+	}
+}
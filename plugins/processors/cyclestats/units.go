@@ -0,0 +1,186 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+)
+
+// unit describes how a unit converts to the base unit of its quantity,
+// degC for temperatures and kPa for pressures.
+type unit struct {
+	quantity string
+	toBase   func(float64) float64
+	fromBase func(float64) float64
+}
+
+var units = map[string]unit{
+	"degC": {"temperature", func(v float64) float64 { return v }, func(v float64) float64 { return v }},
+	"degF": {"temperature", func(v float64) float64 { return (v - 32) * 5 / 9 }, func(v float64) float64 { return v*9/5 + 32 }},
+	"K":    {"temperature", func(v float64) float64 { return v - 273.15 }, func(v float64) float64 { return v + 273.15 }},
+	"kPa":  {"pressure", func(v float64) float64 { return v }, func(v float64) float64 { return v }},
+	"Pa":   {"pressure", func(v float64) float64 { return v / 1000 }, func(v float64) float64 { return v * 1000 }},
+	"mbar": {"pressure", func(v float64) float64 { return v / 10 }, func(v float64) float64 { return v * 10 }},
+	"bar":  {"pressure", func(v float64) float64 { return v * 100 }, func(v float64) float64 { return v / 100 }},
+	"psi":  {"pressure", func(v float64) float64 { return v * 6.894757 }, func(v float64) float64 { return v / 6.894757 }},
+}
+
+// unitProfiles maps each profile to the unit emitted per quantity.
+var unitProfiles = map[string]map[string]string{
+	"metric":   {"temperature": "degC", "pressure": "kPa"},
+	"imperial": {"temperature": "degF", "pressure": "psi"},
+}
+
+func validateUnits(fieldUnits map[string]string, profile string) error {
+	if _, ok := unitProfiles[profile]; profile != "" && !ok {
+		return fmt.Errorf("invalid units_profile %q", profile)
+	}
+	for field, u := range fieldUnits {
+		if _, ok := units[u]; !ok {
+			return fmt.Errorf("unknown unit %q for field %q", u, field)
+		}
+	}
+	return nil
+}
+
+// fieldUnit returns the unit a field is reported in, as declared in the
+// schema or the units table.
+func (t *CycleStats) fieldUnit(measurement, field string) (string, bool) {
+	if spec, ok := t.schema[measurement][field]; ok && spec.Unit != "" {
+		return spec.Unit, true
+	}
+	u, ok := t.Units[field]
+	return u, ok
+}
+
+// applyUnitsProfile converts the fields of an aggregate with a known unit to
+// the units of the configured profile and records the emitted unit of each
+// quantity in a "<quantity>_unit" tag.
+func (t *CycleStats) applyUnitsProfile(aggregate telegraf.Metric) {
+	profile, ok := unitProfiles[t.UnitsProfile]
+	if !ok {
+		return
+	}
+
+	for _, field := range aggregate.FieldList() {
+		name, ok := t.fieldUnit(aggregate.Name(), field.Key)
+		if !ok {
+			continue
+		}
+		from, ok := units[name]
+		if !ok {
+			continue
+		}
+		target := profile[from.quantity]
+		v, ok := toFloat(field.Value)
+		if !ok {
+			continue
+		}
+
+		if target != name {
+			aggregate.AddField(field.Key, units[target].fromBase(from.toBase(v)))
+		}
+		aggregate.AddTag(from.quantity+"_unit", target)
+	}
+}
+
+// conversion converts the values of a field between two units of the same
+// quantity.
+type conversion struct {
+	from, to unit
+}
+
+// parseConversions parses the unit_conversions given as "<from>_to_<to>",
+// e.g. "degF_to_degC".
+func parseConversions(conversions map[string]string) (map[string]conversion, error) {
+	parsed := make(map[string]conversion, len(conversions))
+	for field, spec := range conversions {
+		parts := strings.SplitN(spec, "_to_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid unit conversion %q for field %q, expected \"<from>_to_<to>\"", spec, field)
+		}
+		from, ok := units[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q in conversion for field %q", parts[0], field)
+		}
+		to, ok := units[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit %q in conversion for field %q", parts[1], field)
+		}
+		if from.quantity != to.quantity {
+			return nil, fmt.Errorf("cannot convert %s to %s for field %q", from.quantity, to.quantity, field)
+		}
+		parsed[field] = conversion{from: from, to: to}
+	}
+	return parsed, nil
+}
+
+// UnitConversion converts the fields of the metrics of a measurement, or of
+// all measurements if empty. With tagpass only the metrics with a tag
+// matching it are converted, such as those of the controllers reporting in
+// other units.
+type UnitConversion struct {
+	Measurement string              `toml:"measurement"`
+	Tagpass     map[string][]string `toml:"tagpass"`
+	Fields      map[string]string   `toml:"fields"`
+
+	conversions map[string]conversion
+	tagpass     map[string]filter.Filter
+}
+
+func (c *UnitConversion) init() error {
+	var err error
+	if c.conversions, err = parseConversions(c.Fields); err != nil {
+		return err
+	}
+	c.tagpass, err = compileTagpass("unit_conversion tagpass", c.Tagpass)
+	return err
+}
+
+func (c *UnitConversion) appliesTo(m telegraf.Metric) bool {
+	if c.Measurement != "" && c.Measurement != m.Name() {
+		return false
+	}
+	return len(c.tagpass) == 0 || passes(c.tagpass, m)
+}
+
+// compileConversions returns the unit_conversion rules, preceded by a rule
+// for the unit_conversions of all metrics.
+func (t *CycleStats) compileConversions() ([]*UnitConversion, error) {
+	rules := make([]*UnitConversion, 0, len(t.UnitConversionRules)+1)
+	if len(t.UnitConversions) > 0 {
+		rules = append(rules, &UnitConversion{Fields: t.UnitConversions})
+	}
+	rules = append(rules, t.UnitConversionRules...)
+
+	for _, rule := range rules {
+		if err := rule.init(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// applyConversions converts the fields of a metric according to the first
+// conversion rule applying to the metric and converting the field, before
+// it is aggregated, so statistics and thresholds see the values in the same
+// units across controllers.
+func (t *CycleStats) applyConversions(m telegraf.Metric) {
+	if len(t.conversions) == 0 {
+		return
+	}
+	for _, field := range m.FieldList() {
+		for _, rule := range t.conversions {
+			c, ok := rule.conversions[field.Key]
+			if !ok || !rule.appliesTo(m) {
+				continue
+			}
+			if v, ok := toFloat(field.Value); ok {
+				field.Value = c.to.fromBase(c.from.toBase(v))
+			}
+			break
+		}
+	}
+}
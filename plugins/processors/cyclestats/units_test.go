@@ -0,0 +1,186 @@
+package cyclestats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/metric"
+)
+
+func TestUnitsProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		fields  map[string]interface{}
+		want    map[string]interface{}
+		tags    map[string]string
+	}{
+		{
+			name:   "no profile",
+			fields: map[string]interface{}{"cook_temp": 250.0},
+			want:   map[string]interface{}{"cook_temp": 250.0},
+			tags:   map[string]string{"id": "1"},
+		},
+		{
+			name:    "metric",
+			profile: "metric",
+			fields:  map[string]interface{}{"cook_temp": 250.0, "pressure": 14.5, "flows": int64(3)},
+			want:    map[string]interface{}{"cook_temp": 121.11111111111111, "pressure": 99.973977, "flows": int64(3)},
+			tags:    map[string]string{"id": "1", "temperature_unit": "degC", "pressure_unit": "kPa"},
+		},
+		{
+			name:    "imperial",
+			profile: "imperial",
+			fields:  map[string]interface{}{"cook_temp": 250.0, "pressure": 14.5},
+			want:    map[string]interface{}{"cook_temp": 250.0, "pressure": 14.5},
+			tags:    map[string]string{"id": "1", "temperature_unit": "degF", "pressure_unit": "psi"},
+		},
+		{
+			name:    "non-numeric",
+			profile: "metric",
+			fields:  map[string]interface{}{"cook_temp": "n/a"},
+			want:    map[string]interface{}{"cook_temp": "n/a"},
+			tags:    map[string]string{"id": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.UnitsProfile = tt.profile
+				p.Units = map[string]string{"cook_temp": "degF", "pressure": "psi"}
+			})
+
+			aggregate := metric.New("steam", map[string]string{"id": "1"}, tt.fields, time.Unix(1600000000, 0))
+			p.applyUnitsProfile(aggregate)
+			for field, want := range tt.want {
+				got, _ := aggregate.GetField(field)
+				if f, ok := want.(float64); ok {
+					if g, ok := got.(float64); !ok || math.Abs(g-f) > 1e-6 {
+						t.Errorf("%s = %v, want %v", field, got, want)
+					}
+					continue
+				}
+				if got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+			if !reflect.DeepEqual(aggregate.Tags(), tt.tags) {
+				t.Errorf("tags %v, want %v", aggregate.Tags(), tt.tags)
+			}
+		})
+	}
+}
+
+func TestValidateUnits(t *testing.T) {
+	tests := []struct {
+		units   map[string]string
+		profile string
+		ok      bool
+	}{
+		{units: map[string]string{"cook_temp": "K"}, profile: "metric", ok: true},
+		{units: nil, profile: "", ok: true},
+		{units: nil, profile: "nautical", ok: false},
+		{units: map[string]string{"cook_temp": "degR"}, ok: false},
+	}
+	for _, tt := range tests {
+		err := validateUnits(tt.units, tt.profile)
+		if (err == nil) != tt.ok {
+			t.Errorf("units %v in profile %q: got error %v, want ok %v", tt.units, tt.profile, err, tt.ok)
+		}
+	}
+}
+
+func TestApplyConversions(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      map[string]interface{}
+		want        map[string]interface{}
+	}{
+		{
+			name:        "all metrics",
+			measurement: "steam_params",
+			tags:        map[string]string{"id": "1"},
+			fields:      map[string]interface{}{"wait_pressure": 1.5, "flows": int64(3)},
+			want:        map[string]interface{}{"wait_pressure": 150.0, "flows": int64(3)},
+		},
+		{
+			name:        "rule of the measurement and tag",
+			measurement: "steam_params",
+			tags:        map[string]string{"id": "1", "controller": "us-v2"},
+			fields:      map[string]interface{}{"cook_temp": 250.0},
+			want:        map[string]interface{}{"cook_temp": 121.11111111111111},
+		},
+		{
+			name:        "other tag",
+			measurement: "steam_params",
+			tags:        map[string]string{"id": "1", "controller": "eu-v3"},
+			fields:      map[string]interface{}{"cook_temp": 121.0},
+			want:        map[string]interface{}{"cook_temp": 121.0},
+		},
+		{
+			name:        "other measurement",
+			measurement: "steam_stats",
+			tags:        map[string]string{"id": "1", "controller": "us-v2"},
+			fields:      map[string]interface{}{"cook_temp": 121.0},
+			want:        map[string]interface{}{"cook_temp": 121.0},
+		},
+		{
+			name:        "integer",
+			measurement: "steam_params",
+			tags:        map[string]string{"id": "1", "controller": "us-v2"},
+			fields:      map[string]interface{}{"cook_temp": int64(212)},
+			want:        map[string]interface{}{"cook_temp": 100.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(t, func(p *CycleStats) {
+				p.UnitConversions = map[string]string{"wait_pressure": "bar_to_kPa"}
+				p.UnitConversionRules = []*UnitConversion{{
+					Measurement: "steam_params",
+					Tagpass:     map[string][]string{"controller": {"us-*"}},
+					Fields:      map[string]string{"cook_temp": "degF_to_degC"},
+				}}
+			})
+
+			m := metric.New(tt.measurement, tt.tags, tt.fields, time.Unix(1600000000, 0))
+			p.applyConversions(m)
+			for field, want := range tt.want {
+				got, _ := m.GetField(field)
+				if f, ok := want.(float64); ok {
+					if g, ok := got.(float64); !ok || math.Abs(g-f) > 1e-9 {
+						t.Errorf("%s = %v, want %v", field, got, want)
+					}
+					continue
+				}
+				if got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConversions(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{spec: "degF_to_degC", ok: true},
+		{spec: "mbar_to_psi", ok: true},
+		{spec: "degF", ok: false},
+		{spec: "degR_to_degC", ok: false},
+		{spec: "degF_to_degR", ok: false},
+		{spec: "degF_to_kPa", ok: false},
+	}
+	for _, tt := range tests {
+		_, err := parseConversions(map[string]string{"cook_temp": tt.spec})
+		if (err == nil) != tt.ok {
+			t.Errorf("conversion %q: got error %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package cyclestats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// knownField reports whether a field is configured for any measurement, in
+// the fields table or a field set, or decoded from a bitmask.
+func (t *CycleStats) knownField(field string) bool {
+	all := []*compiledFields{t.fields}
+	for _, s := range t.FieldSets {
+		all = append(all, s.fields)
+	}
+	for _, c := range all {
+		for measurement := range c.fields {
+			if matched, _ := c.match(measurement, field); matched {
+				return true
+			}
+		}
+	}
+	for _, bits := range t.Bitmasks {
+		for _, name := range bits {
+			if name == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// warnUnknownThresholds warns about thresholds on fields no measurement is
+// configured with. Thresholds are checked on all metrics, so they still work
+// on such fields, but usually the field name is misspelled.
+func (t *CycleStats) warnUnknownThresholds() {
+	for _, th := range t.thresholds {
+		if !t.knownField(th.field) {
+			t.Log.Warnf("Threshold %q refers to the field %q not configured for any measurement", th.condition, th.field)
+		}
+	}
+}
+
+// Summary describes the effective configuration after Init, with the
+// defaults applied, for checking a configuration before deploying it.
+func (t *CycleStats) Summary() string {
+	var b strings.Builder
+
+	measurements := make([]string, 0, len(t.Fields))
+	for measurement := range t.Fields {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+	fmt.Fprintf(&b, "measurements: %d\n", len(measurements))
+	for _, measurement := range measurements {
+		fields := t.Fields[measurement]
+		fmt.Fprintf(&b, "  %s: %d fields: %s\n", measurement, len(fields), strings.Join(fields, ", "))
+		if required, ok := t.RequiredFields[measurement]; ok {
+			fmt.Fprintf(&b, "    required: %s\n", strings.Join(required, ", "))
+		}
+	}
+	if len(t.FieldSets) > 0 {
+		fmt.Fprintf(&b, "field sets: %d\n", len(t.FieldSets))
+	}
+
+	fmt.Fprintf(&b, "device tag: %s\n", t.DeviceTag)
+	if t.groupTag != "" {
+		fmt.Fprintf(&b, "group key: tag %s\n", t.groupTag)
+	}
+	if t.sentinel != "" {
+		fmt.Fprintf(&b, "group key: sessions of sentinel field %s\n", t.sentinel)
+	}
+	fmt.Fprintf(&b, "group window: %s, aligned to %s\n", time.Duration(t.Window), t.alignment)
+	writeTable(&b, "group windows", len(t.Windows), func(add func(string)) {
+		for measurement, w := range t.windows {
+			add(fmt.Sprintf("%s: %s", measurement, w))
+		}
+	})
+	if len(t.GroupBy) > 0 {
+		fmt.Fprintf(&b, "group by: %s\n", strings.Join(t.GroupBy, ", "))
+	}
+	fmt.Fprintf(&b, "cycle close: %s", t.CycleClose)
+	if t.CycleClose == "tag" {
+		fmt.Fprintf(&b, " on %s=true", t.CloseTag)
+	}
+	if t.CloseAfter > 0 {
+		fmt.Fprintf(&b, ", or after %s without updates", time.Duration(t.CloseAfter))
+	}
+	b.WriteString("\n")
+	if t.MinSamples > 0 {
+		fmt.Fprintf(&b, "min samples: %d\n", t.MinSamples)
+	}
+	if t.Expiry > 0 {
+		fmt.Fprintf(&b, "expiry: %s\n", time.Duration(t.Expiry))
+	}
+	if t.MaxGroups > 0 {
+		fmt.Fprintf(&b, "max groups: %d, %s when full\n", t.MaxGroups, t.FullPolicy)
+	}
+	if t.MaxSamplesPerGroup > 0 {
+		fmt.Fprintf(&b, "max samples per group: %d, %s when full\n", t.MaxSamplesPerGroup, t.SamplesPolicy)
+	}
+
+	fmt.Fprintf(&b, "output: %s", t.Output)
+	if len(t.JoinMeasurements) > 0 {
+		fmt.Fprintf(&b, ", joining %s", strings.Join(t.JoinMeasurements, ", "))
+	}
+	if t.Output == "merged" || len(t.JoinMeasurements) > 0 {
+		fmt.Fprintf(&b, " into %s", t.JoinName)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "aggregate timestamp: %s\n", t.AggregateTimestamp)
+
+	writeTable(&b, "statistics", len(t.Stats), func(add func(string)) {
+		for field, names := range t.Stats {
+			add(fmt.Sprintf("%s: %s", field, strings.Join(names, ", ")))
+		}
+	})
+	writeTable(&b, "computed fields", len(t.Compute), func(add func(string)) {
+		for field, expr := range t.Compute {
+			add(fmt.Sprintf("%s = %s", field, expr))
+		}
+	})
+	writeTable(&b, "renames", len(t.RenameFields), func(add func(string)) {
+		for measurement, renames := range t.RenameFields {
+			for from, to := range renames {
+				add(fmt.Sprintf("%s: %s -> %s", measurement, from, to))
+			}
+		}
+	})
+	writeTable(&b, "thresholds", len(t.Thresholds), func(add func(string)) {
+		for _, condition := range t.Thresholds {
+			add(condition)
+		}
+	})
+
+	for _, file := range []struct{ name, path string }{
+		{"schema file", t.SchemaFile},
+		{"state file", t.StateFile},
+		{"journal file", t.JournalFile},
+		{"history file", t.HistoryFile},
+		{"error dictionary", t.ErrorDictionary},
+		{"golden profile", t.GoldenProfile},
+	} {
+		if file.path != "" {
+			fmt.Fprintf(&b, "%s: %s\n", file.name, file.path)
+		}
+	}
+	if t.CaptureBaseline {
+		fmt.Fprintf(&b, "capturing golden profile over %d cycles\n", t.CaptureCycles)
+	}
+	return b.String()
+}
+
+// writeTable writes a titled, sorted list of the entries added by fill if
+// there are any.
+func writeTable(b *strings.Builder, title string, n int, fill func(add func(string))) {
+	if n == 0 {
+		return
+	}
+	entries := make([]string, 0, n)
+	fill(func(entry string) { entries = append(entries, entry) })
+	sort.Strings(entries)
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, entry := range entries {
+		fmt.Fprintf(b, "  %s\n", entry)
+	}
+}
@@ -0,0 +1,83 @@
+package cyclestats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestInitInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(p *CycleStats)
+	}{
+		{name: "negative idle_timeout", configure: func(p *CycleStats) { p.IdleTimeout = config.Duration(-time.Second) }},
+		{name: "negative expiry", configure: func(p *CycleStats) { p.Expiry = config.Duration(-time.Second) }},
+		{name: "negative close_after", configure: func(p *CycleStats) { p.CloseAfter = config.Duration(-time.Second) }},
+		{name: "negative min_samples", configure: func(p *CycleStats) { p.MinSamples = -1 }},
+		{name: "negative health_interval", configure: func(p *CycleStats) { p.HealthInterval = config.Duration(-time.Second) }},
+		{name: "negative history_retention", configure: func(p *CycleStats) { p.HistoryRetention = config.Duration(-time.Second) }},
+		{name: "rename onto a configured field", configure: func(p *CycleStats) {
+			p.RenameFields = map[string]map[string]string{"steam_stats": {"flows": "pd_timeouts"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			p.Log = &warnings{}
+			tt.configure(p)
+			if err := p.Init(); err == nil {
+				t.Errorf("invalid configuration accepted")
+			}
+		})
+	}
+}
+
+func TestWarnUnknownThresholds(t *testing.T) {
+	tests := []struct {
+		threshold string
+		warned    bool
+	}{
+		{threshold: "hot_drain_temp > 95", warned: false},
+		{threshold: "hot_drian_temp > 95", warned: true},
+	}
+	for _, tt := range tests {
+		log := &warnings{}
+		p := New()
+		p.Log = log
+		p.Thresholds = []string{tt.threshold}
+		if err := p.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if warned := log.count() > 0; warned != tt.warned {
+			t.Errorf("threshold %q: warned %v, want %v: %v", tt.threshold, warned, tt.warned, log.messages)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	p := newTestProcessor(t, func(p *CycleStats) {
+		p.CycleClose = "tag"
+		p.CloseAfter = config.Duration(time.Minute)
+		p.Thresholds = []string{"hot_drain_temp > 95", "wait_pressure < 0"}
+		p.Windows = map[string]string{"grinder": "1m"}
+	})
+
+	summary := p.Summary()
+	for _, want := range []string{
+		"device tag: id\n",
+		"cycle close: tag on completed=true, or after 1m0s without updates\n",
+		"group windows:\n  grinder: 1m0s\n",
+		"thresholds:\n  hot_drain_temp > 95\n  wait_pressure < 0\n",
+		"aggregate timestamp: start\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary without %q:\n%s", want, summary)
+		}
+	}
+	if strings.Contains(summary, "renames") {
+		t.Errorf("summary lists empty renames:\n%s", summary)
+	}
+}
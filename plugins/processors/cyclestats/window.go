@@ -0,0 +1,113 @@
+package cyclestats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds of the group windows, from bursts of high-rate telemetry to
+// summaries published every few minutes.
+const (
+	minWindow = 10 * time.Millisecond
+	maxWindow = 24 * time.Hour
+)
+
+// window returns the length of the group windows of a measurement.
+func (t *CycleStats) window(measurement string) time.Duration {
+	if w, ok := t.windows[measurement]; ok {
+		return w
+	}
+	return time.Duration(t.Window)
+}
+
+// alignment positions the group windows. Windows start offset after the
+// window boundaries or, with a period, offset into every minute or hour.
+type alignment struct {
+	offset time.Duration
+	period time.Duration
+}
+
+// parseAlignTo parses an align_to of either a duration offsetting the
+// windows, or a ":ss" or "mm:ss" position within every minute or hour.
+func parseAlignTo(s string) (alignment, error) {
+	if s == "" {
+		return alignment{}, nil
+	}
+	if !strings.Contains(s, ":") {
+		offset, err := time.ParseDuration(s)
+		if err != nil {
+			return alignment{}, fmt.Errorf("invalid align_to %q: %v", s, err)
+		}
+		return alignment{offset: offset}, nil
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+	a := alignment{period: time.Hour}
+	if parts[0] == "" {
+		a.period = time.Minute
+		parts[0] = "0"
+	}
+	m, merr := strconv.Atoi(parts[0])
+	sec, serr := strconv.Atoi(parts[1])
+	if merr != nil || serr != nil || m < 0 || m > 59 || sec < 0 || sec > 59 {
+		return alignment{}, fmt.Errorf("invalid align_to %q, expected a duration, \":ss\" or \"mm:ss\"", s)
+	}
+	a.offset = time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	return a, nil
+}
+
+// String returns the alignment as reported by the config summary.
+func (a alignment) String() string {
+	switch a.period {
+	case time.Minute:
+		return fmt.Sprintf("second %d of every minute", int(a.offset.Seconds()))
+	case time.Hour:
+		return fmt.Sprintf("%02d:%02d of every hour", int(a.offset.Minutes()), int(a.offset.Seconds())%60)
+	}
+	return "+" + a.offset.String()
+}
+
+// validateWindows parses the windows per measurement and align_to, and
+// checks that the windows are within the bounds and longer than an align_to
+// offset, or at most the minute or hour of an align_to position.
+func (t *CycleStats) validateWindows() error {
+	a, err := parseAlignTo(t.AlignTo)
+	if err != nil {
+		return err
+	}
+	t.alignment = a
+
+	check := func(name string, w time.Duration) error {
+		if w < minWindow || w > maxWindow {
+			return fmt.Errorf("%s must be between %v and %v, got %v", name, minWindow, maxWindow, w)
+		}
+		if a.period > 0 {
+			if w > a.period {
+				return fmt.Errorf("%s %v must not exceed the %v of align_to %q", name, w, a.period, t.AlignTo)
+			}
+			return nil
+		}
+		if a.offset < 0 || a.offset >= w {
+			return fmt.Errorf("align_to must be at least 0 and less than %s %v, got %v", name, w, a.offset)
+		}
+		return nil
+	}
+
+	if err := check("window", time.Duration(t.Window)); err != nil {
+		return err
+	}
+	t.windows = make(map[string]time.Duration, len(t.Windows))
+	for measurement, value := range t.Windows {
+		w, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid window of %q: %v", measurement, err)
+		}
+		if err := check(fmt.Sprintf("window of %q", measurement), w); err != nil {
+			return err
+		}
+		t.windows[measurement] = w
+	}
+	return nil
+}
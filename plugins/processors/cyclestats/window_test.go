@@ -0,0 +1,103 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+)
+
+func TestValidateWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  time.Duration
+		windows map[string]string
+		alignTo string
+		ok      bool
+	}{
+		{name: "default", window: 2 * time.Second, ok: true},
+		{name: "too short", window: time.Millisecond, ok: false},
+		{name: "too long", window: 48 * time.Hour, ok: false},
+		{name: "per measurement", window: 2 * time.Second, windows: map[string]string{"grinder": "1m"}, ok: true},
+		{name: "invalid per measurement", window: 2 * time.Second, windows: map[string]string{"grinder": "1 minute"}, ok: false},
+		{name: "per measurement too short", window: 2 * time.Second, windows: map[string]string{"grinder": "1ms"}, ok: false},
+		{name: "offset", window: 2 * time.Second, alignTo: "500ms", ok: true},
+		{name: "offset beyond window", window: 2 * time.Second, alignTo: "2s", ok: false},
+		{name: "offset beyond window of measurement", window: 2 * time.Second, windows: map[string]string{"grinder": "1s"}, alignTo: "1500ms", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &CycleStats{Window: config.Duration(tt.window), Windows: tt.windows, AlignTo: tt.alignTo}
+			err := p.validateWindows()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if got := p.window("steam_stats"); got != tt.window {
+				t.Errorf("window of steam_stats %v, want %v", got, tt.window)
+			}
+			for measurement, value := range tt.windows {
+				want, _ := time.ParseDuration(value)
+				if got := p.window(measurement); got != want {
+					t.Errorf("window of %s %v, want %v", measurement, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAlignTo(t *testing.T) {
+	tests := []struct {
+		alignTo string
+		want    alignment
+		str     string
+		ok      bool
+	}{
+		{alignTo: "", want: alignment{}, str: "+0s", ok: true},
+		{alignTo: "500ms", want: alignment{offset: 500 * time.Millisecond}, str: "+500ms", ok: true},
+		{alignTo: ":30", want: alignment{offset: 30 * time.Second, period: time.Minute}, str: "second 30 of every minute", ok: true},
+		{alignTo: "15:05", want: alignment{offset: 15*time.Minute + 5*time.Second, period: time.Hour}, str: "15:05 of every hour", ok: true},
+		{alignTo: "half past", ok: false},
+		{alignTo: ":60", ok: false},
+		{alignTo: "60:00", ok: false},
+		{alignTo: "-1:00", ok: false},
+		{alignTo: "1:2:3", ok: false},
+	}
+	for _, tt := range tests {
+		got, err := parseAlignTo(tt.alignTo)
+		if (err == nil) != tt.ok {
+			t.Errorf("align_to %q: got error %v, want ok %v", tt.alignTo, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("align_to %q: got %+v, want %+v", tt.alignTo, got, tt.want)
+		}
+		if got.String() != tt.str {
+			t.Errorf("align_to %q: reported as %q, want %q", tt.alignTo, got.String(), tt.str)
+		}
+	}
+}
+
+func TestValidateWindowsAlignPosition(t *testing.T) {
+	tests := []struct {
+		window  time.Duration
+		alignTo string
+		ok      bool
+	}{
+		{window: time.Minute, alignTo: ":30", ok: true},
+		{window: 2 * time.Minute, alignTo: ":30", ok: false},
+		{window: time.Hour, alignTo: "05:00", ok: true},
+		{window: 2 * time.Hour, alignTo: "05:00", ok: false},
+	}
+	for _, tt := range tests {
+		p := &CycleStats{Window: config.Duration(tt.window), AlignTo: tt.alignTo}
+		if err := p.validateWindows(); (err == nil) != tt.ok {
+			t.Errorf("window %v aligned to %q: got error %v, want ok %v", tt.window, tt.alignTo, err, tt.ok)
+		}
+	}
+}
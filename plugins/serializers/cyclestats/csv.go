@@ -0,0 +1,209 @@
+package cyclestats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// CSVSerializer renders cycle aggregates as CSV rows, one per cycle, for
+// spreadsheet and ERP imports. The columns are the timestamp, the
+// configured tags and a "<measurement>_<field>" column per field of the
+// schema, with the measurements in name order and the fields in schema
+// order, so the columns never change between cycles. Fields outside the
+// schema are left out and fields a cycle lacks are empty. The fields of a
+// joined cycle metric, already named "<measurement>_<field>", fill the
+// columns of the same name.
+type CSVSerializer struct {
+	Schema         map[string][]string
+	Tags           []string
+	Identity       []string
+	Header         bool
+	TimestampUnits time.Duration
+
+	columns []csvColumn
+	// headerDone is set once the header row was written to the current
+	// file
+	headerDone bool
+	mu         sync.Mutex
+}
+
+// csvColumn is the field of a measurement a column holds.
+type csvColumn struct {
+	measurement string
+	field       string
+}
+
+func NewCSVSerializer(schema map[string][]string, tags []string, identity []string, header bool, timestampUnits time.Duration) (*CSVSerializer, error) {
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("csv serializer requires a field schema")
+	}
+	if identity == nil {
+		identity = DefaultIdentity
+	}
+	if timestampUnits <= 0 {
+		timestampUnits = time.Second
+	}
+
+	measurements := make([]string, 0, len(schema))
+	for measurement := range schema {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+
+	s := &CSVSerializer{
+		Schema:         schema,
+		Tags:           tags,
+		Identity:       identity,
+		Header:         header,
+		TimestampUnits: timestampUnits,
+	}
+	for _, measurement := range measurements {
+		for _, field := range schema[measurement] {
+			s.columns = append(s.columns, csvColumn{measurement: measurement, field: field})
+		}
+	}
+	return s, nil
+}
+
+// Rotate is the hook of outputs writing to rotated files, called whenever
+// they start writing to a file. The next output starts with the header row
+// if the file is empty, so every file has a header row exactly once.
+func (s *CSVSerializer) Rotate(empty bool) {
+	s.mu.Lock()
+	s.headerDone = !empty
+	s.mu.Unlock()
+}
+
+func (s *CSVSerializer) Serialize(metric telegraf.Metric) ([]byte, error) {
+	return s.SerializeBatch([]telegraf.Metric{metric})
+}
+
+// SerializeBatch writes a row per cycle, merging the aggregates of a cycle
+// by the identity tags like SerializeBatch of Serializer.
+func (s *CSVSerializer) SerializeBatch(metrics []telegraf.Metric) ([]byte, error) {
+	cycles := make(map[string][]telegraf.Metric)
+	keys := make([]string, 0)
+	for _, metric := range metrics {
+		key := identityKey(metric, s.Identity)
+		if _, ok := cycles[key]; !ok {
+			keys = append(keys, key)
+		}
+		cycles[key] = append(cycles[key], metric)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	s.mu.Lock()
+	if s.Header && !s.headerDone {
+		if err := w.Write(s.header()); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.headerDone = true
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		if err := w.Write(s.row(cycles[key])); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *CSVSerializer) header() []string {
+	header := make([]string, 0, 1+len(s.Tags)+len(s.columns))
+	header = append(header, "timestamp")
+	header = append(header, s.Tags...)
+	for _, c := range s.columns {
+		header = append(header, c.measurement+"_"+c.field)
+	}
+	return header
+}
+
+// row returns the cells of the aggregates of a cycle, timestamped with the
+// earliest of them.
+func (s *CSVSerializer) row(metrics []telegraf.Metric) []string {
+	var timestamp time.Time
+	byName := make(map[string]telegraf.Metric, len(metrics))
+	for _, metric := range metrics {
+		if timestamp.IsZero() || metric.Time().Before(timestamp) {
+			timestamp = metric.Time()
+		}
+		byName[metric.Name()] = metric
+	}
+
+	row := make([]string, 0, 1+len(s.Tags)+len(s.columns))
+	row = append(row, strconv.FormatInt(timestamp.UnixNano()/int64(s.TimestampUnits), 10))
+	for _, tag := range s.Tags {
+		row = append(row, tagOf(metrics, tag))
+	}
+	for _, c := range s.columns {
+		var cell string
+		if value, ok := fieldOf(metrics, byName, c); ok {
+			cell = formatCell(value)
+		}
+		row = append(row, cell)
+	}
+	return row
+}
+
+// tagOf returns the value of a tag of the first aggregate of a cycle having
+// it.
+func tagOf(metrics []telegraf.Metric, key string) string {
+	for _, metric := range metrics {
+		if value, ok := metric.GetTag(key); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// fieldOf returns the value of the field of a column, from the aggregate of
+// its measurement or else from a joined cycle metric.
+func fieldOf(metrics []telegraf.Metric, byName map[string]telegraf.Metric, c csvColumn) (interface{}, bool) {
+	if metric, ok := byName[c.measurement]; ok {
+		if value, ok := metric.GetField(c.field); ok {
+			return value, true
+		}
+	}
+	for _, metric := range metrics {
+		if value, ok := metric.GetField(c.measurement + "_" + c.field); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		// Like JSON, CSV importers do not support these special values
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,115 @@
+package cyclestats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+var csvSchema = map[string][]string{
+	"steam_stats":   {"flows", "error"},
+	"steam_params":  {"steam_type", "cook_temp"},
+	"vessel_status": {"door"},
+}
+
+// joined returns the cycle of a device joined into one metric by the
+// processor.
+func joined(device, id string) telegraf.Metric {
+	return metric.New("cycle",
+		map[string]string{"id": device, "steam_cycle": id},
+		map[string]interface{}{"steam_params_cook_temp": 121.3, "steam_stats_error": int64(12), "steam_stats_flows": int64(9)},
+		cycleStart)
+}
+
+func TestCSVSerializeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		header  bool
+		metrics []telegraf.Metric
+		want    string
+	}{
+		{
+			name:    "cycle",
+			tags:    []string{"id", "steam_cycle"},
+			metrics: cycle("vessel-0042", "1234", "success"),
+			want:    "1646129700,vessel-0042,1234,2,121.3,10,0,closed\n",
+		},
+		{
+			name:   "header",
+			tags:   []string{"id", "cycle_result"},
+			header: true,
+			metrics: append(
+				cycle("vessel-0042", "1234", "success"),
+				cycle("vessel-0042", "1235", "aborted")...,
+			),
+			want: "timestamp,id,cycle_result,steam_params_steam_type,steam_params_cook_temp,steam_stats_flows,steam_stats_error,vessel_status_door\n" +
+				"1646129700,vessel-0042,success,2,121.3,10,0,closed\n" +
+				"1646129700,vessel-0042,aborted,2,121.3,10,0,closed\n",
+		},
+		{
+			name:    "missing columns",
+			tags:    []string{"id", "phase"},
+			metrics: cycle("vessel-0042", "1234", "success")[1:2],
+			want:    "1646129700,vessel-0042,,,,10,0,\n",
+		},
+		{
+			name:    "joined",
+			tags:    []string{"id"},
+			metrics: []telegraf.Metric{joined("vessel-0042", "1234"), joined("vessel-0043", "88")},
+			want: "1646129700,vessel-0042,,121.3,9,12,\n" +
+				"1646129700,vessel-0043,,121.3,9,12,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewCSVSerializer(csvSchema, tt.tags, nil, tt.header, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := s.SerializeBatch(tt.metrics)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVHeaderPerFile(t *testing.T) {
+	s, err := NewCSVSerializer(csvSchema, nil, nil, true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const header = "timestamp,steam_params_steam_type,steam_params_cook_temp,steam_stats_flows,steam_stats_error,vessel_status_door\n"
+	const row = "1646129700,,121.3,9,12,\n"
+
+	tests := []struct {
+		name string
+		// rotate calls Rotate(empty) before serializing
+		rotate bool
+		empty  bool
+		want   string
+	}{
+		{name: "first", want: header + row},
+		{name: "same file", want: row},
+		{name: "new file", rotate: true, empty: true, want: header + row},
+		{name: "continued file", rotate: true, empty: false, want: row},
+	}
+	for _, tt := range tests {
+		if tt.rotate {
+			s.Rotate(tt.empty)
+		}
+		b, err := s.Serialize(joined("vessel-0042", "1234"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, b, tt.want)
+		}
+	}
+}
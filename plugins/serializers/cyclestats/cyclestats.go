@@ -0,0 +1,167 @@
+package cyclestats
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// DefaultSections assigns the measurements of a cycle to the sections of the
+// cycle summary document.
+var DefaultSections = map[string]string{
+	"steam_params":       "steam",
+	"steam_stats":        "steam",
+	"vessel_status":      "vessel",
+	"vessel_lid_failure": "vessel",
+	"grinder":            "grinder",
+	"system_status":      "system",
+	"sys_status_mngr":    "system",
+}
+
+// DefaultIdentity are the tags identifying the cycle of an aggregate, the
+// device and the cycle id.
+var DefaultIdentity = []string{"id", "steam_cycle"}
+
+// Serializer renders cycle aggregates as structured cycle summary documents
+// with the fields grouped into sections. Measurements without a section are
+// placed in a section named after the measurement. The tags shared by all
+// aggregates of a cycle are the tags of the document, while those differing
+// between them, such as cycle_result or phase, are the tags of their
+// section.
+type Serializer struct {
+	Sections       map[string]string
+	Identity       []string
+	TimestampUnits time.Duration
+}
+
+func NewSerializer(sections map[string]string, identity []string, timestampUnits time.Duration) (*Serializer, error) {
+	if sections == nil {
+		sections = DefaultSections
+	}
+	if identity == nil {
+		identity = DefaultIdentity
+	}
+	if timestampUnits <= 0 {
+		timestampUnits = time.Second
+	}
+
+	s := &Serializer{
+		Sections:       sections,
+		Identity:       identity,
+		TimestampUnits: timestampUnits,
+	}
+	return s, nil
+}
+
+func (s *Serializer) Serialize(metric telegraf.Metric) ([]byte, error) {
+	serialized, err := json.Marshal(s.createDocument([]telegraf.Metric{metric}))
+	if err != nil {
+		return []byte{}, err
+	}
+	serialized = append(serialized, '\n')
+
+	return serialized, nil
+}
+
+// SerializeBatch merges the aggregates of the same cycle, those sharing the
+// values of the identity tags, into a single document each.
+func (s *Serializer) SerializeBatch(metrics []telegraf.Metric) ([]byte, error) {
+	cycles := make(map[string][]telegraf.Metric)
+	keys := make([]string, 0)
+	for _, metric := range metrics {
+		key := identityKey(metric, s.Identity)
+		if _, ok := cycles[key]; !ok {
+			keys = append(keys, key)
+		}
+		cycles[key] = append(cycles[key], metric)
+	}
+
+	documents := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		documents = append(documents, s.createDocument(cycles[key]))
+	}
+
+	obj := map[string]interface{}{
+		"cycles": documents,
+	}
+
+	serialized, err := json.Marshal(obj)
+	if err != nil {
+		return []byte{}, err
+	}
+	return serialized, nil
+}
+
+func (s *Serializer) createDocument(metrics []telegraf.Metric) map[string]interface{} {
+	doc := make(map[string]interface{})
+	shared := sharedTags(metrics)
+	var timestamp time.Time
+	for _, metric := range metrics {
+		if timestamp.IsZero() || metric.Time().Before(timestamp) {
+			timestamp = metric.Time()
+		}
+
+		name, ok := s.Sections[metric.Name()]
+		if !ok {
+			name = metric.Name()
+		}
+		section, ok := doc[name].(map[string]interface{})
+		if !ok {
+			section = make(map[string]interface{})
+			doc[name] = section
+		}
+
+		for _, field := range metric.FieldList() {
+			if fv, ok := field.Value.(float64); ok {
+				// JSON does not support these special values
+				if math.IsNaN(fv) || math.IsInf(fv, 0) {
+					continue
+				}
+			}
+			section[field.Key] = field.Value
+		}
+
+		for _, tag := range metric.TagList() {
+			if _, ok := shared[tag.Key]; ok {
+				continue
+			}
+			tags, ok := section["tags"].(map[string]string)
+			if !ok {
+				tags = make(map[string]string)
+				section["tags"] = tags
+			}
+			tags[tag.Key] = tag.Value
+		}
+	}
+
+	doc["tags"] = shared
+	doc["timestamp"] = timestamp.UnixNano() / int64(s.TimestampUnits)
+	return doc
+}
+
+// sharedTags returns the tags all metrics have with the same value.
+func sharedTags(metrics []telegraf.Metric) map[string]string {
+	shared := metrics[0].Tags()
+	for _, metric := range metrics[1:] {
+		for key, value := range shared {
+			if v, ok := metric.GetTag(key); !ok || v != value {
+				delete(shared, key)
+			}
+		}
+	}
+	return shared
+}
+
+// identityKey identifies the cycle of a metric by the values of the identity
+// tags, regardless of its measurement and other tags.
+func identityKey(metric telegraf.Metric, identity []string) string {
+	values := make([]string, 0, len(identity))
+	for _, key := range identity {
+		value, _ := metric.GetTag(key)
+		values = append(values, key+"="+value)
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,117 @@
+package cyclestats
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+// checkGolden compares the output of a test with testdata/<name>, or
+// replaces the file with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+var cycleStart = time.Unix(1646129700, 0)
+
+// cycle returns the aggregates of a steam cycle of a device.
+func cycle(device, id string, result string) []telegraf.Metric {
+	return []telegraf.Metric{
+		metric.New("steam_params",
+			map[string]string{"id": device, "steam_cycle": id, "phase": "hold"},
+			map[string]interface{}{"cook_temp": 121.3, "control_temp": 120.9, "steam_type": int64(2)},
+			cycleStart.Add(time.Second)),
+		metric.New("steam_stats",
+			map[string]string{"id": device, "steam_cycle": id, "cycle_result": result},
+			map[string]interface{}{"error": int64(0), "flows": int64(10), "drain_rate": math.NaN()},
+			cycleStart),
+		metric.New("vessel_status",
+			map[string]string{"id": device, "steam_cycle": id},
+			map[string]interface{}{"door": "closed", "locked": true},
+			cycleStart.Add(2*time.Second)),
+		metric.New("pump",
+			map[string]string{"id": device, "steam_cycle": id},
+			map[string]interface{}{"pressure": 2.1},
+			cycleStart.Add(3*time.Second)),
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	s, err := NewSerializer(nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Serialize(cycle("vessel-0042", "1234", "success")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "serialize.json", b)
+}
+
+func TestSerializeBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity []string
+		units    time.Duration
+		metrics  []telegraf.Metric
+	}{
+		{
+			name:    "cycle",
+			metrics: cycle("vessel-0042", "1234", "success"),
+		},
+		{
+			name: "cycles",
+			metrics: append(
+				cycle("vessel-0042", "1234", "success"),
+				append(cycle("vessel-0042", "1235", "aborted"), cycle("vessel-0043", "87", "success")...)...,
+			),
+		},
+		{
+			// Aggregates of different cycles merge when the identity does
+			// not tell them apart
+			name:     "identity",
+			identity: []string{"id"},
+			units:    time.Millisecond,
+			metrics: append(
+				cycle("vessel-0042", "1234", "success")[:2],
+				cycle("vessel-0042", "1235", "success")[2:]...,
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSerializer(nil, tt.identity, tt.units)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := s.SerializeBatch(tt.metrics)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "batch_"+tt.name+".json", b)
+		})
+	}
+}